@@ -0,0 +1,64 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/nfisher/pcie-exporter/internal/baseline"
+	"github.com/nfisher/pcie-exporter/internal/pcie"
+	"github.com/nfisher/pcie-exporter/internal/pciids"
+)
+
+const baselineUsage = "usage: pcie-exporter baseline capture [-sysfs-root path] [-pci-ids path] [-name sku] [-output file]"
+
+// runBaseline implements the "baseline" subcommand.
+func runBaseline(args []string, stdout io.Writer) error {
+	if len(args) == 0 || args[0] != "capture" {
+		return errors.New(baselineUsage)
+	}
+
+	flags := flag.NewFlagSet("baseline capture", flag.ContinueOnError)
+	sysfsRootFlag := flags.String("sysfs-root", "", "sysfs root path override (defaults to /sys or PCIE_EXPORTER_SYSFS)")
+	pciIDsPath := flags.String("pci-ids", pciids.DefaultPath, "path to the pci.ids database used for device names")
+	name := flags.String("name", "", "hardware SKU the baseline describes, e.g. H100")
+	output := flags.String("output", "", "file to write the baseline to (defaults to stdout)")
+	if err := flags.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	sysfsRoot := resolveSysfsRoot(*sysfsRootFlag)
+	pciIDs, err := pciids.Open(*pciIDsPath)
+	if err != nil {
+		return err
+	}
+
+	// A baseline captured from a partially readable host would bake the
+	// failure in, so any read error aborts the capture.
+	devices, tree, deviceErrs, err := pcie.ReadDevicesAndTree(sysfsRoot)
+	if err != nil {
+		return err
+	}
+	if len(deviceErrs) > 0 {
+		return fmt.Errorf("capture baseline: %d devices could not be read, first: %w", len(deviceErrs), &deviceErrs[0])
+	}
+	pcie.ApplyTreeNames(tree, pciIDs)
+
+	captured := baseline.Capture(*name, tree, devices, time.Now())
+	if *output == "" {
+		return baseline.Write(stdout, captured)
+	}
+
+	f, err := os.Create(*output)
+	if err != nil {
+		return fmt.Errorf("write baseline: %w", err)
+	}
+	if err := baseline.Write(f, captured); err != nil {
+		f.Close()
+		return fmt.Errorf("write baseline %s: %w", *output, err)
+	}
+	return f.Close()
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/nfisher/pcie-exporter/internal/pcie"
+)
+
+// filterFlags holds one side (include or exclude) of the device filter flags.
+type filterFlags struct {
+	classes string
+	vendors string
+	drivers string
+	address string
+}
+
+// rules turns comma-separated flag values into one rule per value. Vendor
+// values are "vendor" or "vendor:device".
+func (f filterFlags) rules() ([]pcie.FilterRule, error) {
+	var rules []pcie.FilterRule
+	for _, class := range splitList(f.classes) {
+		rules = append(rules, pcie.FilterRule{ClassPrefix: class})
+	}
+	for _, vendor := range splitList(f.vendors) {
+		vendorID, deviceID, hasDevice := strings.Cut(vendor, ":")
+		if vendorID == "" || (hasDevice && deviceID == "") {
+			return nil, fmt.Errorf("vendor filter %q must be vendor or vendor:device", vendor)
+		}
+		rules = append(rules, pcie.FilterRule{VendorID: vendorID, DeviceID: deviceID})
+	}
+	for _, driver := range splitList(f.drivers) {
+		rules = append(rules, pcie.FilterRule{Driver: driver})
+	}
+	if f.address != "" {
+		rules = append(rules, pcie.FilterRule{Address: f.address})
+	}
+	return rules, nil
+}
+
+// buildFilter merges the filter config file, if any, with the flag rules.
+// It returns a nil filter when no rules are set.
+func buildFilter(configPath string, include, exclude filterFlags, filterTree bool) (*pcie.Filter, bool, error) {
+	var config pcie.FilterConfig
+	if configPath != "" {
+		var err error
+		config, err = pcie.LoadFilterConfig(configPath)
+		if err != nil {
+			return nil, false, err
+		}
+	}
+
+	includeRules, err := include.rules()
+	if err != nil {
+		return nil, false, err
+	}
+	excludeRules, err := exclude.rules()
+	if err != nil {
+		return nil, false, err
+	}
+	config.Include = append(config.Include, includeRules...)
+	config.Exclude = append(config.Exclude, excludeRules...)
+	if len(config.Include) == 0 && len(config.Exclude) == 0 {
+		return nil, false, nil
+	}
+
+	filter, err := pcie.NewFilter(config.Include, config.Exclude)
+	if err != nil {
+		return nil, false, err
+	}
+	return filter, config.Tree || filterTree, nil
+}
+
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
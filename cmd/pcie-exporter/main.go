@@ -1,26 +1,155 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"flag"
 	"log"
 	"net/http"
 	"os"
+	"strings"
 	"time"
 
+	"github.com/nfisher/pcie-exporter/internal/baseline"
 	"github.com/nfisher/pcie-exporter/internal/exporter"
+	"github.com/nfisher/pcie-exporter/internal/pciids"
+	"github.com/nfisher/pcie-exporter/internal/policy"
+	"github.com/nfisher/pcie-exporter/internal/state"
+	"github.com/nfisher/pcie-exporter/internal/topology"
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "baseline" {
+		if err := runBaseline(os.Args[2:], os.Stdout); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
 	listenAddress := flag.String("listen-address", ":9808", "HTTP listen address")
 	sysfsRootFlag := flag.String("sysfs-root", "", "sysfs root path override (defaults to /sys or PCIE_EXPORTER_SYSFS)")
+	powerAware := flag.Bool("power-aware", false, "treat link speed drops caused by power management as healthy")
+	pciIDsPath := flag.String("pci-ids", pciids.DefaultPath, "path to the pci.ids database used for vendor, device and class names")
+	legacyLabels := flag.Bool("legacy-labels", false, "keep vendor, class and link speed/width labels on negotiation metrics (deprecated)")
+	speedWindow := flag.Duration("speed-window", 10*time.Minute, "how long observed link speeds are remembered in power-aware mode (0 disables)")
+	collectInterval := flag.Duration("collect-interval", 15*time.Second, "background sysfs collection interval (0 collects on demand only)")
+	maxStaleness := flag.Duration("max-staleness", 30*time.Second, "oldest snapshot served before a request triggers a fresh collection")
+	watchInterval := flag.Duration("watch-interval", time.Second, "link state polling interval for transition detection (0 disables the watcher and /events)")
+	eventBuffer := flag.Int("event-buffer", exporter.DefaultEventCapacity, "number of link events kept for /events")
+	stateFile := flag.String("state-file", "", "JSON file that keeps boot link state and transition counts across restarts (empty disables)")
+	kernelLogEnabled := flag.Bool("kernel-log", false, "count PCIe bus error and link messages from the kernel log")
+	kernelLogPath := flag.String("kernel-log-path", exporter.DefaultKernelLogPath, "kernel log to read with -kernel-log, e.g. a captured dmesg for testing")
+	procfsRootFlag := flag.String("procfs-root", "", "procfs root path override (defaults to /proc or PCIE_EXPORTER_PROCFS)")
+	baselinePath := flag.String("baseline", "", "expected-topology baseline file to compare each snapshot against (empty disables)")
+	policyPath := flag.String("policy", "", "policy file of per-device link expectations (empty judges every device against its maximum)")
+	var include, exclude filterFlags
+	flag.StringVar(&include.classes, "include-class", "", "comma-separated class code prefixes of devices to export, e.g. 0302,0200,0108")
+	flag.StringVar(&exclude.classes, "exclude-class", "", "comma-separated class code prefixes of devices to leave out, e.g. 0604")
+	flag.StringVar(&include.vendors, "include-vendor", "", "comma-separated vendor or vendor:device IDs of devices to export")
+	flag.StringVar(&exclude.vendors, "exclude-vendor", "", "comma-separated vendor or vendor:device IDs of devices to leave out")
+	flag.StringVar(&include.drivers, "include-driver", "", "comma-separated bound drivers of devices to export")
+	flag.StringVar(&exclude.drivers, "exclude-driver", "", "comma-separated bound drivers of devices to leave out")
+	flag.StringVar(&include.address, "include-address", "", "regular expression over PCI addresses of devices to export")
+	flag.StringVar(&exclude.address, "exclude-address", "", "regular expression over PCI addresses of devices to leave out")
+	filterConfig := flag.String("filter-config", "", "JSON file of include/exclude device filter rules, merged with the filter flags")
+	filterTree := flag.Bool("filter-tree", false, "also apply the device filter to /pcie-tree, keeping ancestors of included devices")
+	topologyClasses := flag.String("topology-classes", strings.Join(topology.DefaultClasses, ","), "comma-separated class code prefixes of the devices in /pcie-topology-matrix")
 	flag.Parse()
 
+	if *stateFile != "" && *watchInterval <= 0 {
+		log.Fatal("-state-file needs the link watcher; set -watch-interval above 0 or drop -state-file")
+	}
+
 	sysfsRoot := resolveSysfsRoot(*sysfsRootFlag)
+	pciIDs, err := pciids.Open(*pciIDsPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var expected *baseline.Baseline
+	if *baselinePath != "" {
+		expected, err = baseline.Load(*baselinePath)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	var linkPolicy *policy.Policy
+	if *policyPath != "" {
+		linkPolicy, err = policy.Load(*policyPath)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	filter, filterTreeEnabled, err := buildFilter(*filterConfig, include, exclude, *filterTree)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Sources of per-device counters that outlive the device, so the filter
+	// keeps applying to them after the device is removed.
+	var counters []exporter.AddressCounter
+	var watcher *exporter.Watcher
+	if *watchInterval > 0 {
+		watcherOpts := exporter.WatcherOptions{EventCapacity: *eventBuffer}
+		if *stateFile != "" {
+			bootID, err := state.ReadBootID(resolveProcfsRoot(*procfsRootFlag))
+			if err != nil {
+				log.Fatal(err)
+			}
+			watcherOpts.State = state.NewStore(*stateFile, bootID)
+		}
+		watcher, err = exporter.NewWatcher(sysfsRoot, watcherOpts)
+		if err != nil {
+			log.Fatal(err)
+		}
+		go watcher.Run(context.Background(), *watchInterval)
+		counters = append(counters, watcher)
+	}
+
+	var kernelLog *exporter.KernelLog
+	if *kernelLogEnabled {
+		// Only a captured log is replayed; /dev/kmsg is read from its end.
+		kernelLog = exporter.NewKernelLog(exporter.KernelLogOptions{
+			Path:   *kernelLogPath,
+			Replay: *kernelLogPath != exporter.DefaultKernelLogPath,
+		})
+		go func() {
+			if err := kernelLog.Run(context.Background()); err != nil {
+				log.Printf("kernel log: %v", err)
+			}
+		}()
+		counters = append(counters, kernelLog)
+	}
+
+	collector := exporter.NewCollector(sysfsRoot, exporter.Options{
+		PowerAware:      *powerAware,
+		SpeedWindow:     *speedWindow,
+		PCIIDs:          pciIDs,
+		MaxStaleness:    *maxStaleness,
+		Baseline:        expected,
+		Policy:          linkPolicy,
+		Filter:          filter,
+		FilterTree:      filterTreeEnabled,
+		TopologyClasses: splitList(*topologyClasses),
+		Counters:        counters,
+	})
+	if *collectInterval > 0 {
+		go collector.Run(context.Background(), *collectInterval)
+	}
 
 	mux := http.NewServeMux()
-	mux.Handle("/metrics", exporter.NewHandler(sysfsRoot))
-	mux.Handle("/pcie-tree", exporter.NewTreeHandler(sysfsRoot))
+	mux.Handle("/metrics", exporter.NewHandler(collector, exporter.HandlerOptions{
+		LegacyLabels: *legacyLabels,
+		Watcher:      watcher,
+		KernelLog:    kernelLog,
+	}))
+	mux.Handle("/pcie-tree", exporter.NewTreeHandler(collector))
+	mux.Handle("/pcie-topology-matrix", exporter.NewTopologyHandler(collector))
+	if watcher != nil {
+		mux.Handle("/events", exporter.NewEventsHandler(watcher))
+	}
 	mux.HandleFunc("/healthz", func(w http.ResponseWriter, _ *http.Request) {
 		w.WriteHeader(http.StatusOK)
 		_, _ = w.Write([]byte("ok\n"))
@@ -47,3 +176,13 @@ func resolveSysfsRoot(sysfsRootFlag string) string {
 	}
 	return "/sys"
 }
+
+func resolveProcfsRoot(procfsRootFlag string) string {
+	if procfsRootFlag != "" {
+		return procfsRootFlag
+	}
+	if fromEnv := os.Getenv("PCIE_EXPORTER_PROCFS"); fromEnv != "" {
+		return fromEnv
+	}
+	return "/proc"
+}
@@ -1,9 +1,12 @@
 package main
 
 import (
+	"bytes"
+	"path/filepath"
 	"testing"
 
 	"github.com/gogunit/gunit/hammy"
+	"github.com/nfisher/pcie-exporter/internal/baseline"
 )
 
 func TestResolveSysfsRootFlagWins(t *testing.T) {
@@ -29,3 +32,63 @@ func TestResolveSysfsRootDefaultsToSys(t *testing.T) {
 	resolved := resolveSysfsRoot("")
 	h.Is(hammy.String(resolved).EqualTo("/sys"))
 }
+
+func TestResolveProcfsRootFlagWins(t *testing.T) {
+	h := hammy.New(t)
+
+	t.Setenv("PCIE_EXPORTER_PROCFS", "/from/env")
+	resolved := resolveProcfsRoot("/from/flag")
+	h.Is(hammy.String(resolved).EqualTo("/from/flag"))
+}
+
+func TestResolveProcfsRootUsesEnv(t *testing.T) {
+	h := hammy.New(t)
+
+	t.Setenv("PCIE_EXPORTER_PROCFS", "/from/env")
+	resolved := resolveProcfsRoot("")
+	h.Is(hammy.String(resolved).EqualTo("/from/env"))
+}
+
+func TestResolveProcfsRootDefaultsToProc(t *testing.T) {
+	h := hammy.New(t)
+
+	t.Setenv("PCIE_EXPORTER_PROCFS", "")
+	resolved := resolveProcfsRoot("")
+	h.Is(hammy.String(resolved).EqualTo("/proc"))
+}
+
+func TestRunBaselineCaptureWritesBaseline(t *testing.T) {
+	h := hammy.New(t)
+
+	var out bytes.Buffer
+	err := runBaseline([]string{"capture", "-sysfs-root", filepath.Join("..", "..", "internal", "pcie", "testdata", "sysfs"), "-pci-ids", "", "-name", "test-sku"}, &out)
+	h.Is(hammy.NilError(err))
+
+	captured, err := baseline.Parse(&out)
+	h.Is(hammy.NilError(err))
+	h.Is(hammy.String(captured.Name).EqualTo("test-sku"))
+	h.Is(hammy.Number(len(captured.Devices)).EqualTo(3))
+}
+
+func TestRunBaselineRequiresCapture(t *testing.T) {
+	h := hammy.New(t)
+
+	err := runBaseline(nil, &bytes.Buffer{})
+	h.Is(hammy.Error(err))
+}
+
+func TestBuildFilterFromFlags(t *testing.T) {
+	h := hammy.New(t)
+
+	filter, filterTree, err := buildFilter("", filterFlags{classes: "0302, 0200", vendors: "15b3:1017"}, filterFlags{drivers: "vfio-pci"}, true)
+	h.Is(hammy.NilError(err))
+	h.Is(hammy.True(filter != nil))
+	h.Is(hammy.True(filterTree))
+
+	filter, _, err = buildFilter("", filterFlags{}, filterFlags{}, false)
+	h.Is(hammy.NilError(err))
+	h.Is(hammy.True(filter == nil))
+
+	_, _, err = buildFilter("", filterFlags{vendors: "10de:"}, filterFlags{}, false)
+	h.Is(hammy.Error(err))
+}
@@ -0,0 +1,221 @@
+// Package baseline describes the PCIe topology a host is expected to have and
+// compares a live snapshot against it. Baselines are captured once from a
+// known-good host of a hardware SKU and then shipped to every host of that SKU.
+package baseline
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/nfisher/pcie-exporter/internal/pcie"
+)
+
+// FormatVersion is the baseline file format written by Capture.
+const FormatVersion = 1
+
+// Mismatch fields reported by Compare.
+const (
+	FieldVendorID  = "vendor_id"
+	FieldDeviceID  = "device_id"
+	FieldClass     = "class"
+	FieldParent    = "parent"
+	FieldLinkSpeed = "link_speed"
+	FieldLinkWidth = "link_width"
+)
+
+// Baseline is the expected topology of one hardware SKU.
+type Baseline struct {
+	Version    int       `json:"version"`
+	Name       string    `json:"name,omitempty"`
+	CapturedAt time.Time `json:"captured_at"`
+	Devices    []Device  `json:"devices"`
+}
+
+// Device is one expected PCI function. Its tree position is BusID together
+// with Parent, the upstream bus ID, which is empty for devices directly below
+// a host bridge. LinkSpeed and LinkWidth are the lowest acceptable negotiated
+// link and are empty for devices without link data.
+type Device struct {
+	BusID     string `json:"bus_id"`
+	Parent    string `json:"parent,omitempty"`
+	VendorID  string `json:"vendor_id"`
+	DeviceID  string `json:"device_id"`
+	Class     string `json:"class"`
+	Name      string `json:"name,omitempty"`
+	LinkSpeed string `json:"link_speed,omitempty"`
+	LinkWidth string `json:"link_width,omitempty"`
+}
+
+// Mismatch is an expected device that is present but differs from the baseline.
+type Mismatch struct {
+	BusID    string
+	Field    string
+	Expected string
+	Actual   string
+}
+
+// Result is the outcome of comparing a snapshot against a baseline.
+type Result struct {
+	Expected   int
+	Missing    []Device
+	Unexpected []string
+	Mismatches []Mismatch
+}
+
+// Conformant reports whether the snapshot matched the baseline exactly.
+func (r Result) Conformant() bool {
+	return len(r.Missing) == 0 && len(r.Unexpected) == 0 && len(r.Mismatches) == 0
+}
+
+// Load reads a baseline file.
+func Load(path string) (*Baseline, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("open baseline %s: %w", path, err)
+	}
+	defer f.Close()
+
+	b, err := Parse(f)
+	if err != nil {
+		return nil, fmt.Errorf("parse baseline %s: %w", path, err)
+	}
+	return b, nil
+}
+
+// Parse decodes a baseline and rejects unknown format versions.
+func Parse(r io.Reader) (*Baseline, error) {
+	var b Baseline
+	if err := json.NewDecoder(r).Decode(&b); err != nil {
+		return nil, err
+	}
+	if b.Version != FormatVersion {
+		return nil, fmt.Errorf("unsupported baseline version %d", b.Version)
+	}
+	for i := range b.Devices {
+		b.Devices[i].BusID = strings.ToLower(b.Devices[i].BusID)
+		b.Devices[i].Parent = strings.ToLower(b.Devices[i].Parent)
+	}
+	return &b, nil
+}
+
+// Write encodes b as indented JSON.
+func Write(w io.Writer, b *Baseline) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(b)
+}
+
+// Capture builds a baseline from a tree and the devices read alongside it.
+// Links are recorded as currently negotiated, so capture from a host whose
+// links are known to be healthy and whose GPUs are not idling at a lower speed.
+func Capture(name string, tree []*pcie.TreeNode, devices []pcie.Device, now time.Time) *Baseline {
+	links := indexDevices(devices)
+	b := &Baseline{Version: FormatVersion, Name: name, CapturedAt: now.UTC()}
+	walkTree(tree, "", func(node *pcie.TreeNode, parent string) {
+		expected := Device{
+			BusID:    node.BusID,
+			Parent:   parent,
+			VendorID: node.VendorID,
+			DeviceID: node.DeviceID,
+			Class:    node.Class,
+			Name:     node.DeviceName,
+		}
+		if device, ok := links[node.BusID]; ok {
+			expected.LinkSpeed = device.CurrentLinkSpeed
+			expected.LinkWidth = device.CurrentLinkWidth
+		}
+		b.Devices = append(b.Devices, expected)
+	})
+	return b
+}
+
+// Compare checks a snapshot against b. A link below the expected speed is not
+// a mismatch when the device is classified as power managed.
+func Compare(b *Baseline, tree []*pcie.TreeNode, devices []pcie.Device) Result {
+	result := Result{Expected: len(b.Devices)}
+
+	nodes := make(map[string]*pcie.TreeNode)
+	parents := make(map[string]string)
+	walkTree(tree, "", func(node *pcie.TreeNode, parent string) {
+		nodes[node.BusID] = node
+		parents[node.BusID] = parent
+	})
+	links := indexDevices(devices)
+
+	expected := make(map[string]bool, len(b.Devices))
+	for _, want := range b.Devices {
+		expected[want.BusID] = true
+		node, ok := nodes[want.BusID]
+		if !ok {
+			result.Missing = append(result.Missing, want)
+			continue
+		}
+
+		mismatch := func(field, expectedValue, actual string) {
+			result.Mismatches = append(result.Mismatches, Mismatch{BusID: want.BusID, Field: field, Expected: expectedValue, Actual: actual})
+		}
+		if !strings.EqualFold(want.VendorID, node.VendorID) {
+			mismatch(FieldVendorID, want.VendorID, node.VendorID)
+		}
+		if !strings.EqualFold(want.DeviceID, node.DeviceID) {
+			mismatch(FieldDeviceID, want.DeviceID, node.DeviceID)
+		}
+		if !strings.EqualFold(want.Class, node.Class) {
+			mismatch(FieldClass, want.Class, node.Class)
+		}
+		if want.Parent != parents[want.BusID] {
+			mismatch(FieldParent, want.Parent, parents[want.BusID])
+		}
+
+		device, hasLink := links[want.BusID]
+		if want.LinkWidth != "" {
+			wantWidth, _ := pcie.ParseLinkWidth(want.LinkWidth)
+			width, ok := pcie.ParseLinkWidth(device.CurrentLinkWidth)
+			if !hasLink || !ok || width < wantWidth {
+				mismatch(FieldLinkWidth, want.LinkWidth, device.CurrentLinkWidth)
+			}
+		}
+		if want.LinkSpeed != "" && device.DegradationReason != pcie.DegradationPowerManaged {
+			wantSpeed, _ := pcie.ParseLinkSpeed(want.LinkSpeed)
+			speed, ok := pcie.ParseLinkSpeed(device.CurrentLinkSpeed)
+			if !hasLink || !ok || speed+1e-9 < wantSpeed {
+				mismatch(FieldLinkSpeed, want.LinkSpeed, device.CurrentLinkSpeed)
+			}
+		}
+	}
+
+	for busID := range nodes {
+		if !expected[busID] {
+			result.Unexpected = append(result.Unexpected, busID)
+		}
+	}
+	sort.Slice(result.Unexpected, func(i, j int) bool {
+		return pcie.LessAddress(result.Unexpected[i], result.Unexpected[j])
+	})
+	return result
+}
+
+func indexDevices(devices []pcie.Device) map[string]pcie.Device {
+	index := make(map[string]pcie.Device, len(devices))
+	for _, device := range devices {
+		index[strings.ToLower(device.Address)] = device
+	}
+	return index
+}
+
+// walkTree skips SR-IOV virtual functions: they come and go with
+// sriov_numvfs, which is runtime configuration rather than topology.
+func walkTree(nodes []*pcie.TreeNode, parent string, visit func(node *pcie.TreeNode, parent string)) {
+	for _, node := range nodes {
+		if node.SRIOV.IsVF() {
+			continue
+		}
+		visit(node, parent)
+		walkTree(node.Children, node.BusID, visit)
+	}
+}
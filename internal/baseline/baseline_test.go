@@ -0,0 +1,97 @@
+package baseline
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gogunit/gunit/hammy"
+	"github.com/nfisher/pcie-exporter/internal/pcie"
+)
+
+func TestCaptureRoundTripsAndConforms(t *testing.T) {
+	h := hammy.New(t)
+
+	tree, devices := readFixture(t)
+	captured := Capture("test-sku", tree, devices, time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+
+	h.Is(hammy.Number(len(captured.Devices)).EqualTo(3))
+	h.Is(hammy.String(captured.Devices[0].BusID).EqualTo("0000:01:00.0"))
+	h.Is(hammy.String(captured.Devices[0].VendorID).EqualTo("0x10de"))
+	h.Is(hammy.String(captured.Devices[0].LinkSpeed).EqualTo("16 GT/s PCIe"))
+	h.Is(hammy.String(captured.Devices[0].LinkWidth).EqualTo("16"))
+	h.Is(hammy.String(captured.Devices[2].LinkWidth).EqualTo(""))
+
+	var buf bytes.Buffer
+	h.Is(hammy.NilError(Write(&buf, captured)))
+	loaded, err := Parse(&buf)
+	h.Is(hammy.NilError(err))
+	h.Is(hammy.String(loaded.Name).EqualTo("test-sku"))
+
+	result := Compare(loaded, tree, devices)
+	h.Is(hammy.True(result.Conformant()))
+	h.Is(hammy.Number(result.Expected).EqualTo(3))
+}
+
+func TestCompareReportsMissingUnexpectedAndMismatched(t *testing.T) {
+	h := hammy.New(t)
+
+	tree, devices := readFixture(t)
+	expected := Capture("test-sku", tree, devices, time.Now())
+	expected.Devices[1].DeviceID = "0x1235"
+	expected.Devices[2].BusID = "0000:04:00.0"
+
+	devices[0].CurrentLinkWidth = "8"
+	devices[0].CurrentLinkSpeed = "2.5 GT/s PCIe"
+	devices[0].DegradationReason = pcie.DegradationPowerManaged
+
+	result := Compare(expected, tree, devices)
+
+	h.Is(hammy.False(result.Conformant()))
+	h.Is(hammy.Number(len(result.Missing)).EqualTo(1))
+	h.Is(hammy.String(result.Missing[0].BusID).EqualTo("0000:04:00.0"))
+	h.Is(hammy.Number(len(result.Unexpected)).EqualTo(1))
+	h.Is(hammy.String(result.Unexpected[0]).EqualTo("0000:03:00.0"))
+	h.Is(hammy.Number(len(result.Mismatches)).EqualTo(2))
+	h.Is(hammy.String(result.Mismatches[0].Field).EqualTo(FieldLinkWidth))
+	h.Is(hammy.String(result.Mismatches[0].Actual).EqualTo("8"))
+	h.Is(hammy.String(result.Mismatches[1].Field).EqualTo(FieldDeviceID))
+	h.Is(hammy.String(result.Mismatches[1].Expected).EqualTo("0x1235"))
+}
+
+func TestBaselineIgnoresVirtualFunctions(t *testing.T) {
+	h := hammy.New(t)
+
+	tree, devices := readFixture(t)
+	expected := Capture("test-sku", tree, devices, time.Now())
+
+	pf := tree[0]
+	pf.Children = append(pf.Children, &pcie.TreeNode{
+		BusID: "0000:01:00.2",
+		Class: "0x020000",
+		SRIOV: &pcie.SRIOV{PhysFn: pf.BusID},
+	})
+	captured := Capture("test-sku", tree, devices, time.Now())
+	h.Is(hammy.Number(len(captured.Devices)).EqualTo(len(expected.Devices)))
+
+	result := Compare(expected, tree, devices)
+	h.Is(hammy.True(result.Conformant()))
+	h.Is(hammy.Slice(result.Unexpected).IsEmpty())
+}
+
+func TestParseRejectsUnknownVersion(t *testing.T) {
+	h := hammy.New(t)
+
+	_, err := Parse(strings.NewReader(`{"version": 2, "devices": []}`))
+	h.Is(hammy.Error(err))
+}
+
+func readFixture(t *testing.T) ([]*pcie.TreeNode, []pcie.Device) {
+	t.Helper()
+	h := hammy.New(t)
+	devices, tree, _, err := pcie.ReadDevicesAndTree(filepath.Join("..", "pcie", "testdata", "sysfs"))
+	h.Is(hammy.NilError(err))
+	return tree, devices
+}
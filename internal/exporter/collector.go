@@ -0,0 +1,305 @@
+package exporter
+
+import (
+	"context"
+	"maps"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/nfisher/pcie-exporter/internal/baseline"
+	"github.com/nfisher/pcie-exporter/internal/pcie"
+	"github.com/nfisher/pcie-exporter/internal/pciids"
+	"github.com/nfisher/pcie-exporter/internal/policy"
+	"github.com/nfisher/pcie-exporter/internal/topology"
+)
+
+// Options configures how the Collector reads and interprets sysfs.
+type Options struct {
+	// PowerAware reports link speed drops caused by power management as
+	// healthy instead of degraded.
+	PowerAware bool
+	// SpeedWindow is how long observed link speeds are remembered in
+	// power-aware mode. Zero only uses the current power state.
+	SpeedWindow time.Duration
+	// PCIIDs resolves vendor, device and class names. Nil leaves names empty.
+	PCIIDs *pciids.DB
+	// MaxStaleness is the oldest snapshot a request will be served from
+	// before it triggers a fresh collection. Zero collects on every request.
+	MaxStaleness time.Duration
+	// Baseline is the expected topology each snapshot is compared against.
+	// Nil skips the comparison.
+	Baseline *baseline.Baseline
+	// Policy sets per-device link expectations. Nil judges every device
+	// against its own maximum.
+	Policy *policy.Policy
+	// Filter limits the devices that are exported. The baseline comparison
+	// still sees every device. Nil exports everything.
+	Filter *pcie.Filter
+	// FilterTree also applies Filter to the topology tree.
+	FilterTree bool
+	// Counters are the other sources of per-device series, such as the link
+	// watcher. The filter decision for a removed device is kept while one of
+	// them still counts it.
+	Counters []AddressCounter
+	// TopologyClasses selects the devices of the topology matrix by class
+	// code prefix. Nil uses topology.DefaultClasses.
+	TopologyClasses []string
+}
+
+// Snapshot is the result of one sysfs walk. It is shared by every handler
+// and must not be modified once published.
+type Snapshot struct {
+	Devices      []pcie.Device
+	DeviceErrors []pcie.DeviceError
+	Tree         []*pcie.TreeNode
+	// Err is set when the device list itself could not be read.
+	Err error
+	// ReadErrors holds the cumulative per-device read error totals as of
+	// this snapshot, sorted by device and file.
+	ReadErrors []ReadErrorCount
+	// Conformance is nil when no baseline is configured.
+	Conformance *baseline.Result
+	// Topology is nil when the device list could not be read.
+	Topology *topology.Matrix
+	// GPUNICPairs counts GPU-NIC pairs by relationship independently of the
+	// classes selected for Topology. It is nil when Topology is.
+	GPUNICPairs []topology.PairCount
+	// ASPMPolicy is empty when the kernel has no ASPM support or the policy
+	// could not be read.
+	ASPMPolicy  pcie.ASPMPolicy
+	CollectedAt time.Time
+	Duration    time.Duration
+
+	// exported holds the filter decision for every address that is present or
+	// still has counters; nil when no filter is configured.
+	exported map[string]bool
+}
+
+// Exports reports whether per-device series for address pass the device
+// filter. Addresses never seen in the topology tree are left out while a
+// filter is configured.
+func (s *Snapshot) Exports(address string) bool {
+	if s.exported == nil {
+		return true
+	}
+	return s.exported[address]
+}
+
+// AddressCounter is a source of per-device counters that outlive the device.
+type AddressCounter interface {
+	// CountedAddresses returns every address that has a counter.
+	CountedAddresses() []string
+}
+
+// ReadErrorCount is the running total of failed reads for one device file.
+type ReadErrorCount struct {
+	Device string
+	File   string
+	Count  uint64
+}
+
+type readErrorKey struct {
+	device string
+	file   string
+}
+
+// Collector walks sysfs and publishes immutable snapshots. Concurrent
+// requests for a fresh snapshot share a single collection.
+type Collector struct {
+	sysfsRoot       string
+	powerAware      bool
+	pciIDs          *pciids.DB
+	maxStaleness    time.Duration
+	baseline        *baseline.Baseline
+	policy          *policy.Policy
+	filter          *pcie.Filter
+	filterTree      bool
+	topologyClasses []string
+	counters        []AddressCounter
+	speedHistory    *pcie.SpeedHistory
+
+	mu       sync.Mutex
+	current  *Snapshot
+	inflight chan struct{}
+	readErrs map[readErrorKey]uint64
+	// exported remembers the filter decision for every present address and
+	// for removed ones that still have counters, so those counters keep
+	// following the filter.
+	exported map[string]bool
+}
+
+func NewCollector(sysfsRoot string, opts Options) *Collector {
+	c := &Collector{
+		sysfsRoot:       sysfsRoot,
+		powerAware:      opts.PowerAware,
+		pciIDs:          opts.PCIIDs,
+		maxStaleness:    opts.MaxStaleness,
+		baseline:        opts.Baseline,
+		policy:          opts.Policy,
+		filter:          opts.Filter,
+		filterTree:      opts.FilterTree,
+		topologyClasses: opts.TopologyClasses,
+		counters:        opts.Counters,
+		readErrs:        make(map[readErrorKey]uint64),
+	}
+	if opts.Filter != nil {
+		c.exported = make(map[string]bool)
+	}
+	if c.topologyClasses == nil {
+		c.topologyClasses = topology.DefaultClasses
+	}
+	if opts.PowerAware && opts.SpeedWindow > 0 {
+		c.speedHistory = pcie.NewSpeedHistory(opts.SpeedWindow)
+	}
+	return c
+}
+
+// Run refreshes the snapshot every interval until ctx is done.
+func (c *Collector) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	c.Refresh()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			c.Refresh()
+		}
+	}
+}
+
+// Snapshot returns the current snapshot, collecting a new one first when
+// there is none or it is older than MaxStaleness.
+func (c *Collector) Snapshot() *Snapshot {
+	c.mu.Lock()
+	current := c.current
+	c.mu.Unlock()
+
+	if current != nil && time.Since(current.CollectedAt) <= c.maxStaleness {
+		return current
+	}
+	return c.Refresh()
+}
+
+// Refresh collects a new snapshot. If a collection is already running the
+// caller waits for it and receives its result instead of starting another.
+func (c *Collector) Refresh() *Snapshot {
+	c.mu.Lock()
+	if c.inflight != nil {
+		done := c.inflight
+		c.mu.Unlock()
+		<-done
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		return c.current
+	}
+	done := make(chan struct{})
+	c.inflight = done
+	c.mu.Unlock()
+
+	snapshot := c.collect()
+
+	c.mu.Lock()
+	snapshot.ReadErrors = c.recordReadErrors(snapshot.DeviceErrors)
+	if c.exported != nil {
+		c.updateExported(snapshot.exported)
+		snapshot.exported = maps.Clone(c.exported)
+	}
+	c.current = snapshot
+	c.inflight = nil
+	c.mu.Unlock()
+	close(done)
+
+	return snapshot
+}
+
+func (c *Collector) collect() *Snapshot {
+	start := time.Now()
+	snapshot := &Snapshot{CollectedAt: start}
+
+	// Devices and tree come from one walk so /metrics, /pcie-tree, the
+	// baseline comparison and the topology matrix agree with each other.
+	devices, tree, deviceErrs, err := pcie.ReadDevicesAndTree(c.sysfsRoot)
+	if err != nil {
+		snapshot.Err = err
+		snapshot.Duration = time.Since(start)
+		return snapshot
+	}
+	pcie.ApplyNames(devices, c.pciIDs)
+	c.policy.Apply(devices)
+	if c.powerAware {
+		if c.speedHistory != nil {
+			c.speedHistory.Observe(devices, start)
+		}
+		pcie.ApplyPowerManagement(devices, c.speedHistory)
+	}
+
+	pcie.ApplyTreeNames(tree, c.pciIDs)
+	if c.exported != nil {
+		snapshot.exported = make(map[string]bool)
+		c.filter.Decide(tree, snapshot.exported)
+	}
+	if c.baseline != nil {
+		conformance := baseline.Compare(c.baseline, tree, devices)
+		snapshot.Conformance = &conformance
+	}
+	snapshot.Topology = topology.Build(tree, c.topologyClasses)
+	snapshot.GPUNICPairs = topology.CountGPUNICPairs(tree)
+	// The policy is informational, so a failed read leaves it empty rather
+	// than failing the scrape.
+	if aspmPolicy, err := pcie.ReadASPMPolicy(c.sysfsRoot); err == nil {
+		snapshot.ASPMPolicy = aspmPolicy
+	}
+	devices = c.filter.Devices(devices)
+	if c.filterTree {
+		tree = c.filter.Tree(tree)
+	}
+
+	snapshot.Devices = devices
+	snapshot.DeviceErrors = deviceErrs
+	snapshot.Tree = tree
+	snapshot.Duration = time.Since(start)
+	return snapshot
+}
+
+// updateExported must be called with c.mu held. It records the decisions for
+// the current tree and forgets removed addresses that no counter names.
+func (c *Collector) updateExported(current map[string]bool) {
+	counted := make(map[string]bool)
+	for key := range c.readErrs {
+		counted[key.device] = true
+	}
+	for _, counter := range c.counters {
+		for _, address := range counter.CountedAddresses() {
+			counted[address] = true
+		}
+	}
+	for address := range c.exported {
+		if _, present := current[address]; !present && !counted[address] {
+			delete(c.exported, address)
+		}
+	}
+	maps.Copy(c.exported, current)
+}
+
+// recordReadErrors must be called with c.mu held.
+func (c *Collector) recordReadErrors(deviceErrs []pcie.DeviceError) []ReadErrorCount {
+	for _, deviceErr := range deviceErrs {
+		c.readErrs[readErrorKey{device: deviceErr.Address, file: deviceErr.File}]++
+	}
+
+	counts := make([]ReadErrorCount, 0, len(c.readErrs))
+	for key, count := range c.readErrs {
+		counts = append(counts, ReadErrorCount{Device: key.device, File: key.file, Count: count})
+	}
+	sort.Slice(counts, func(i, j int) bool {
+		if counts[i].Device != counts[j].Device {
+			return pcie.LessAddress(counts[i].Device, counts[j].Device)
+		}
+		return counts[i].File < counts[j].File
+	})
+	return counts
+}
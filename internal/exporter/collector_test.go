@@ -0,0 +1,145 @@
+package exporter
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gogunit/gunit/hammy"
+	"github.com/nfisher/pcie-exporter/internal/pcie"
+)
+
+func TestCollectorReusesFreshSnapshot(t *testing.T) {
+	h := hammy.New(t)
+
+	collector := NewCollector(filepath.Join("..", "pcie", "testdata", "sysfs"), Options{MaxStaleness: time.Hour})
+	first := collector.Snapshot()
+	second := collector.Snapshot()
+
+	h.Is(hammy.NilError(first.Err))
+	h.Is(hammy.Number(len(first.Devices)).EqualTo(2))
+	h.Is(hammy.Number(len(first.Tree)).EqualTo(3))
+	h.Is(hammy.True(first == second))
+}
+
+func TestCollectorRecollectsStaleSnapshot(t *testing.T) {
+	h := hammy.New(t)
+
+	collector := NewCollector(filepath.Join("..", "pcie", "testdata", "sysfs"), Options{})
+	first := collector.Snapshot()
+	second := collector.Snapshot()
+
+	h.Is(hammy.False(first == second))
+	h.Is(hammy.False(second.CollectedAt.Before(first.CollectedAt)))
+}
+
+func TestCollectorCoalescesConcurrentRequests(t *testing.T) {
+	h := hammy.New(t)
+
+	collector := NewCollector(filepath.Join("..", "pcie", "testdata", "sysfs"), Options{MaxStaleness: time.Hour})
+
+	const requests = 16
+	snapshots := make([]*Snapshot, requests)
+	var wg sync.WaitGroup
+	for i := range requests {
+		wg.Go(func() {
+			snapshots[i] = collector.Snapshot()
+		})
+	}
+	wg.Wait()
+
+	for _, snapshot := range snapshots {
+		h.Is(hammy.True(snapshot == snapshots[0]))
+	}
+}
+
+func TestCollectorRunCollectsImmediately(t *testing.T) {
+	h := hammy.New(t)
+
+	collector := NewCollector(filepath.Join("..", "pcie", "testdata", "sysfs"), Options{MaxStaleness: time.Hour})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	collector.Run(ctx, time.Hour)
+
+	collector.mu.Lock()
+	collected := collector.current
+	collector.mu.Unlock()
+
+	h.Is(hammy.NotNil(collected))
+	h.Is(hammy.True(collector.Snapshot() == collected))
+}
+
+func TestCollectorReportsMissingSysfs(t *testing.T) {
+	h := hammy.New(t)
+
+	collector := NewCollector(filepath.Join(t.TempDir(), "missing"), Options{})
+	snapshot := collector.Snapshot()
+
+	h.Is(hammy.Error(snapshot.Err))
+	h.Is(hammy.Number(len(snapshot.Devices)).EqualTo(0))
+}
+
+func TestCollectorAppliesFilter(t *testing.T) {
+	h := hammy.New(t)
+
+	filter, err := pcie.NewFilter([]pcie.FilterRule{{ClassPrefix: "0300"}}, nil)
+	h.Is(hammy.NilError(err))
+	collector := NewCollector(filepath.Join("..", "pcie", "testdata", "sysfs"), Options{Filter: filter, FilterTree: true})
+	snapshot := collector.Snapshot()
+
+	h.Is(hammy.Number(len(snapshot.Devices)).EqualTo(1))
+	h.Is(hammy.String(snapshot.Devices[0].Address).EqualTo("0000:01:00.0"))
+	h.Is(hammy.Number(len(snapshot.Tree)).EqualTo(1))
+	h.Is(hammy.True(snapshot.Exports("0000:01:00.0")))
+	h.Is(hammy.False(snapshot.Exports("0000:02:00.0")))
+	h.Is(hammy.False(snapshot.Exports("0000:7f:00.0")))
+}
+
+type countedAddresses []string
+
+func (c countedAddresses) CountedAddresses() []string {
+	return c
+}
+
+func TestCollectorForgetsRemovedDevicesWithoutCounters(t *testing.T) {
+	h := hammy.New(t)
+
+	sysfsRoot := t.TempDir()
+	gpuPath := filepath.Join(sysfsRoot, "bus", "pci", "devices", "0000:01:00.0")
+	nicPath := filepath.Join(sysfsRoot, "bus", "pci", "devices", "0000:02:00.0")
+	for _, devicePath := range []string{gpuPath, nicPath} {
+		writeWatchedLink(t, devicePath, "16")
+		h.Is(hammy.NilError(os.WriteFile(filepath.Join(devicePath, "class"), []byte("0x030200\n"), 0o644)))
+	}
+
+	filter, err := pcie.NewFilter([]pcie.FilterRule{{ClassPrefix: "0302"}}, nil)
+	h.Is(hammy.NilError(err))
+	// The watcher still counts transitions for the NIC after it is removed.
+	collector := NewCollector(sysfsRoot, Options{Filter: filter, Counters: []AddressCounter{countedAddresses{"0000:02:00.0"}}})
+	snapshot := collector.Refresh()
+	h.Is(hammy.True(snapshot.Exports("0000:01:00.0")))
+	h.Is(hammy.True(snapshot.Exports("0000:02:00.0")))
+
+	h.Is(hammy.NilError(os.RemoveAll(gpuPath)))
+	h.Is(hammy.NilError(os.RemoveAll(nicPath)))
+	snapshot = collector.Refresh()
+	h.Is(hammy.False(snapshot.Exports("0000:01:00.0")))
+	h.Is(hammy.True(snapshot.Exports("0000:02:00.0")))
+}
+
+func TestCollectorCountsGPUNICPairsIndependentlyOfMatrixClasses(t *testing.T) {
+	h := hammy.New(t)
+
+	collector := NewCollector(filepath.Join("..", "pcie", "testdata", "sysfs"), Options{TopologyClasses: []string{"0108"}})
+	snapshot := collector.Snapshot()
+
+	h.Is(hammy.Slice(snapshot.Topology.Endpoints).IsEmpty())
+	total := 0
+	for _, pair := range snapshot.GPUNICPairs {
+		total += pair.Count
+	}
+	h.Is(hammy.Number(total).EqualTo(2))
+}
@@ -0,0 +1,21 @@
+package exporter
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// EventsHandler serves the Watcher's buffered link events in JSON format.
+type EventsHandler struct {
+	watcher *Watcher
+}
+
+func NewEventsHandler(watcher *Watcher) *EventsHandler {
+	return &EventsHandler{watcher: watcher}
+}
+
+func (h *EventsHandler) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(h.watcher.Events())
+}
@@ -9,26 +9,49 @@ import (
 	"sync/atomic"
 	"time"
 
+	"github.com/nfisher/pcie-exporter/internal/baseline"
 	"github.com/nfisher/pcie-exporter/internal/pcie"
 )
 
 const contentType = "text/plain; version=0.0.4; charset=utf-8"
 
+// HandlerOptions configures the metrics output.
+type HandlerOptions struct {
+	// LegacyLabels keeps vendor, class and link speed/width labels on the
+	// negotiation metrics. Those labels change whenever a link retrains, so
+	// this only exists to ease migration to pcie_device_info and the
+	// numeric link gauges.
+	LegacyLabels bool
+	// Watcher supplies pcie_link_transitions_total. Nil omits the metric.
+	Watcher *Watcher
+	// KernelLog supplies pcie_kernel_events_total. Nil omits the metric.
+	KernelLog *KernelLog
+}
+
 // Handler serves Prometheus text exposition for PCIe link metrics.
 type Handler struct {
-	sysfsRoot  string
-	scrapes    atomic.Uint64
-	scrapeErrs atomic.Uint64
+	collector    *Collector
+	legacyLabels bool
+	watcher      *Watcher
+	kernelLog    *KernelLog
+	scrapes      atomic.Uint64
+	scrapeErrs   atomic.Uint64
 }
 
-func NewHandler(sysfsRoot string) *Handler {
-	return &Handler{sysfsRoot: sysfsRoot}
+func NewHandler(collector *Collector, opts HandlerOptions) *Handler {
+	return &Handler{
+		collector:    collector,
+		legacyLabels: opts.LegacyLabels,
+		watcher:      opts.Watcher,
+		kernelLog:    opts.KernelLog,
+	}
 }
 
 func (h *Handler) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
-	start := time.Now()
-	devices, err := pcie.ReadDevices(h.sysfsRoot)
-	scrapeDuration := time.Since(start).Seconds()
+	snapshot := h.collector.Snapshot()
+	devices := snapshot.Devices
+	links := linkDevices(devices)
+	err := snapshot.Err
 
 	h.scrapes.Add(1)
 	scrapeSuccess := 1
@@ -36,6 +59,10 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
 		h.scrapeErrs.Add(1)
 		scrapeSuccess = 0
 	}
+	scrapePartial := 0
+	if len(snapshot.DeviceErrors) > 0 {
+		scrapePartial = 1
+	}
 
 	w.Header().Set("Content-Type", contentType)
 	w.WriteHeader(http.StatusOK)
@@ -46,7 +73,7 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
 	b.WriteString("# HELP pcie_devices_total Number of PCIe devices with link data in sysfs.\n")
 	b.WriteString("# TYPE pcie_devices_total gauge\n")
 	b.WriteString("pcie_devices_total ")
-	b.WriteString(strconv.Itoa(len(devices)))
+	b.WriteString(strconv.Itoa(len(links)))
 	b.WriteString("\n")
 
 	b.WriteString("# HELP pcie_link_negotiated_ok Whether negotiated PCIe link speed and width match maximum supported values.\n")
@@ -58,8 +85,11 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
 	b.WriteString("# HELP pcie_link_width_ratio Negotiated link width divided by max supported link width.\n")
 	b.WriteString("# TYPE pcie_link_width_ratio gauge\n")
 
-	for _, device := range devices {
-		labels := metricLabels(device)
+	for _, device := range links {
+		labels := deviceLabels(device)
+		if h.legacyLabels {
+			labels = legacyMetricLabels(device)
+		}
 		okValue := "0"
 		if device.NegotiatedOK {
 			okValue = "1"
@@ -88,6 +118,395 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
 		}
 	}
 
+	b.WriteString("# HELP pcie_device_info Descriptive PCIe device attributes; the value is always 1.\n")
+	b.WriteString("# TYPE pcie_device_info gauge\n")
+	for _, device := range devices {
+		b.WriteString("pcie_device_info")
+		b.WriteString(deviceInfoLabels(device))
+		b.WriteString(" 1\n")
+	}
+
+	b.WriteString("# HELP pcie_device_os_binding_info Kernel device bound to the PCIe function, such as a network interface or NVMe namespace; the value is always 1.\n")
+	b.WriteString("# TYPE pcie_device_os_binding_info gauge\n")
+	for _, device := range devices {
+		for _, binding := range device.OSBindings {
+			b.WriteString("pcie_device_os_binding_info")
+			b.WriteString(`{device="` + escapeLabelValue(device.Address) + `",kind="` + binding.Kind + `",name="` + escapeLabelValue(binding.Name) + `"}`)
+			b.WriteString(" 1\n")
+		}
+	}
+
+	writeSlotIndicator(&b, "pcie_slot_power", "Hotplug power state of the device's physical slot.", devices,
+		func(slot *pcie.Slot) *int { return slot.Power })
+	writeSlotIndicator(&b, "pcie_slot_attention", "Attention indicator of the device's physical slot: 0 off, 1 on, 2 blinking.", devices,
+		func(slot *pcie.Slot) *int { return slot.Attention })
+
+	b.WriteString("# HELP pcie_device_numa_node NUMA node the device is attached to, -1 when it has no affinity.\n")
+	b.WriteString("# TYPE pcie_device_numa_node gauge\n")
+	for _, device := range devices {
+		b.WriteString("pcie_device_numa_node")
+		b.WriteString(`{device="` + escapeLabelValue(device.Address) + `"}`)
+		b.WriteString(" ")
+		b.WriteString(strconv.Itoa(device.NUMA.Node))
+		b.WriteString("\n")
+	}
+
+	rollups := pcie.NUMARollup(devices)
+	b.WriteString("# HELP pcie_numa_node_endpoints Number of non-bridge devices attached to the NUMA node.\n")
+	b.WriteString("# TYPE pcie_numa_node_endpoints gauge\n")
+	for _, rollup := range rollups {
+		b.WriteString("pcie_numa_node_endpoints")
+		b.WriteString(`{numa_node="` + strconv.Itoa(rollup.Node) + `"}`)
+		b.WriteString(" ")
+		b.WriteString(strconv.Itoa(rollup.Endpoints))
+		b.WriteString("\n")
+	}
+	b.WriteString("# HELP pcie_numa_node_endpoint_throughput_bytes Combined theoretical single-direction throughput of the negotiated links of the NUMA node's non-bridge devices in bytes per second.\n")
+	b.WriteString("# TYPE pcie_numa_node_endpoint_throughput_bytes gauge\n")
+	for _, rollup := range rollups {
+		b.WriteString("pcie_numa_node_endpoint_throughput_bytes")
+		b.WriteString(`{numa_node="` + strconv.Itoa(rollup.Node) + `"}`)
+		b.WriteString(" ")
+		b.WriteString(strconv.FormatFloat(rollup.ThroughputGBps*1e9, 'f', 0, 64))
+		b.WriteString("\n")
+	}
+
+	b.WriteString("# HELP pcie_sriov_vfs_enabled Number of SR-IOV virtual functions enabled on the physical function.\n")
+	b.WriteString("# TYPE pcie_sriov_vfs_enabled gauge\n")
+	for _, device := range devices {
+		if device.SRIOV == nil || device.SRIOV.IsVF() {
+			continue
+		}
+		b.WriteString("pcie_sriov_vfs_enabled")
+		b.WriteString(`{device="` + escapeLabelValue(device.Address) + `"}`)
+		b.WriteString(" ")
+		b.WriteString(strconv.Itoa(device.SRIOV.NumVFs))
+		b.WriteString("\n")
+	}
+	b.WriteString("# HELP pcie_sriov_vfs_total Number of SR-IOV virtual functions the physical function supports.\n")
+	b.WriteString("# TYPE pcie_sriov_vfs_total gauge\n")
+	for _, device := range devices {
+		if device.SRIOV == nil || device.SRIOV.IsVF() {
+			continue
+		}
+		b.WriteString("pcie_sriov_vfs_total")
+		b.WriteString(`{device="` + escapeLabelValue(device.Address) + `"}`)
+		b.WriteString(" ")
+		b.WriteString(strconv.Itoa(device.SRIOV.TotalVFs))
+		b.WriteString("\n")
+	}
+
+	b.WriteString("# HELP pcie_sriov_vf_info SR-IOV virtual function and the physical function it belongs to; the value is always 1.\n")
+	b.WriteString("# TYPE pcie_sriov_vf_info gauge\n")
+	for _, device := range devices {
+		if !device.SRIOV.IsVF() {
+			continue
+		}
+		b.WriteString("pcie_sriov_vf_info")
+		b.WriteString(`{device="` + escapeLabelValue(device.Address) + `",physfn="` + escapeLabelValue(device.SRIOV.PhysFn) + `"}`)
+		b.WriteString(" 1\n")
+	}
+
+	b.WriteString("# HELP pcie_link_expectation_info Policy rule that sets the link a device is judged against; the value is always 1.\n")
+	b.WriteString("# TYPE pcie_link_expectation_info gauge\n")
+	for _, device := range links {
+		if device.Expectation == nil {
+			continue
+		}
+		ignored := "false"
+		if device.Expectation.Ignore {
+			ignored = "true"
+		}
+		b.WriteString("pcie_link_expectation_info{")
+		b.WriteString(`device="` + escapeLabelValue(device.Address) + `",`)
+		b.WriteString(`rule="` + escapeLabelValue(device.Expectation.Rule) + `",`)
+		b.WriteString(`expected_speed="` + escapeLabelValue(device.Expectation.Speed) + `",`)
+		b.WriteString(`expected_width="` + escapeLabelValue(device.Expectation.Width) + `",`)
+		b.WriteString(`ignored="` + ignored + `"`)
+		b.WriteString("} 1\n")
+	}
+
+	writeLinkGauge(&b, "pcie_link_speed_gts", "Negotiated link speed in GT/s.", links,
+		func(device pcie.Device) (float64, bool) { return pcie.ParseLinkSpeed(device.CurrentLinkSpeed) })
+	writeLinkGauge(&b, "pcie_link_max_speed_gts", "Maximum supported link speed in GT/s.", links,
+		func(device pcie.Device) (float64, bool) { return pcie.ParseLinkSpeed(device.MaxLinkSpeed) })
+	writeLinkGauge(&b, "pcie_link_width_lanes", "Negotiated link width in lanes.", links,
+		func(device pcie.Device) (float64, bool) {
+			lanes, ok := pcie.ParseLinkWidth(device.CurrentLinkWidth)
+			return float64(lanes), ok
+		})
+	writeLinkGauge(&b, "pcie_link_max_width_lanes", "Maximum supported link width in lanes.", links,
+		func(device pcie.Device) (float64, bool) {
+			lanes, ok := pcie.ParseLinkWidth(device.MaxLinkWidth)
+			return float64(lanes), ok
+		})
+
+	writeLinkGauge(&b, "pcie_link_theoretical_throughput_bytes", "Theoretical single-direction throughput of the negotiated link in bytes per second.", links,
+		func(device pcie.Device) (float64, bool) {
+			throughput, ok := pcie.LinkThroughputGBps(device.CurrentLinkSpeed, device.CurrentLinkWidth)
+			return throughput * 1e9, ok
+		})
+	writeLinkGauge(&b, "pcie_link_max_theoretical_throughput_bytes", "Theoretical single-direction throughput of the maximum supported link in bytes per second.", links,
+		func(device pcie.Device) (float64, bool) {
+			throughput, ok := pcie.LinkThroughputGBps(device.MaxLinkSpeed, device.MaxLinkWidth)
+			return throughput * 1e9, ok
+		})
+
+	b.WriteString("# HELP pcie_link_degradation_reason Why the negotiated link is below the device maximum; the series for the current reason is 1.\n")
+	b.WriteString("# TYPE pcie_link_degradation_reason gauge\n")
+	for _, device := range links {
+		for _, reason := range pcie.DegradationReasons {
+			value := "0"
+			if device.DegradationReason == reason {
+				value = "1"
+			}
+			b.WriteString("pcie_link_degradation_reason")
+			b.WriteString(`{device="` + escapeLabelValue(device.Address) + `",reason="` + reason + `"}`)
+			b.WriteString(" ")
+			b.WriteString(value)
+			b.WriteString("\n")
+		}
+	}
+
+	b.WriteString("# HELP pcie_path_effective_throughput_bytes Lowest theoretical single-direction throughput in bytes per second across the links from the device to its root port.\n")
+	b.WriteString("# TYPE pcie_path_effective_throughput_bytes gauge\n")
+	for _, device := range links {
+		if device.Path == nil {
+			continue
+		}
+		b.WriteString("pcie_path_effective_throughput_bytes")
+		b.WriteString(`{device="` + escapeLabelValue(device.Address) + `",limiting_device="` + escapeLabelValue(device.Path.LimitingDevice) + `"}`)
+		b.WriteString(" ")
+		b.WriteString(strconv.FormatFloat(device.Path.ThroughputGBps*1e9, 'f', 0, 64))
+		b.WriteString("\n")
+	}
+
+	b.WriteString("# HELP pcie_path_min_speed_gts Lowest negotiated link speed in GT/s across the links from the device to its root port.\n")
+	b.WriteString("# TYPE pcie_path_min_speed_gts gauge\n")
+	for _, device := range links {
+		if device.Path == nil {
+			continue
+		}
+		b.WriteString("pcie_path_min_speed_gts")
+		b.WriteString(deviceLabels(device))
+		b.WriteString(" ")
+		b.WriteString(strconv.FormatFloat(device.Path.MinSpeedGTps, 'f', -1, 64))
+		b.WriteString("\n")
+	}
+
+	b.WriteString("# HELP pcie_path_min_width_lanes Lowest negotiated link width across the links from the device to its root port.\n")
+	b.WriteString("# TYPE pcie_path_min_width_lanes gauge\n")
+	for _, device := range links {
+		if device.Path == nil {
+			continue
+		}
+		b.WriteString("pcie_path_min_width_lanes")
+		b.WriteString(deviceLabels(device))
+		b.WriteString(" ")
+		b.WriteString(strconv.Itoa(device.Path.MinWidth))
+		b.WriteString("\n")
+	}
+
+	writeLinkRegisterFlag(&b, "pcie_link_training", "Whether the Link Training bit is set in the Link Status register.", links,
+		func(registers *pcie.LinkRegisters) bool { return registers.LinkTraining })
+	writeLinkRegisterFlag(&b, "pcie_link_dll_active", "Whether the Data Link Layer Link Active bit is set in the Link Status register.", links,
+		func(registers *pcie.LinkRegisters) bool { return registers.DLLLinkActive })
+	writeLinkRegisterFlag(&b, "pcie_link_bandwidth_management_status", "Whether the Link Bandwidth Management Status bit is set in the Link Status register.", links,
+		func(registers *pcie.LinkRegisters) bool { return registers.BandwidthManagementStatus })
+	writeLinkRegisterFlag(&b, "pcie_link_autonomous_bandwidth_status", "Whether the Link Autonomous Bandwidth Status bit is set in the Link Status register.", links,
+		func(registers *pcie.LinkRegisters) bool { return registers.AutonomousBandwidthStatus })
+
+	b.WriteString("# HELP pcie_link_aspm_enabled Whether the ASPM state is enabled on the device's link, from <bdf>/link/.\n")
+	b.WriteString("# TYPE pcie_link_aspm_enabled gauge\n")
+	for _, device := range links {
+		for _, control := range device.Power.LinkControls {
+			state, ok := control.ASPMState()
+			if !ok {
+				continue
+			}
+			b.WriteString("pcie_link_aspm_enabled")
+			b.WriteString(`{device="` + escapeLabelValue(device.Address) + `",state="` + escapeLabelValue(state) + `"}`)
+			b.WriteString(" ")
+			b.WriteString(strconv.Itoa(boolToInt(control.Enabled)))
+			b.WriteString("\n")
+		}
+	}
+	b.WriteString("# HELP pcie_link_clkpm_enabled Whether clock power management is enabled on the device's link.\n")
+	b.WriteString("# TYPE pcie_link_clkpm_enabled gauge\n")
+	for _, device := range links {
+		for _, control := range device.Power.LinkControls {
+			if control.Name != "clkpm" {
+				continue
+			}
+			b.WriteString("pcie_link_clkpm_enabled")
+			b.WriteString(deviceLabels(device))
+			b.WriteString(" ")
+			b.WriteString(strconv.Itoa(boolToInt(control.Enabled)))
+			b.WriteString("\n")
+		}
+	}
+	if len(snapshot.ASPMPolicy.Available) > 0 {
+		b.WriteString("# HELP pcie_aspm_policy System-wide ASPM policy of the pcie_aspm module; the series for the active policy is 1.\n")
+		b.WriteString("# TYPE pcie_aspm_policy gauge\n")
+		for _, available := range snapshot.ASPMPolicy.Available {
+			b.WriteString("pcie_aspm_policy")
+			b.WriteString(`{policy="` + escapeLabelValue(available) + `"}`)
+			b.WriteString(" ")
+			b.WriteString(strconv.Itoa(boolToInt(available == snapshot.ASPMPolicy.Current)))
+			b.WriteString("\n")
+		}
+	}
+
+	writeDeviceControlGauge(&b, "pcie_device_max_payload_supported_bytes", "Largest Max Payload Size the device supports in bytes.", links,
+		func(control *pcie.DeviceControl) (int, bool) { return control.MaxPayloadSupported, true })
+	writeDeviceControlGauge(&b, "pcie_device_max_payload_bytes", "Configured Max Payload Size in bytes.", links,
+		func(control *pcie.DeviceControl) (int, bool) { return control.MaxPayload, true })
+	writeDeviceControlGauge(&b, "pcie_device_max_read_request_bytes", "Configured Max Read Request Size in bytes.", links,
+		func(control *pcie.DeviceControl) (int, bool) { return control.MaxReadRequest, true })
+	writeDeviceControlGauge(&b, "pcie_device_path_max_payload_supported_bytes", "Largest Max Payload Size supported by every device from this one up to its root port in bytes.", links,
+		func(control *pcie.DeviceControl) (int, bool) {
+			return control.PathMaxPayloadSupported, control.PathMaxPayloadSupported > 0
+		})
+	writeDeviceControlGauge(&b, "pcie_device_max_payload_below_path", "Whether the configured Max Payload Size is below what every device on the path to the root port supports.", links,
+		func(control *pcie.DeviceControl) (int, bool) {
+			return boolToInt(control.MaxPayloadBelowPath()), control.PathMaxPayloadSupported > 0
+		})
+	writeDeviceControlGauge(&b, "pcie_device_relaxed_ordering_enabled", "Whether Relaxed Ordering is enabled in the Device Control register.", links,
+		func(control *pcie.DeviceControl) (int, bool) { return boolToInt(control.RelaxedOrdering), true })
+	writeDeviceControlGauge(&b, "pcie_device_extended_tags_enabled", "Whether 8-bit Extended Tags are enabled in the Device Control register.", links,
+		func(control *pcie.DeviceControl) (int, bool) { return boolToInt(control.ExtendedTags), true })
+	writeDeviceControlGauge(&b, "pcie_device_no_snoop_enabled", "Whether No Snoop is enabled in the Device Control register.", links,
+		func(control *pcie.DeviceControl) (int, bool) { return boolToInt(control.NoSnoop), true })
+	writeDeviceControlGauge(&b, "pcie_device_10bit_tags_enabled", "Whether 10-Bit Tag Requester is enabled in the Device Control 2 register.", links,
+		func(control *pcie.DeviceControl) (int, bool) { return boolToInt(control.TenBitTags), control.Control2 })
+	writeDeviceControlGauge(&b, "pcie_device_ltr_enabled", "Whether Latency Tolerance Reporting is enabled in the Device Control 2 register.", links,
+		func(control *pcie.DeviceControl) (int, bool) { return boolToInt(control.LTR), control.Control2 })
+	writeDeviceControlGauge(&b, "pcie_device_obff_enabled", "Whether Optimized Buffer Flush/Fill is enabled in the Device Control 2 register.", links,
+		func(control *pcie.DeviceControl) (int, bool) { return boolToInt(control.OBFF), control.Control2 })
+
+	writeAERMetric(&b, "pcie_aer_correctable_errors_total", "Correctable AER errors reported by the device, by error type.", "error", devices,
+		func(device pcie.Device) []pcie.AERCounter { return device.AER.Correctable })
+	writeAERMetric(&b, "pcie_aer_nonfatal_errors_total", "Uncorrectable non-fatal AER errors reported by the device, by error type.", "error", devices,
+		func(device pcie.Device) []pcie.AERCounter { return device.AER.NonFatal })
+	writeAERMetric(&b, "pcie_aer_fatal_errors_total", "Uncorrectable fatal AER errors reported by the device, by error type.", "error", devices,
+		func(device pcie.Device) []pcie.AERCounter { return device.AER.Fatal })
+	writeAERMetric(&b, "pcie_aer_rootport_errors_total", "AER error messages received by the root port, by severity.", "severity", devices,
+		func(device pcie.Device) []pcie.AERCounter { return device.AER.RootPort })
+
+	writeDPCGauge(&b, "pcie_dpc_enabled", "Whether Downstream Port Containment triggers on uncorrectable errors at the port.", devices,
+		func(dpc *pcie.DPCStatus) (int, bool) { return boolToInt(dpc.Enabled), true })
+	writeDPCGauge(&b, "pcie_dpc_triggered", "Whether Downstream Port Containment has triggered and taken the port's link down.", devices,
+		func(dpc *pcie.DPCStatus) (int, bool) { return boolToInt(dpc.Triggered), true })
+	b.WriteString("# HELP pcie_dpc_trigger_reason Why Downstream Port Containment triggered; the series for the current reason is 1, all are 0 while not triggered.\n")
+	b.WriteString("# TYPE pcie_dpc_trigger_reason gauge\n")
+	for _, device := range devices {
+		if device.DPC == nil {
+			continue
+		}
+		for _, reason := range pcie.DPCReasons {
+			b.WriteString("pcie_dpc_trigger_reason")
+			b.WriteString(`{device="` + escapeLabelValue(device.Address) + `",reason="` + reason + `"}`)
+			b.WriteString(" ")
+			b.WriteString(strconv.Itoa(boolToInt(device.DPC.Reason == reason)))
+			b.WriteString("\n")
+		}
+	}
+	b.WriteString("# HELP pcie_dpc_error_source_info Requester whose ERR_FATAL or ERR_NONFATAL message triggered Downstream Port Containment; the value is always 1.\n")
+	b.WriteString("# TYPE pcie_dpc_error_source_info gauge\n")
+	for _, device := range devices {
+		if device.DPC == nil || device.DPC.SourceID == "" {
+			continue
+		}
+		b.WriteString("pcie_dpc_error_source_info")
+		b.WriteString(`{device="` + escapeLabelValue(device.Address) + `",source="` + escapeLabelValue(device.DPC.SourceID) + `"}`)
+		b.WriteString(" 1\n")
+	}
+	writeDPCGauge(&b, "pcie_dpc_rp_busy", "Whether the root port is still busy with DPC recovery.", devices,
+		func(dpc *pcie.DPCStatus) (int, bool) { return boolToInt(dpc.RPBusy), dpc.RPExtensions })
+	writeDPCGauge(&b, "pcie_dpc_rp_pio_status", "Root Port PIO Status register; non-zero when an RP PIO error is logged.", devices,
+		func(dpc *pcie.DPCStatus) (int, bool) { return int(dpc.RPPIOStatus), dpc.RPExtensions })
+
+	writeSlotStatusGauge(&b, "pcie_slot_presence_detected", "Whether the port's slot detects a card present.", devices,
+		func(status *pcie.SlotStatus) bool { return status.PresenceDetected })
+	writeSlotStatusGauge(&b, "pcie_slot_presence_detect_changed", "Whether the port's slot has latched a presence detect change.", devices,
+		func(status *pcie.SlotStatus) bool { return status.PresenceDetectChanged })
+	writeSlotStatusGauge(&b, "pcie_slot_dll_state_changed", "Whether the port's slot has latched a Data Link Layer state change.", devices,
+		func(status *pcie.SlotStatus) bool { return status.DataLinkLayerStateChanged })
+	writeSlotStatusGauge(&b, "pcie_slot_power_fault_detected", "Whether the port's slot has detected a power fault.", devices,
+		func(status *pcie.SlotStatus) bool { return status.PowerFaultDetected })
+	writeSlotStatusGauge(&b, "pcie_slot_mrl_sensor_changed", "Whether the port's slot has latched a manual retention latch sensor change.", devices,
+		func(status *pcie.SlotStatus) bool { return status.MRLSensorChanged })
+	writeSlotStatusGauge(&b, "pcie_slot_attention_button_pressed", "Whether the attention button of the port's slot has been pressed.", devices,
+		func(status *pcie.SlotStatus) bool { return status.AttentionButtonPressed })
+
+	if snapshot.Conformance != nil {
+		writeConformanceMetrics(&b, snapshot.Conformance)
+	}
+
+	if snapshot.Topology != nil {
+		b.WriteString("# HELP pcie_topology_gpu_nic_pairs Number of GPU and NIC pairs by the PCIe path between them, as in nvidia-smi topo -m.\n")
+		b.WriteString("# TYPE pcie_topology_gpu_nic_pairs gauge\n")
+		for _, pair := range snapshot.GPUNICPairs {
+			b.WriteString("pcie_topology_gpu_nic_pairs")
+			b.WriteString(`{relationship="` + string(pair.Relationship) + `"}`)
+			b.WriteString(" ")
+			b.WriteString(strconv.Itoa(pair.Count))
+			b.WriteString("\n")
+		}
+	}
+
+	b.WriteString("# HELP pcie_device_read_errors_total Total number of failed sysfs reads per device and file.\n")
+	b.WriteString("# TYPE pcie_device_read_errors_total counter\n")
+	for _, readErr := range snapshot.ReadErrors {
+		// Errors without a device, such as the slots directory, are not
+		// subject to the device filter.
+		if readErr.Device != "" && !snapshot.Exports(readErr.Device) {
+			continue
+		}
+		b.WriteString("pcie_device_read_errors_total")
+		b.WriteString(`{device="` + escapeLabelValue(readErr.Device) + `",file="` + escapeLabelValue(readErr.File) + `"}`)
+		b.WriteString(" ")
+		b.WriteString(strconv.FormatUint(readErr.Count, 10))
+		b.WriteString("\n")
+	}
+
+	if h.watcher != nil {
+		b.WriteString("# HELP pcie_link_transitions_total Total number of link transitions seen by the link watcher, by kind.\n")
+		b.WriteString("# TYPE pcie_link_transitions_total counter\n")
+		for _, transition := range h.watcher.TransitionCounts() {
+			if !snapshot.Exports(transition.Device) {
+				continue
+			}
+			b.WriteString("pcie_link_transitions_total")
+			b.WriteString(`{device="` + escapeLabelValue(transition.Device) + `",kind="` + transition.Kind + `"}`)
+			b.WriteString(" ")
+			b.WriteString(strconv.FormatUint(transition.Count, 10))
+			b.WriteString("\n")
+		}
+		var bootLinks []BootLink
+		for _, bootLink := range h.watcher.BootLinks() {
+			if snapshot.Exports(bootLink.Device) {
+				bootLinks = append(bootLinks, bootLink)
+			}
+		}
+		writeBootLinkMetrics(&b, bootLinks, links)
+	}
+
+	if h.kernelLog != nil {
+		b.WriteString("# HELP pcie_kernel_events_total Total number of PCIe error and link messages in the kernel log, by type and severity.\n")
+		b.WriteString("# TYPE pcie_kernel_events_total counter\n")
+		for _, event := range h.kernelLog.EventCounts() {
+			if !snapshot.Exports(event.Device) {
+				continue
+			}
+			b.WriteString("pcie_kernel_events_total")
+			b.WriteString(`{device="` + escapeLabelValue(event.Device) + `",type="` + event.Type + `",severity="` + event.Severity + `"}`)
+			b.WriteString(" ")
+			b.WriteString(strconv.FormatUint(event.Count, 10))
+			b.WriteString("\n")
+		}
+	}
+
 	b.WriteString("# HELP pcie_exporter_scrapes_total Total number of metrics scrapes.\n")
 	b.WriteString("# TYPE pcie_exporter_scrapes_total counter\n")
 	b.WriteString("pcie_exporter_scrapes_total ")
@@ -100,10 +519,16 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
 	b.WriteString(strconv.FormatUint(h.scrapeErrs.Load(), 10))
 	b.WriteString("\n")
 
-	b.WriteString("# HELP pcie_exporter_last_scrape_duration_seconds Duration of the most recent scrape in seconds.\n")
+	b.WriteString("# HELP pcie_exporter_last_scrape_duration_seconds Duration of the sysfs collection behind the served snapshot in seconds.\n")
 	b.WriteString("# TYPE pcie_exporter_last_scrape_duration_seconds gauge\n")
 	b.WriteString("pcie_exporter_last_scrape_duration_seconds ")
-	b.WriteString(fmt.Sprintf("%.6f", scrapeDuration))
+	b.WriteString(fmt.Sprintf("%.6f", snapshot.Duration.Seconds()))
+	b.WriteString("\n")
+
+	b.WriteString("# HELP pcie_exporter_snapshot_age_seconds Age of the served snapshot in seconds.\n")
+	b.WriteString("# TYPE pcie_exporter_snapshot_age_seconds gauge\n")
+	b.WriteString("pcie_exporter_snapshot_age_seconds ")
+	b.WriteString(fmt.Sprintf("%.6f", time.Since(snapshot.CollectedAt).Seconds()))
 	b.WriteString("\n")
 
 	b.WriteString("# HELP pcie_exporter_last_scrape_success Whether the most recent scrape succeeded.\n")
@@ -112,6 +537,12 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
 	b.WriteString(strconv.Itoa(scrapeSuccess))
 	b.WriteString("\n")
 
+	b.WriteString("# HELP pcie_exporter_last_scrape_partial Whether the most recent scrape skipped devices because of read errors.\n")
+	b.WriteString("# TYPE pcie_exporter_last_scrape_partial gauge\n")
+	b.WriteString("pcie_exporter_last_scrape_partial ")
+	b.WriteString(strconv.Itoa(scrapePartial))
+	b.WriteString("\n")
+
 	if err != nil {
 		b.WriteString("# pcie_exporter_error ")
 		b.WriteString(escapeLabelValue(err.Error()))
@@ -121,7 +552,290 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
 	_, _ = w.Write([]byte(b.String()))
 }
 
-func metricLabels(device pcie.Device) string {
+func writeConformanceMetrics(b *strings.Builder, result *baseline.Result) {
+	conformant := "0"
+	if result.Conformant() {
+		conformant = "1"
+	}
+	b.WriteString("# HELP pcie_topology_conformant Whether the PCIe topology matches the configured baseline.\n")
+	b.WriteString("# TYPE pcie_topology_conformant gauge\n")
+	b.WriteString("pcie_topology_conformant ")
+	b.WriteString(conformant)
+	b.WriteString("\n")
+
+	b.WriteString("# HELP pcie_topology_expected_devices Number of devices in the configured baseline.\n")
+	b.WriteString("# TYPE pcie_topology_expected_devices gauge\n")
+	b.WriteString("pcie_topology_expected_devices ")
+	b.WriteString(strconv.Itoa(result.Expected))
+	b.WriteString("\n")
+
+	b.WriteString("# HELP pcie_topology_missing_devices Number of baseline devices not present.\n")
+	b.WriteString("# TYPE pcie_topology_missing_devices gauge\n")
+	b.WriteString("pcie_topology_missing_devices ")
+	b.WriteString(strconv.Itoa(len(result.Missing)))
+	b.WriteString("\n")
+
+	b.WriteString("# HELP pcie_topology_unexpected_devices Number of present devices not in the baseline.\n")
+	b.WriteString("# TYPE pcie_topology_unexpected_devices gauge\n")
+	b.WriteString("pcie_topology_unexpected_devices ")
+	b.WriteString(strconv.Itoa(len(result.Unexpected)))
+	b.WriteString("\n")
+
+	b.WriteString("# HELP pcie_topology_device_missing Baseline device that is not present; the value is always 1.\n")
+	b.WriteString("# TYPE pcie_topology_device_missing gauge\n")
+	for _, missing := range result.Missing {
+		b.WriteString("pcie_topology_device_missing{")
+		b.WriteString(`device="` + escapeLabelValue(missing.BusID) + `",`)
+		b.WriteString(`parent="` + escapeLabelValue(missing.Parent) + `",`)
+		b.WriteString(`vendor_id="` + escapeLabelValue(missing.VendorID) + `",`)
+		b.WriteString(`device_id="` + escapeLabelValue(missing.DeviceID) + `",`)
+		b.WriteString(`class="` + escapeLabelValue(missing.Class) + `",`)
+		b.WriteString(`name="` + escapeLabelValue(missing.Name) + `"`)
+		b.WriteString("} 1\n")
+	}
+
+	b.WriteString("# HELP pcie_topology_device_unexpected Present device that is not in the baseline; the value is always 1.\n")
+	b.WriteString("# TYPE pcie_topology_device_unexpected gauge\n")
+	for _, busID := range result.Unexpected {
+		b.WriteString("pcie_topology_device_unexpected")
+		b.WriteString(`{device="` + escapeLabelValue(busID) + `"}`)
+		b.WriteString(" 1\n")
+	}
+
+	b.WriteString("# HELP pcie_topology_device_mismatch Baseline device that is present but differs in one field; the value is always 1.\n")
+	b.WriteString("# TYPE pcie_topology_device_mismatch gauge\n")
+	for _, mismatch := range result.Mismatches {
+		b.WriteString("pcie_topology_device_mismatch{")
+		b.WriteString(`device="` + escapeLabelValue(mismatch.BusID) + `",`)
+		b.WriteString(`field="` + mismatch.Field + `",`)
+		b.WriteString(`expected="` + escapeLabelValue(mismatch.Expected) + `",`)
+		b.WriteString(`actual="` + escapeLabelValue(mismatch.Actual) + `"`)
+		b.WriteString("} 1\n")
+	}
+}
+
+// writeBootLinkMetrics reports the first link seen this boot and whether the
+// current link is worse. The comparison is only made for devices in the
+// snapshot, so a removed device does not show as degraded.
+func writeBootLinkMetrics(b *strings.Builder, bootLinks []BootLink, devices []pcie.Device) {
+	current := make(map[string]pcie.LinkState, len(devices))
+	for _, device := range devices {
+		current[device.Address] = pcie.LinkState{CurrentSpeed: device.CurrentLinkSpeed, CurrentWidth: device.CurrentLinkWidth}
+	}
+
+	b.WriteString("# HELP pcie_link_boot_speed_gts Link speed in GT/s when the device was first seen this boot.\n")
+	b.WriteString("# TYPE pcie_link_boot_speed_gts gauge\n")
+	for _, bootLink := range bootLinks {
+		speed, ok := pcie.ParseLinkSpeed(bootLink.CurrentSpeed)
+		if !ok {
+			continue
+		}
+		b.WriteString("pcie_link_boot_speed_gts")
+		b.WriteString(`{device="` + escapeLabelValue(bootLink.Device) + `"}`)
+		b.WriteString(" ")
+		b.WriteString(strconv.FormatFloat(speed, 'f', -1, 64))
+		b.WriteString("\n")
+	}
+
+	b.WriteString("# HELP pcie_link_boot_width_lanes Link width in lanes when the device was first seen this boot.\n")
+	b.WriteString("# TYPE pcie_link_boot_width_lanes gauge\n")
+	for _, bootLink := range bootLinks {
+		lanes, ok := pcie.ParseLinkWidth(bootLink.CurrentWidth)
+		if !ok {
+			continue
+		}
+		b.WriteString("pcie_link_boot_width_lanes")
+		b.WriteString(`{device="` + escapeLabelValue(bootLink.Device) + `"}`)
+		b.WriteString(" ")
+		b.WriteString(strconv.Itoa(lanes))
+		b.WriteString("\n")
+	}
+
+	b.WriteString("# HELP pcie_link_degraded_since_boot Whether the negotiated link is slower or narrower than when the device was first seen this boot.\n")
+	b.WriteString("# TYPE pcie_link_degraded_since_boot gauge\n")
+	for _, bootLink := range bootLinks {
+		link, ok := current[bootLink.Device]
+		if !ok {
+			continue
+		}
+		value := "0"
+		if link.Below(bootLink.LinkState) {
+			value = "1"
+		}
+		b.WriteString("pcie_link_degraded_since_boot")
+		b.WriteString(`{device="` + escapeLabelValue(bootLink.Device) + `"}`)
+		b.WriteString(" ")
+		b.WriteString(value)
+		b.WriteString("\n")
+	}
+}
+
+// linkDevices leaves out SR-IOV virtual functions, which share their physical
+// function's link, for the link and path metrics.
+func linkDevices(devices []pcie.Device) []pcie.Device {
+	links := make([]pcie.Device, 0, len(devices))
+	for _, device := range devices {
+		if !device.SRIOV.IsVF() {
+			links = append(links, device)
+		}
+	}
+	return links
+}
+
+// writeSlotIndicator emits a slot indicator gauge for devices whose slot
+// driver exposes it.
+func writeSlotIndicator(b *strings.Builder, name, help string, devices []pcie.Device, value func(*pcie.Slot) *int) {
+	b.WriteString("# HELP " + name + " " + help + "\n")
+	b.WriteString("# TYPE " + name + " gauge\n")
+	for _, device := range devices {
+		if device.PhysicalSlot == nil {
+			continue
+		}
+		indicator := value(device.PhysicalSlot)
+		if indicator == nil {
+			continue
+		}
+		b.WriteString(name)
+		b.WriteString(`{device="` + escapeLabelValue(device.Address) + `",slot="` + escapeLabelValue(device.Slot) + `"}`)
+		b.WriteString(" ")
+		b.WriteString(strconv.Itoa(*indicator))
+		b.WriteString("\n")
+	}
+}
+
+func writeDeviceControlGauge(b *strings.Builder, name, help string, devices []pcie.Device, value func(*pcie.DeviceControl) (int, bool)) {
+	b.WriteString("# HELP " + name + " " + help + "\n")
+	b.WriteString("# TYPE " + name + " gauge\n")
+	for _, device := range devices {
+		if device.DeviceControl == nil {
+			continue
+		}
+		v, ok := value(device.DeviceControl)
+		if !ok {
+			continue
+		}
+		b.WriteString(name)
+		b.WriteString(deviceLabels(device))
+		b.WriteString(" ")
+		b.WriteString(strconv.Itoa(v))
+		b.WriteString("\n")
+	}
+}
+
+func writeDPCGauge(b *strings.Builder, name, help string, devices []pcie.Device, value func(*pcie.DPCStatus) (int, bool)) {
+	b.WriteString("# HELP " + name + " " + help + "\n")
+	b.WriteString("# TYPE " + name + " gauge\n")
+	for _, device := range devices {
+		if device.DPC == nil {
+			continue
+		}
+		v, ok := value(device.DPC)
+		if !ok {
+			continue
+		}
+		b.WriteString(name)
+		b.WriteString(deviceLabels(device))
+		b.WriteString(" ")
+		b.WriteString(strconv.Itoa(v))
+		b.WriteString("\n")
+	}
+}
+
+func writeSlotStatusGauge(b *strings.Builder, name, help string, devices []pcie.Device, flag func(*pcie.SlotStatus) bool) {
+	b.WriteString("# HELP " + name + " " + help + "\n")
+	b.WriteString("# TYPE " + name + " gauge\n")
+	for _, device := range devices {
+		if device.SlotStatus == nil {
+			continue
+		}
+		b.WriteString(name)
+		b.WriteString(deviceLabels(device))
+		b.WriteString(" ")
+		b.WriteString(strconv.Itoa(boolToInt(flag(device.SlotStatus))))
+		b.WriteString("\n")
+	}
+}
+
+// writeLinkRegisterFlag emits a 0/1 gauge for devices whose config space was
+// readable; devices without decoded registers are omitted rather than reported as 0.
+func writeLinkRegisterFlag(b *strings.Builder, name, help string, devices []pcie.Device, flag func(*pcie.LinkRegisters) bool) {
+	b.WriteString("# HELP " + name + " " + help + "\n")
+	b.WriteString("# TYPE " + name + " gauge\n")
+	for _, device := range devices {
+		if device.LinkRegisters == nil {
+			continue
+		}
+		value := "0"
+		if flag(device.LinkRegisters) {
+			value = "1"
+		}
+		b.WriteString(name)
+		b.WriteString(deviceLabels(device))
+		b.WriteString(" ")
+		b.WriteString(value)
+		b.WriteString("\n")
+	}
+}
+
+func writeAERMetric(b *strings.Builder, name, help, labelName string, devices []pcie.Device, counters func(pcie.Device) []pcie.AERCounter) {
+	b.WriteString("# HELP " + name + " " + help + "\n")
+	b.WriteString("# TYPE " + name + " counter\n")
+	for _, device := range devices {
+		for _, counter := range counters(device) {
+			b.WriteString(name)
+			b.WriteString(`{device="` + escapeLabelValue(device.Address) + `",` + labelName + `="` + escapeLabelValue(counter.Name) + `"}`)
+			b.WriteString(" ")
+			b.WriteString(strconv.FormatUint(counter.Value, 10))
+			b.WriteString("\n")
+		}
+	}
+}
+
+// writeLinkGauge emits one gauge per device, skipping devices whose value cannot be parsed.
+func writeLinkGauge(b *strings.Builder, name, help string, devices []pcie.Device, value func(pcie.Device) (float64, bool)) {
+	b.WriteString("# HELP " + name + " " + help + "\n")
+	b.WriteString("# TYPE " + name + " gauge\n")
+	for _, device := range devices {
+		v, ok := value(device)
+		if !ok {
+			continue
+		}
+		b.WriteString(name)
+		b.WriteString(deviceLabels(device))
+		b.WriteString(" ")
+		b.WriteString(strconv.FormatFloat(v, 'f', -1, 64))
+		b.WriteString("\n")
+	}
+}
+
+// deviceLabels identifies a device by its address only, which does not change
+// when the link retrains.
+func deviceLabels(device pcie.Device) string {
+	return `{device="` + escapeLabelValue(device.Address) + `"}`
+}
+
+func deviceInfoLabels(device pcie.Device) string {
+	return "{" +
+		`device="` + escapeLabelValue(device.Address) + `",` +
+		`vendor_id="` + escapeLabelValue(device.VendorID) + `",` +
+		`device_id="` + escapeLabelValue(device.DeviceID) + `",` +
+		`class="` + escapeLabelValue(device.Class) + `",` +
+		`subsystem_vendor_id="` + escapeLabelValue(device.SubsystemVendorID) + `",` +
+		`subsystem_device_id="` + escapeLabelValue(device.SubsystemDeviceID) + `",` +
+		`slot="` + escapeLabelValue(device.Slot) + `",` +
+		`local_cpulist="` + escapeLabelValue(device.NUMA.LocalCPUList) + `",` +
+		`vendor_name="` + escapeLabelValue(device.Names.VendorName) + `",` +
+		`device_name="` + escapeLabelValue(device.Names.DeviceName) + `",` +
+		`subsystem_name="` + escapeLabelValue(device.Names.SubsystemName) + `",` +
+		`class_name="` + escapeLabelValue(device.Names.ClassName) + `",` +
+		`subclass_name="` + escapeLabelValue(device.Names.SubclassName) + `",` +
+		`prog_if_name="` + escapeLabelValue(device.Names.ProgIfName) + `",` +
+		`max_link_speed="` + escapeLabelValue(device.MaxLinkSpeed) + `",` +
+		`max_link_width="` + escapeLabelValue(device.MaxLinkWidth) + `"` +
+		"}"
+}
+
+func legacyMetricLabels(device pcie.Device) string {
 	return "{" +
 		`device="` + escapeLabelValue(device.Address) + `",` +
 		`vendor_id="` + escapeLabelValue(device.VendorID) + `",` +
@@ -142,3 +856,10 @@ func escapeLabelValue(value string) string {
 	)
 	return replacer.Replace(value)
 }
+
+func boolToInt(value bool) int {
+	if value {
+		return 1
+	}
+	return 0
+}
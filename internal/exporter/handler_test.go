@@ -1,19 +1,28 @@
 package exporter
 
 import (
+	"encoding/binary"
 	"net/http"
 	"net/http/httptest"
+	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/gogunit/gunit/hammy"
+	"github.com/nfisher/pcie-exporter/internal/baseline"
+	"github.com/nfisher/pcie-exporter/internal/pcie"
+	"github.com/nfisher/pcie-exporter/internal/pciids"
+	"github.com/nfisher/pcie-exporter/internal/policy"
 )
 
 func TestHandlerServesMetrics(t *testing.T) {
 	h := hammy.New(t)
 
 	sysfsRoot := filepath.Join("..", "pcie", "testdata", "sysfs")
-	handler := NewHandler(sysfsRoot)
+	pciIDs, err := pciids.Open(filepath.Join("..", "pciids", "testdata", "pci.ids"))
+	h.Is(hammy.NilError(err))
+	handler := NewHandler(NewCollector(sysfsRoot, Options{PCIIDs: pciIDs}), HandlerOptions{})
 
 	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
 	resp := httptest.NewRecorder()
@@ -26,5 +35,267 @@ func TestHandlerServesMetrics(t *testing.T) {
 	h.Is(hammy.String(body).Contains("pcie_devices_total 2"))
 	h.Is(hammy.String(body).Contains("pcie_link_negotiated_ok{device=\"0000:01:00.0\""))
 	h.Is(hammy.String(body).Contains("pcie_link_negotiated_ok{device=\"0000:02:00.0\""))
+	h.Is(hammy.String(body).Contains(`pcie_link_negotiated_ok{device="0000:02:00.0"} 0`))
+	h.Is(hammy.String(body).Contains(`pcie_device_info{device="0000:02:00.0",vendor_id="0x8086",device_id="0x1234",class="0x020000",subsystem_vendor_id="",subsystem_device_id="",slot="4",local_cpulist="32-63,96-127",vendor_name="Intel Corporation",device_name="Example Ethernet Controller",subsystem_name="",class_name="Network controller",subclass_name="Ethernet controller",prog_if_name="",max_link_speed="16 GT/s PCIe",max_link_width="16"} 1`))
+	h.Is(hammy.String(body).Contains(`pcie_device_numa_node{device="0000:02:00.0"} 1`))
+	h.Is(hammy.String(body).Contains(`pcie_numa_node_endpoints{numa_node="1"} 1`))
+	h.Is(hammy.String(body).Contains(`pcie_numa_node_endpoint_throughput_bytes{numa_node="1"} 7876920000`))
+	h.Is(hammy.String(body).Contains(`pcie_device_os_binding_info{device="0000:02:00.0",kind="net",name="eth2"} 1`))
+	h.Is(hammy.String(body).Contains(`pcie_slot_power{device="0000:02:00.0",slot="4"} 1`))
+	h.Is(hammy.String(body).Contains(`pcie_slot_attention{device="0000:02:00.0",slot="4"} 0`))
+	h.Is(hammy.String(body).Contains(`pcie_sriov_vfs_enabled{device="0000:02:00.0"} 0`))
+	h.Is(hammy.String(body).Contains(`pcie_sriov_vfs_total{device="0000:02:00.0"} 8`))
+	h.Is(hammy.False(strings.Contains(body, `pcie_sriov_vfs_total{device="0000:01:00.0"}`)))
+	h.Is(hammy.String(body).Contains(`pcie_link_speed_gts{device="0000:02:00.0"} 8`))
+	h.Is(hammy.String(body).Contains(`pcie_link_max_speed_gts{device="0000:02:00.0"} 16`))
+	h.Is(hammy.String(body).Contains(`pcie_link_width_lanes{device="0000:02:00.0"} 8`))
+	h.Is(hammy.String(body).Contains(`pcie_link_max_width_lanes{device="0000:02:00.0"} 16`))
+	h.Is(hammy.String(body).Contains(`pcie_link_theoretical_throughput_bytes{device="0000:02:00.0"} 7876920000`))
+	h.Is(hammy.String(body).Contains(`pcie_link_max_theoretical_throughput_bytes{device="0000:02:00.0"} 31507696000`))
+	h.Is(hammy.String(body).Contains(`pcie_link_degradation_reason{device="0000:01:00.0",reason="none"} 1`))
+	h.Is(hammy.String(body).Contains(`pcie_link_degradation_reason{device="0000:02:00.0",reason="mistrained_width"} 1`))
+	h.Is(hammy.String(body).Contains(`pcie_link_degradation_reason{device="0000:02:00.0",reason="none"} 0`))
+	h.Is(hammy.String(body).Contains(`pcie_path_effective_throughput_bytes{device="0000:02:00.0",limiting_device="0000:02:00.0"} 7876920000`))
+	h.Is(hammy.String(body).Contains(`pcie_link_aspm_enabled{device="0000:02:00.0",state="l0s"} 0`))
+	h.Is(hammy.String(body).Contains(`pcie_link_aspm_enabled{device="0000:02:00.0",state="l1"} 1`))
+	h.Is(hammy.String(body).Contains(`pcie_link_clkpm_enabled{device="0000:02:00.0"} 0`))
+	h.Is(hammy.String(body).Contains(`pcie_aspm_policy{policy="performance"} 1`))
+	h.Is(hammy.String(body).Contains(`pcie_aspm_policy{policy="default"} 0`))
+	h.Is(hammy.String(body).Contains(`pcie_device_max_payload_supported_bytes{device="0000:01:00.0"} 256`))
+	h.Is(hammy.String(body).Contains(`pcie_device_max_payload_bytes{device="0000:01:00.0"} 128`))
+	h.Is(hammy.String(body).Contains(`pcie_device_max_read_request_bytes{device="0000:01:00.0"} 512`))
+	// Fixture devices sit directly on the root bus, so the path is the device alone.
+	h.Is(hammy.String(body).Contains(`pcie_device_path_max_payload_supported_bytes{device="0000:01:00.0"} 256`))
+	h.Is(hammy.String(body).Contains(`pcie_device_max_payload_below_path{device="0000:01:00.0"} 1`))
+	h.Is(hammy.String(body).Contains(`pcie_device_relaxed_ordering_enabled{device="0000:01:00.0"} 1`))
+	h.Is(hammy.String(body).Contains(`pcie_device_ltr_enabled{device="0000:01:00.0"} 1`))
+	h.Is(hammy.String(body).Contains(`pcie_device_10bit_tags_enabled{device="0000:01:00.0"} 0`))
+	h.Is(hammy.False(strings.Contains(body, `pcie_device_max_payload_bytes{device="0000:02:00.0"}`)))
+	h.Is(hammy.String(body).Contains(`pcie_aer_correctable_errors_total{device="0000:01:00.0",error="BadTLP"} 3`))
+	h.Is(hammy.String(body).Contains(`pcie_aer_nonfatal_errors_total{device="0000:01:00.0",error="CmpltTO"} 2`))
+	h.Is(hammy.String(body).Contains(`pcie_topology_gpu_nic_pairs{relationship="NODE"} 1`))
+	h.Is(hammy.String(body).Contains(`pcie_topology_gpu_nic_pairs{relationship="SYS"} 1`))
 	h.Is(hammy.String(body).Contains("pcie_exporter_last_scrape_success 1"))
+	h.Is(hammy.String(body).Contains("pcie_exporter_snapshot_age_seconds "))
+}
+
+func TestHandlerReportsTopologyConformance(t *testing.T) {
+	h := hammy.New(t)
+
+	sysfsRoot := filepath.Join("..", "pcie", "testdata", "sysfs")
+	expected := &baseline.Baseline{Version: baseline.FormatVersion, Devices: []baseline.Device{
+		{BusID: "0000:01:00.0", VendorID: "0x10de", DeviceID: "0x2235", Class: "0x030000", LinkSpeed: "16 GT/s PCIe", LinkWidth: "16"},
+		{BusID: "0000:02:00.0", VendorID: "0x8086", DeviceID: "0x1234", Class: "0x020000", LinkSpeed: "8 GT/s PCIe", LinkWidth: "16"},
+		{BusID: "0000:05:00.0", VendorID: "0x10de", DeviceID: "0x2331", Class: "0x030200", Name: "GH100 [H100 PCIe]"},
+	}}
+	handler := NewHandler(NewCollector(sysfsRoot, Options{Baseline: expected}), HandlerOptions{})
+
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	resp := httptest.NewRecorder()
+	handler.ServeHTTP(resp, req)
+
+	body := resp.Body.String()
+	h.Is(hammy.String(body).Contains("pcie_topology_conformant 0"))
+	h.Is(hammy.String(body).Contains("pcie_topology_expected_devices 3"))
+	h.Is(hammy.String(body).Contains("pcie_topology_missing_devices 1"))
+	h.Is(hammy.String(body).Contains(`pcie_topology_device_missing{device="0000:05:00.0",parent="",vendor_id="0x10de",device_id="0x2331",class="0x030200",name="GH100 [H100 PCIe]"} 1`))
+	h.Is(hammy.String(body).Contains(`pcie_topology_device_unexpected{device="0000:03:00.0"} 1`))
+	h.Is(hammy.String(body).Contains(`pcie_topology_device_mismatch{device="0000:02:00.0",field="link_width",expected="16",actual="8"} 1`))
+}
+
+func TestHandlerReportsLinkExpectations(t *testing.T) {
+	h := hammy.New(t)
+
+	sysfsRoot := filepath.Join("..", "pcie", "testdata", "sysfs")
+	linkPolicy := &policy.Policy{Rules: []policy.Rule{
+		{Name: "capped-nic", Match: policy.Match{VendorID: "8086", DeviceID: "1234"}, ExpectedSpeed: "8 GT/s", ExpectedWidth: 8},
+	}}
+	handler := NewHandler(NewCollector(sysfsRoot, Options{Policy: linkPolicy}), HandlerOptions{})
+
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	resp := httptest.NewRecorder()
+	handler.ServeHTTP(resp, req)
+
+	body := resp.Body.String()
+	h.Is(hammy.String(body).Contains(`pcie_link_expectation_info{device="0000:02:00.0",rule="capped-nic",expected_speed="8 GT/s",expected_width="8",ignored="false"} 1`))
+	h.Is(hammy.String(body).Contains(`pcie_link_negotiated_ok{device="0000:02:00.0"} 1`))
+	h.Is(hammy.String(body).Contains(`pcie_link_degradation_reason{device="0000:02:00.0",reason="none"} 1`))
+	h.Is(hammy.String(body).Contains(`pcie_link_max_width_lanes{device="0000:02:00.0"} 16`))
+}
+
+func TestHandlerLegacyLabels(t *testing.T) {
+	h := hammy.New(t)
+
+	sysfsRoot := filepath.Join("..", "pcie", "testdata", "sysfs")
+	handler := NewHandler(NewCollector(sysfsRoot, Options{}), HandlerOptions{LegacyLabels: true})
+
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	resp := httptest.NewRecorder()
+	handler.ServeHTTP(resp, req)
+
+	body := resp.Body.String()
+	h.Is(hammy.String(body).Contains(`pcie_link_negotiated_ok{device="0000:02:00.0",vendor_id="0x8086",device_id="0x1234",class="0x020000",current_link_speed="8 GT/s PCIe",max_link_speed="16 GT/s PCIe",current_link_width="8",max_link_width="16"} 0`))
+	h.Is(hammy.String(body).Contains(`pcie_link_speed_gts{device="0000:02:00.0"} 8`))
+}
+
+func TestHandlerReportsDeviceReadErrors(t *testing.T) {
+	h := hammy.New(t)
+
+	sysfsRoot := t.TempDir()
+	devicePath := filepath.Join(sysfsRoot, "bus", "pci", "devices", "0000:01:00.0")
+	h.Is(hammy.NilError(os.MkdirAll(filepath.Join(devicePath, "max_link_width"), 0o755)))
+
+	handler := NewHandler(NewCollector(sysfsRoot, Options{}), HandlerOptions{})
+	for range 2 {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	}
+	resp := httptest.NewRecorder()
+	handler.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	body := resp.Body.String()
+	h.Is(hammy.String(body).Contains(`pcie_device_read_errors_total{device="0000:01:00.0",file="max_link_width"} 3`))
+	h.Is(hammy.String(body).Contains("pcie_exporter_last_scrape_partial 1"))
+	h.Is(hammy.String(body).Contains("pcie_exporter_last_scrape_success 1"))
+}
+
+func TestHandlerReportsUnreadableSlots(t *testing.T) {
+	h := hammy.New(t)
+
+	sysfsRoot := t.TempDir()
+	devicePath := filepath.Join(sysfsRoot, "bus", "pci", "devices", "0000:01:00.0")
+	writeWatchedLink(t, devicePath, "16")
+	h.Is(hammy.NilError(os.WriteFile(filepath.Join(sysfsRoot, "bus", "pci", "slots"), nil, 0o644)))
+
+	filter, err := pcie.NewFilter(nil, []pcie.FilterRule{{ClassPrefix: "02"}})
+	h.Is(hammy.NilError(err))
+	resp := httptest.NewRecorder()
+	NewHandler(NewCollector(sysfsRoot, Options{Filter: filter}), HandlerOptions{}).ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	body := resp.Body.String()
+	h.Is(hammy.String(body).Contains(`pcie_device_read_errors_total{device="",file="slots"} 1`))
+	h.Is(hammy.String(body).Contains(`pcie_link_width_lanes{device="0000:01:00.0"} 16`))
+	h.Is(hammy.String(body).Contains("pcie_exporter_last_scrape_success 1"))
+}
+
+func TestHandlerReportsDownstreamPortContainment(t *testing.T) {
+	h := hammy.New(t)
+
+	// A root port with a slot whose DPC triggered on ERR_FATAL from 01:00.0
+	// and took the link down.
+	config := make([]byte, 4096)
+	binary.LittleEndian.PutUint16(config[0x06:], 0x0010)
+	config[0x34] = 0x40
+	config[0x40] = 0x10
+	binary.LittleEndian.PutUint16(config[0x42:], 0x0002|0x4<<4|0x0100)
+	binary.LittleEndian.PutUint16(config[0x5a:], 0x0108)
+	binary.LittleEndian.PutUint32(config[0x100:], 0x001d|0x1<<16)
+	binary.LittleEndian.PutUint16(config[0x106:], 0x0002)
+	binary.LittleEndian.PutUint16(config[0x108:], 0x0001|2<<1)
+	binary.LittleEndian.PutUint16(config[0x10a:], 0x0100)
+
+	sysfsRoot := t.TempDir()
+	rootPort := filepath.Join(sysfsRoot, "devices", "pci0000:00", "0000:00:01.0")
+	h.Is(hammy.NilError(os.MkdirAll(rootPort, 0o755)))
+	for name, value := range map[string]string{
+		"class":              "0x060400\n",
+		"current_link_speed": "Unknown\n",
+		"current_link_width": "0\n",
+		"max_link_speed":     "16.0 GT/s PCIe\n",
+		"max_link_width":     "16\n",
+		"config":             string(config),
+	} {
+		h.Is(hammy.NilError(os.WriteFile(filepath.Join(rootPort, name), []byte(value), 0o644)))
+	}
+	busDevices := filepath.Join(sysfsRoot, "bus", "pci", "devices")
+	h.Is(hammy.NilError(os.MkdirAll(busDevices, 0o755)))
+	h.Is(hammy.NilError(os.Symlink(rootPort, filepath.Join(busDevices, "0000:00:01.0"))))
+
+	handler := NewHandler(NewCollector(sysfsRoot, Options{}), HandlerOptions{})
+	resp := httptest.NewRecorder()
+	handler.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	body := resp.Body.String()
+	h.Is(hammy.String(body).Contains(`pcie_dpc_enabled{device="0000:00:01.0"} 1`))
+	h.Is(hammy.String(body).Contains(`pcie_dpc_triggered{device="0000:00:01.0"} 1`))
+	h.Is(hammy.String(body).Contains(`pcie_dpc_trigger_reason{device="0000:00:01.0",reason="err_fatal"} 1`))
+	h.Is(hammy.String(body).Contains(`pcie_dpc_trigger_reason{device="0000:00:01.0",reason="err_nonfatal"} 0`))
+	h.Is(hammy.String(body).Contains(`pcie_dpc_error_source_info{device="0000:00:01.0",source="0000:01:00.0"} 1`))
+	h.Is(hammy.False(strings.Contains(body, "pcie_dpc_rp_busy{")))
+	h.Is(hammy.String(body).Contains(`pcie_slot_presence_detected{device="0000:00:01.0"} 0`))
+	h.Is(hammy.String(body).Contains(`pcie_slot_presence_detect_changed{device="0000:00:01.0"} 1`))
+	h.Is(hammy.String(body).Contains(`pcie_slot_dll_state_changed{device="0000:00:01.0"} 1`))
+	h.Is(hammy.String(body).Contains(`pcie_slot_power_fault_detected{device="0000:00:01.0"} 0`))
+}
+
+func TestHandlerFiltersAddressKeyedSeries(t *testing.T) {
+	h := hammy.New(t)
+
+	// The NIC fails to read, so it never appears in the topology and its read
+	// errors cannot be matched against the filter.
+	sysfsRoot := t.TempDir()
+	gpuPath := filepath.Join(sysfsRoot, "bus", "pci", "devices", "0000:01:00.0")
+	nicPath := filepath.Join(sysfsRoot, "bus", "pci", "devices", "0000:02:00.0")
+	writeWatchedLink(t, gpuPath, "16")
+	h.Is(hammy.NilError(os.WriteFile(filepath.Join(gpuPath, "class"), []byte("0x030200\n"), 0o644)))
+	h.Is(hammy.NilError(os.MkdirAll(filepath.Join(nicPath, "max_link_width"), 0o755)))
+
+	filter, err := pcie.NewFilter([]pcie.FilterRule{{ClassPrefix: "0302"}}, nil)
+	h.Is(hammy.NilError(err))
+	rec := httptest.NewRecorder()
+	NewHandler(NewCollector(sysfsRoot, Options{Filter: filter}), HandlerOptions{}).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	body := rec.Body.String()
+	h.Is(hammy.String(body).Contains(`pcie_link_width_lanes{device="0000:01:00.0"} 16`))
+	h.Is(hammy.False(strings.Contains(body, `pcie_device_read_errors_total{device="0000:02:00.0"`)))
+}
+
+func TestHandlerReportsVirtualFunctionsWithoutLinkMetrics(t *testing.T) {
+	h := hammy.New(t)
+
+	sysfsRoot := t.TempDir()
+	pf := filepath.Join(sysfsRoot, "devices", "pci0000:00", "0000:00:01.0", "0000:01:00.0")
+	vf := filepath.Join(sysfsRoot, "devices", "pci0000:00", "0000:00:01.0", "0000:01:00.2")
+	h.Is(hammy.NilError(os.MkdirAll(filepath.Join(pf, "net", "ens1f0"), 0o755)))
+	h.Is(hammy.NilError(os.MkdirAll(filepath.Join(vf, "net", "ens1f0v0"), 0o755)))
+	for name, value := range map[string]string{
+		"class":              "0x020000\n",
+		"current_link_speed": "16.0 GT/s PCIe\n",
+		"current_link_width": "16\n",
+		"max_link_speed":     "16.0 GT/s PCIe\n",
+		"max_link_width":     "16\n",
+		"sriov_totalvfs":     "8\n",
+		"sriov_numvfs":       "1\n",
+	} {
+		h.Is(hammy.NilError(os.WriteFile(filepath.Join(pf, name), []byte(value), 0o644)))
+	}
+	h.Is(hammy.NilError(os.WriteFile(filepath.Join(vf, "class"), []byte("0x020000\n"), 0o644)))
+	// A VF's Device Control fields are mostly reserved and read back as zero.
+	vfConfig := make([]byte, 256)
+	binary.LittleEndian.PutUint16(vfConfig[0x06:], 0x0010)
+	vfConfig[0x34] = 0x40
+	vfConfig[0x40] = 0x10
+	binary.LittleEndian.PutUint16(vfConfig[0x42:], 0x0002)
+	h.Is(hammy.NilError(os.WriteFile(filepath.Join(vf, "config"), vfConfig, 0o644)))
+	h.Is(hammy.NilError(os.Symlink("../0000:01:00.2", filepath.Join(pf, "virtfn0"))))
+	h.Is(hammy.NilError(os.Symlink("../0000:01:00.0", filepath.Join(vf, "physfn"))))
+	busDevices := filepath.Join(sysfsRoot, "bus", "pci", "devices")
+	h.Is(hammy.NilError(os.MkdirAll(busDevices, 0o755)))
+	h.Is(hammy.NilError(os.Symlink(pf, filepath.Join(busDevices, "0000:01:00.0"))))
+	h.Is(hammy.NilError(os.Symlink(vf, filepath.Join(busDevices, "0000:01:00.2"))))
+
+	handler := NewHandler(NewCollector(sysfsRoot, Options{}), HandlerOptions{})
+	resp := httptest.NewRecorder()
+	handler.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	body := resp.Body.String()
+	h.Is(hammy.String(body).Contains("pcie_devices_total 1\n"))
+	h.Is(hammy.String(body).Contains(`pcie_device_info{device="0000:01:00.2"`))
+	h.Is(hammy.String(body).Contains(`pcie_device_os_binding_info{device="0000:01:00.2",kind="net",name="ens1f0v0"} 1`))
+	h.Is(hammy.String(body).Contains(`pcie_sriov_vf_info{device="0000:01:00.2",physfn="0000:01:00.0"} 1`))
+	h.Is(hammy.String(body).Contains(`pcie_link_negotiated_ok{device="0000:01:00.0"} 1`))
+	h.Is(hammy.False(strings.Contains(body, `pcie_link_negotiated_ok{device="0000:01:00.2"}`)))
+	h.Is(hammy.False(strings.Contains(body, `pcie_link_degradation_reason{device="0000:01:00.2"`)))
+	h.Is(hammy.String(body).Contains(`pcie_sriov_vfs_enabled{device="0000:01:00.0"} 1`))
+	h.Is(hammy.False(strings.Contains(body, `pcie_sriov_vfs_enabled{device="0000:01:00.2"}`)))
+	h.Is(hammy.False(strings.Contains(body, `pcie_sriov_vfs_total{device="0000:01:00.2"}`)))
+	h.Is(hammy.False(strings.Contains(body, `pcie_device_max_payload_bytes{device="0000:01:00.2"}`)))
 }
@@ -0,0 +1,151 @@
+package exporter
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"sync"
+	"syscall"
+
+	"github.com/nfisher/pcie-exporter/internal/kmsg"
+	"github.com/nfisher/pcie-exporter/internal/pcie"
+)
+
+// DefaultKernelLogPath is the kernel log device read by KernelLog.
+const DefaultKernelLogPath = "/dev/kmsg"
+
+// kernelLogBufferSize must hold a whole /dev/kmsg record, otherwise read(2)
+// fails with EINVAL.
+const kernelLogBufferSize = 64 * 1024
+
+// KernelEventCount is the running total of one kind of kernel log event for
+// one device.
+type KernelEventCount struct {
+	Device   string
+	Type     string
+	Severity string
+	Count    uint64
+}
+
+// KernelLogOptions configures a KernelLog.
+type KernelLogOptions struct {
+	// Path is the log to read. Empty reads DefaultKernelLogPath.
+	Path string
+	// Replay counts the messages already in the log. Without it reading
+	// starts at the end, so a restart does not count hours-old ring buffer
+	// records again as a burst of new events.
+	Replay bool
+}
+
+// KernelLog counts PCIe error and link messages from the kernel log. It
+// covers kernels whose sysfs has no AER counters, and link changes that
+// happen too quickly for the Watcher to see.
+type KernelLog struct {
+	path   string
+	replay bool
+
+	mu     sync.Mutex
+	counts map[kmsg.Event]uint64
+}
+
+// NewKernelLog returns a KernelLog for opts; call Run to start reading.
+func NewKernelLog(opts KernelLogOptions) *KernelLog {
+	path := opts.Path
+	if path == "" {
+		path = DefaultKernelLogPath
+	}
+	return &KernelLog{path: path, replay: opts.Replay, counts: make(map[kmsg.Event]uint64)}
+}
+
+// Run reads the kernel log until ctx is done. /dev/kmsg blocks for new
+// records; any other file, such as a captured dmesg, is read once and Run
+// returns at its end.
+func (k *KernelLog) Run(ctx context.Context) error {
+	f, err := os.Open(k.path)
+	if err != nil {
+		return fmt.Errorf("open kernel log %s: %w", k.path, err)
+	}
+	if !k.replay {
+		// /dev/kmsg supports SEEK_END, which skips to after the newest record.
+		if _, err := f.Seek(0, io.SeekEnd); err != nil {
+			_ = f.Close()
+			return fmt.Errorf("seek kernel log %s: %w", k.path, err)
+		}
+	}
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-done:
+		}
+		_ = f.Close()
+	}()
+
+	reader := bufio.NewReaderSize(f, kernelLogBufferSize)
+	for {
+		line, err := reader.ReadString('\n')
+		if line != "" {
+			k.Observe(line)
+		}
+		switch {
+		case err == nil:
+		case errors.Is(err, syscall.EPIPE):
+			// Records were overwritten before they were read; the next read
+			// continues with the oldest record still available.
+		case errors.Is(err, io.EOF), ctx.Err() != nil:
+			return nil
+		default:
+			return fmt.Errorf("read kernel log %s: %w", k.path, err)
+		}
+	}
+}
+
+// Observe counts line when it is a PCIe message.
+func (k *KernelLog) Observe(line string) {
+	event, ok := kmsg.Parse(line)
+	if !ok {
+		return
+	}
+	k.mu.Lock()
+	k.counts[event]++
+	k.mu.Unlock()
+}
+
+// CountedAddresses returns every device with a kernel event count.
+func (k *KernelLog) CountedAddresses() []string {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	addresses := make([]string, 0, len(k.counts))
+	for event := range k.counts {
+		addresses = append(addresses, event.Device)
+	}
+	return addresses
+}
+
+// EventCounts returns the cumulative event totals sorted by device, type and
+// severity.
+func (k *KernelLog) EventCounts() []KernelEventCount {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	counts := make([]KernelEventCount, 0, len(k.counts))
+	for event, count := range k.counts {
+		counts = append(counts, KernelEventCount{Device: event.Device, Type: event.Type, Severity: event.Severity, Count: count})
+	}
+	sort.Slice(counts, func(i, j int) bool {
+		if counts[i].Device != counts[j].Device {
+			return pcie.LessAddress(counts[i].Device, counts[j].Device)
+		}
+		if counts[i].Type != counts[j].Type {
+			return counts[i].Type < counts[j].Type
+		}
+		return counts[i].Severity < counts[j].Severity
+	})
+	return counts
+}
@@ -0,0 +1,111 @@
+package exporter
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/gogunit/gunit/hammy"
+	"github.com/nfisher/pcie-exporter/internal/pcie"
+)
+
+func TestKernelLogCountsCapturedMessages(t *testing.T) {
+	h := hammy.New(t)
+
+	logPath := filepath.Join(t.TempDir(), "kmsg")
+	captured := strings.Join([]string{
+		"3,1021,5432100,-;nvidia 0000:01:00.0: PCIe Bus Error: severity=Corrected, type=Physical Layer, (Receiver ID)",
+		" SUBSYSTEM=pci",
+		" DEVICE=+pci:0000:01:00.0",
+		"4,1022,5432101,-;nvidia 0000:01:00.0:   device [10de:2235] error status/mask=00000001/0000a000",
+		"3,1023,5432102,-;nvidia 0000:01:00.0: PCIe Bus Error: severity=Corrected, type=Physical Layer, (Receiver ID)",
+		"3,1024,5432103,-;pcieport 0000:00:01.0: AER: Multiple Uncorrected (Non-Fatal) error received: 0000:01:00.0",
+		"6,1025,5432104,-;pcieport 0000:00:1c.0: pciehp: Slot(4): Link Down",
+		"6,1026,5432105,-;e1000e: eth0 NIC Link is Down",
+		"",
+	}, "\n")
+	h.Is(hammy.NilError(os.WriteFile(logPath, []byte(captured), 0o644)))
+
+	kernelLog := NewKernelLog(KernelLogOptions{Path: logPath, Replay: true})
+	h.Is(hammy.NilError(kernelLog.Run(context.Background())))
+
+	counts := kernelLog.EventCounts()
+	h.Is(hammy.Number(len(counts)).EqualTo(3))
+	h.Is(hammy.String(counts[0].Device).EqualTo("0000:00:1c.0"))
+	h.Is(hammy.String(counts[0].Type).EqualTo("link_down"))
+	h.Is(hammy.String(counts[1].Type).EqualTo("aer_multiple"))
+	h.Is(hammy.String(counts[1].Severity).EqualTo("nonfatal"))
+	h.Is(hammy.String(counts[2].Type).EqualTo("bus_error"))
+	h.Is(hammy.Number(counts[2].Count).EqualTo(2))
+
+	collector := NewCollector(t.TempDir(), Options{})
+	rec := httptest.NewRecorder()
+	NewHandler(collector, HandlerOptions{KernelLog: kernelLog}).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	body := rec.Body.String()
+	h.Is(hammy.String(body).Contains(`pcie_kernel_events_total{device="0000:01:00.0",type="bus_error",severity="corrected"} 2`))
+	h.Is(hammy.String(body).Contains(`pcie_kernel_events_total{device="0000:01:00.0",type="aer_multiple",severity="nonfatal"} 1`))
+	h.Is(hammy.String(body).Contains(`pcie_kernel_events_total{device="0000:00:1c.0",type="link_down",severity="none"} 1`))
+}
+
+func TestKernelLogStartsAtEndWithoutReplay(t *testing.T) {
+	h := hammy.New(t)
+
+	logPath := filepath.Join(t.TempDir(), "kmsg")
+	old := "3,1021,5432100,-;nvidia 0000:01:00.0: PCIe Bus Error: severity=Corrected, type=Physical Layer, (Receiver ID)\n"
+	h.Is(hammy.NilError(os.WriteFile(logPath, []byte(old), 0o644)))
+
+	kernelLog := NewKernelLog(KernelLogOptions{Path: logPath})
+	h.Is(hammy.NilError(kernelLog.Run(context.Background())))
+	h.Is(hammy.Slice(kernelLog.EventCounts()).IsEmpty())
+}
+
+func TestKernelLogMissingFile(t *testing.T) {
+	h := hammy.New(t)
+
+	kernelLog := NewKernelLog(KernelLogOptions{Path: filepath.Join(t.TempDir(), "missing")})
+	h.Is(hammy.Error(kernelLog.Run(context.Background())))
+}
+
+func TestHandlerOmitsKernelEventsWithoutKernelLog(t *testing.T) {
+	h := hammy.New(t)
+
+	collector := NewCollector(t.TempDir(), Options{})
+	rec := httptest.NewRecorder()
+	NewHandler(collector, HandlerOptions{}).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	h.Is(hammy.False(strings.Contains(rec.Body.String(), "pcie_kernel_events_total")))
+}
+
+func TestHandlerFiltersKernelEvents(t *testing.T) {
+	h := hammy.New(t)
+
+	filter, err := pcie.NewFilter([]pcie.FilterRule{{ClassPrefix: "0300"}}, nil)
+	h.Is(hammy.NilError(err))
+	collector := NewCollector(filepath.Join("..", "pcie", "testdata", "sysfs"), Options{Filter: filter})
+	kernelLog := NewKernelLog(KernelLogOptions{})
+	kernelLog.Observe("nvidia 0000:01:00.0: PCIe Bus Error: severity=Corrected, type=Physical Layer, (Receiver ID)")
+	kernelLog.Observe("mlx5_core 0000:02:00.0: PCIe Bus Error: severity=Corrected, type=Physical Layer, (Receiver ID)")
+
+	rec := httptest.NewRecorder()
+	NewHandler(collector, HandlerOptions{KernelLog: kernelLog}).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	body := rec.Body.String()
+	h.Is(hammy.String(body).Contains(`pcie_kernel_events_total{device="0000:01:00.0"`))
+	h.Is(hammy.False(strings.Contains(body, `pcie_kernel_events_total{device="0000:02:00.0"`)))
+}
+
+func TestKernelLogCountedAddresses(t *testing.T) {
+	h := hammy.New(t)
+
+	kernelLog := NewKernelLog(KernelLogOptions{})
+	kernelLog.Observe("mlx5_core 0000:02:00.0: PCIe Bus Error: severity=Corrected, type=Physical Layer, (Receiver ID)")
+	kernelLog.Observe("pcieport 0000:00:1c.0: pciehp: Slot(4): Link Down")
+	kernelLog.Observe("pcieport 0000:00:1c.0: pciehp: Slot(4): Link Up")
+
+	addresses := kernelLog.CountedAddresses()
+	sort.Strings(addresses)
+	h.Is(hammy.Slice(addresses).EqualTo("0000:00:1c.0", "0000:00:1c.0", "0000:02:00.0"))
+}
@@ -0,0 +1,39 @@
+package exporter
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// TopologyHandler serves the pairwise device topology matrix, as JSON by
+// default or as an nvidia-smi style table with ?format=text.
+type TopologyHandler struct {
+	collector *Collector
+}
+
+func NewTopologyHandler(collector *Collector) *TopologyHandler {
+	return &TopologyHandler{collector: collector}
+}
+
+func (h *TopologyHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	snapshot := h.collector.Snapshot()
+	if snapshot.Err != nil {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.WriteHeader(http.StatusInternalServerError)
+		_ = json.NewEncoder(w).Encode(map[string]string{
+			"error": snapshot.Err.Error(),
+		})
+		return
+	}
+
+	if r.URL.Query().Get("format") == "text" {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		_ = snapshot.Topology.WriteText(w)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(snapshot.Topology)
+}
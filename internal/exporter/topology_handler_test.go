@@ -0,0 +1,34 @@
+package exporter
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gogunit/gunit/hammy"
+)
+
+func TestTopologyHandlerServesMatrix(t *testing.T) {
+	h := hammy.New(t)
+
+	sysfsRoot := filepath.Join("..", "pcie", "testdata", "sysfs")
+	handler := NewTopologyHandler(NewCollector(sysfsRoot, Options{MaxStaleness: time.Hour}))
+
+	resp := httptest.NewRecorder()
+	handler.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/pcie-topology-matrix", nil))
+
+	h.Is(hammy.Number(resp.Code).EqualTo(http.StatusOK))
+	h.Is(hammy.String(resp.Header().Get("Content-Type")).Contains("application/json"))
+	body := resp.Body.String()
+	h.Is(hammy.String(body).Contains(`{"label":"GPU0","bus_id":"0000:01:00.0"`))
+	h.Is(hammy.String(body).Contains(`{"label":"NIC1","bus_id":"0000:03:00.0"`))
+	h.Is(hammy.String(body).Contains(`"matrix":[["X","SYS","NODE"]`))
+
+	resp = httptest.NewRecorder()
+	handler.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/pcie-topology-matrix?format=text", nil))
+
+	h.Is(hammy.String(resp.Header().Get("Content-Type")).Contains("text/plain"))
+	h.Is(hammy.String(resp.Body.String()).Contains("GPU0  X     SYS   NODE"))
+}
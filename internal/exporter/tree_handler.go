@@ -3,31 +3,39 @@ package exporter
 import (
 	"encoding/json"
 	"net/http"
-
-	"github.com/nfisher/pcie-exporter/internal/pcie"
 )
 
+// ASPMPolicyHeader carries the system ASPM policy on /pcie-tree responses.
+// The policy is not in the body, which stays the plain list of nodes that
+// existing consumers decode.
+const ASPMPolicyHeader = "X-PCIe-ASPM-Policy"
+
 // TreeHandler serves PCIe topology in JSON format.
 type TreeHandler struct {
-	sysfsRoot string
+	collector *Collector
 }
 
-func NewTreeHandler(sysfsRoot string) *TreeHandler {
-	return &TreeHandler{sysfsRoot: sysfsRoot}
+func NewTreeHandler(collector *Collector) *TreeHandler {
+	return &TreeHandler{collector: collector}
 }
 
 func (h *TreeHandler) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
-	tree, err := pcie.ReadTree(h.sysfsRoot)
-	if err != nil {
+	// Per-device errors are reported on the affected nodes, so only a failure
+	// to list devices at all is treated as a server error.
+	snapshot := h.collector.Snapshot()
+	if snapshot.Err != nil {
 		w.Header().Set("Content-Type", "application/json; charset=utf-8")
 		w.WriteHeader(http.StatusInternalServerError)
 		_ = json.NewEncoder(w).Encode(map[string]string{
-			"error": err.Error(),
+			"error": snapshot.Err.Error(),
 		})
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	if snapshot.ASPMPolicy.Current != "" {
+		w.Header().Set(ASPMPolicyHeader, snapshot.ASPMPolicy.Current)
+	}
 	w.WriteHeader(http.StatusOK)
-	_ = json.NewEncoder(w).Encode(tree)
+	_ = json.NewEncoder(w).Encode(snapshot.Tree)
 }
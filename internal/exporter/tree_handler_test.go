@@ -3,17 +3,21 @@ package exporter
 import (
 	"net/http"
 	"net/http/httptest"
+	"os"
 	"path/filepath"
 	"testing"
 
 	"github.com/gogunit/gunit/hammy"
+	"github.com/nfisher/pcie-exporter/internal/pciids"
 )
 
 func TestTreeHandlerServesJSONTree(t *testing.T) {
 	h := hammy.New(t)
 
 	sysfsRoot := filepath.Join("..", "pcie", "testdata", "sysfs")
-	handler := NewTreeHandler(sysfsRoot)
+	pciIDs, err := pciids.Open(filepath.Join("..", "pciids", "testdata", "pci.ids"))
+	h.Is(hammy.NilError(err))
+	handler := NewTreeHandler(NewCollector(sysfsRoot, Options{PCIIDs: pciIDs}))
 
 	req := httptest.NewRequest(http.MethodGet, "/pcie-tree", nil)
 	resp := httptest.NewRecorder()
@@ -21,9 +25,33 @@ func TestTreeHandlerServesJSONTree(t *testing.T) {
 
 	h.Is(hammy.Number(resp.Code).EqualTo(http.StatusOK))
 	h.Is(hammy.String(resp.Header().Get("Content-Type")).Contains("application/json"))
+	h.Is(hammy.String(resp.Header().Get(ASPMPolicyHeader)).EqualTo("performance"))
 
 	body := resp.Body.String()
 	h.Is(hammy.String(body).Contains(`"bus_id":"0000:01:00.0"`))
 	h.Is(hammy.String(body).Contains(`"link_capacity":"16 GT/s PCIe x16"`))
 	h.Is(hammy.String(body).Contains(`"link_status":"8 GT/s PCIe x8"`))
+	h.Is(hammy.String(body).Contains(`"name":"GA102GL [A40]"`))
+	h.Is(hammy.String(body).Contains(`"vendor_name":"NVIDIA Corporation"`))
+	h.Is(hammy.String(body).Contains(`"class_name":"Display controller"`))
+	h.Is(hammy.String(body).Contains(`"numa_node":1,"local_cpulist":"32-63,96-127"`))
+	h.Is(hammy.String(body).Contains(`"sriov":{"total_vfs":8}`))
+	h.Is(hammy.String(body).Contains(`"slot":"4","physical_slot":{"name":"4","source":"bus","power":1,"attention":0,"max_bus_speed":"16.0 GT/s PCIe","cur_bus_speed":"8.0 GT/s PCIe"}`))
+	h.Is(hammy.String(body).Contains(`"os_bindings":[{"kind":"net","name":"eth2"}]`))
+	h.Is(hammy.String(body).Contains(`"link_controls":[{"name":"l0s_aspm","enabled":false},{"name":"l1_aspm","enabled":true},{"name":"clkpm","enabled":false}]`))
+}
+
+func TestTreeHandlerMarksFailedNodes(t *testing.T) {
+	h := hammy.New(t)
+
+	sysfsRoot := t.TempDir()
+	devicePath := filepath.Join(sysfsRoot, "bus", "pci", "devices", "0000:01:00.0")
+	h.Is(hammy.NilError(os.MkdirAll(filepath.Join(devicePath, "label"), 0o755)))
+
+	resp := httptest.NewRecorder()
+	NewTreeHandler(NewCollector(sysfsRoot, Options{})).ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/pcie-tree", nil))
+
+	h.Is(hammy.Number(resp.Code).EqualTo(http.StatusOK))
+	h.Is(hammy.String(resp.Body.String()).Contains(`"bus_id":"0000:01:00.0"`))
+	h.Is(hammy.String(resp.Body.String()).Contains(`"error":"read label for 0000:01:00.0: `))
 }
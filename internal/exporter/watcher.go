@@ -0,0 +1,268 @@
+package exporter
+
+import (
+	"context"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/nfisher/pcie-exporter/internal/pcie"
+	"github.com/nfisher/pcie-exporter/internal/state"
+)
+
+// DefaultEventCapacity is the number of link events kept when
+// WatcherOptions.EventCapacity is not positive.
+const DefaultEventCapacity = 1024
+
+// WatcherOptions configures a Watcher.
+type WatcherOptions struct {
+	// EventCapacity is the size of the event ring buffer.
+	EventCapacity int
+	// State persists boot links and transition counts across restarts. Nil
+	// keeps them in memory only, so "boot" means exporter start.
+	State *state.Store
+}
+
+// BootLink is the first link state the Watcher saw for a device during the
+// current boot.
+type BootLink struct {
+	Device string
+	pcie.LinkState
+	SeenAt time.Time
+}
+
+// Event is one link transition observed by the Watcher.
+type Event struct {
+	Time   time.Time `json:"time"`
+	Device string    `json:"device"`
+	Kind   string    `json:"kind"`
+	From   string    `json:"from,omitempty"`
+	To     string    `json:"to,omitempty"`
+}
+
+// TransitionCount is the running total of one kind of transition for one device.
+type TransitionCount struct {
+	Device string
+	Kind   string
+	Count  uint64
+}
+
+type transitionKey struct {
+	device string
+	kind   string
+}
+
+// Watcher polls negotiated link state far more often than metrics are
+// scraped so that a link which retrains and recovers between scrapes is
+// still recorded. The most recent events are kept in a ring buffer and every
+// transition is counted.
+type Watcher struct {
+	sysfsRoot string
+	store     *state.Store
+
+	mu        sync.Mutex
+	prev      map[string]pcie.LinkState
+	events    []Event
+	next      int
+	full      bool
+	counts    map[transitionKey]uint64
+	bootLinks map[string]BootLink
+}
+
+// NewWatcher restores boot links and transition counts from opts.State when
+// it is set. It only fails when an existing state file cannot be read.
+func NewWatcher(sysfsRoot string, opts WatcherOptions) (*Watcher, error) {
+	capacity := opts.EventCapacity
+	if capacity <= 0 {
+		capacity = DefaultEventCapacity
+	}
+	w := &Watcher{
+		sysfsRoot: sysfsRoot,
+		store:     opts.State,
+		events:    make([]Event, capacity),
+		counts:    make(map[transitionKey]uint64),
+		bootLinks: make(map[string]BootLink),
+	}
+	if w.store == nil {
+		return w, nil
+	}
+
+	saved, err := w.store.Load()
+	if err != nil {
+		return nil, err
+	}
+	for address, device := range saved.Devices {
+		if device.BootLink != nil {
+			w.bootLinks[address] = BootLink{
+				Device:    address,
+				LinkState: pcie.LinkState{CurrentSpeed: device.BootLink.Speed, CurrentWidth: device.BootLink.Width},
+				SeenAt:    device.BootLink.SeenAt,
+			}
+		}
+		for kind, count := range device.Transitions {
+			w.counts[transitionKey{device: address, kind: kind}] = count
+		}
+	}
+	return w, nil
+}
+
+// Run polls every interval until ctx is done.
+func (w *Watcher) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	if err := w.Poll(time.Now()); err != nil {
+		log.Printf("link watcher: %v", err)
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := w.Poll(time.Now()); err != nil {
+				log.Printf("link watcher: %v", err)
+			}
+		}
+	}
+}
+
+// Poll reads the current link state and records any transitions since the
+// previous poll. The first poll only establishes the baseline. A device that
+// fails to read keeps its previous state so a transient error is not
+// reported as a removal. When anything new was recorded the state file is
+// rewritten.
+func (w *Watcher) Poll(now time.Time) error {
+	states, deviceErrs, err := pcie.ReadLinkStates(w.sysfsRoot)
+	if err != nil {
+		return err
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for _, deviceErr := range deviceErrs {
+		if before, ok := w.prev[deviceErr.Address]; ok {
+			states[deviceErr.Address] = before
+		}
+	}
+	changed := false
+	for address, link := range states {
+		if _, ok := w.bootLinks[address]; !ok {
+			w.bootLinks[address] = BootLink{Device: address, LinkState: link, SeenAt: now}
+			changed = true
+		}
+	}
+	if w.prev != nil {
+		for _, transition := range pcie.DiffLinkStates(w.prev, states) {
+			changed = true
+			w.record(Event{
+				Time:   now,
+				Device: transition.Address,
+				Kind:   transition.Kind,
+				From:   transition.From,
+				To:     transition.To,
+			})
+		}
+	}
+	w.prev = states
+
+	if w.store == nil || !changed {
+		return nil
+	}
+	return w.store.Save(w.stateLocked(now))
+}
+
+// stateLocked must be called with w.mu held.
+func (w *Watcher) stateLocked(now time.Time) state.State {
+	saved := state.State{UpdatedAt: now, Devices: make(map[string]state.DeviceState)}
+	for address, bootLink := range w.bootLinks {
+		saved.Devices[address] = state.DeviceState{BootLink: &state.Link{
+			Speed:  bootLink.CurrentSpeed,
+			Width:  bootLink.CurrentWidth,
+			SeenAt: bootLink.SeenAt,
+		}}
+	}
+	for key, count := range w.counts {
+		device := saved.Devices[key.device]
+		if device.Transitions == nil {
+			device.Transitions = make(map[string]uint64)
+		}
+		device.Transitions[key.kind] = count
+		saved.Devices[key.device] = device
+	}
+	return saved
+}
+
+// record must be called with w.mu held.
+func (w *Watcher) record(event Event) {
+	w.counts[transitionKey{device: event.Device, kind: event.Kind}]++
+	w.events[w.next] = event
+	w.next = (w.next + 1) % len(w.events)
+	if w.next == 0 {
+		w.full = true
+	}
+}
+
+// Events returns the buffered events, oldest first.
+func (w *Watcher) Events() []Event {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if !w.full {
+		return append([]Event{}, w.events[:w.next]...)
+	}
+	events := make([]Event, 0, len(w.events))
+	events = append(events, w.events[w.next:]...)
+	return append(events, w.events[:w.next]...)
+}
+
+// TransitionCounts returns the cumulative transition totals sorted by device
+// and kind. Counts are kept for events that have left the ring buffer.
+func (w *Watcher) TransitionCounts() []TransitionCount {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	counts := make([]TransitionCount, 0, len(w.counts))
+	for key, count := range w.counts {
+		counts = append(counts, TransitionCount{Device: key.device, Kind: key.kind, Count: count})
+	}
+	sort.Slice(counts, func(i, j int) bool {
+		if counts[i].Device != counts[j].Device {
+			return pcie.LessAddress(counts[i].Device, counts[j].Device)
+		}
+		return counts[i].Kind < counts[j].Kind
+	})
+	return counts
+}
+
+// CountedAddresses returns every device with a transition count or boot link.
+func (w *Watcher) CountedAddresses() []string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	var addresses []string
+	for key := range w.counts {
+		addresses = append(addresses, key.device)
+	}
+	for address := range w.bootLinks {
+		addresses = append(addresses, address)
+	}
+	return addresses
+}
+
+// BootLinks returns the first link state seen for each device during the
+// current boot, sorted by device.
+func (w *Watcher) BootLinks() []BootLink {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	bootLinks := make([]BootLink, 0, len(w.bootLinks))
+	for _, bootLink := range w.bootLinks {
+		bootLinks = append(bootLinks, bootLink)
+	}
+	sort.Slice(bootLinks, func(i, j int) bool {
+		return pcie.LessAddress(bootLinks[i].Device, bootLinks[j].Device)
+	})
+	return bootLinks
+}
@@ -0,0 +1,120 @@
+package exporter
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gogunit/gunit/hammy"
+	"github.com/nfisher/pcie-exporter/internal/state"
+)
+
+func TestWatcherRecordsLinkFlap(t *testing.T) {
+	h := hammy.New(t)
+
+	sysfsRoot := t.TempDir()
+	devicePath := filepath.Join(sysfsRoot, "bus", "pci", "devices", "0000:01:00.0")
+	writeWatchedLink(t, devicePath, "16")
+
+	watcher, err := NewWatcher(sysfsRoot, WatcherOptions{EventCapacity: 2})
+	h.Is(hammy.NilError(err))
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	h.Is(hammy.NilError(watcher.Poll(start)))
+	writeWatchedLink(t, devicePath, "8")
+	h.Is(hammy.NilError(watcher.Poll(start.Add(time.Second))))
+	writeWatchedLink(t, devicePath, "16")
+	h.Is(hammy.NilError(watcher.Poll(start.Add(2 * time.Second))))
+	writeWatchedLink(t, devicePath, "8")
+	h.Is(hammy.NilError(watcher.Poll(start.Add(3 * time.Second))))
+
+	events := watcher.Events()
+	h.Is(hammy.Number(len(events)).EqualTo(2))
+	h.Is(hammy.String(events[0].Kind).EqualTo("width_up"))
+	h.Is(hammy.String(events[1].Kind).EqualTo("width_down"))
+	h.Is(hammy.String(events[1].From).EqualTo("32.0 GT/s PCIe x16"))
+	h.Is(hammy.String(events[1].To).EqualTo("32.0 GT/s PCIe x8"))
+	h.Is(hammy.True(events[1].Time.Equal(start.Add(3 * time.Second))))
+
+	counts := watcher.TransitionCounts()
+	h.Is(hammy.Number(len(counts)).EqualTo(2))
+	h.Is(hammy.String(counts[0].Kind).EqualTo("width_down"))
+	h.Is(hammy.Number(counts[0].Count).EqualTo(2))
+
+	collector := NewCollector(sysfsRoot, Options{})
+	rec := httptest.NewRecorder()
+	NewHandler(collector, HandlerOptions{Watcher: watcher}).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	h.Is(hammy.True(strings.Contains(rec.Body.String(), `pcie_link_transitions_total{device="0000:01:00.0",kind="width_down"} 2`)))
+}
+
+func TestWatcherRestoresStateWithinBoot(t *testing.T) {
+	h := hammy.New(t)
+
+	sysfsRoot := t.TempDir()
+	devicePath := filepath.Join(sysfsRoot, "bus", "pci", "devices", "0000:01:00.0")
+	statePath := filepath.Join(t.TempDir(), "state.json")
+	writeWatchedLink(t, devicePath, "16")
+
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	first, err := NewWatcher(sysfsRoot, WatcherOptions{State: state.NewStore(statePath, "boot-a")})
+	h.Is(hammy.NilError(err))
+	h.Is(hammy.NilError(first.Poll(start)))
+	writeWatchedLink(t, devicePath, "8")
+	h.Is(hammy.NilError(first.Poll(start.Add(time.Second))))
+
+	restarted, err := NewWatcher(sysfsRoot, WatcherOptions{State: state.NewStore(statePath, "boot-a")})
+	h.Is(hammy.NilError(err))
+	h.Is(hammy.NilError(restarted.Poll(start.Add(time.Minute))))
+
+	bootLinks := restarted.BootLinks()
+	h.Is(hammy.Number(len(bootLinks)).EqualTo(1))
+	h.Is(hammy.String(bootLinks[0].CurrentWidth).EqualTo("16"))
+	h.Is(hammy.True(bootLinks[0].SeenAt.Equal(start)))
+	h.Is(hammy.Number(len(restarted.TransitionCounts())).EqualTo(1))
+
+	collector := NewCollector(sysfsRoot, Options{})
+	rec := httptest.NewRecorder()
+	NewHandler(collector, HandlerOptions{Watcher: restarted}).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	body := rec.Body.String()
+	h.Is(hammy.True(strings.Contains(body, `pcie_link_boot_width_lanes{device="0000:01:00.0"} 16`)))
+	h.Is(hammy.True(strings.Contains(body, `pcie_link_degraded_since_boot{device="0000:01:00.0"} 1`)))
+	h.Is(hammy.True(strings.Contains(body, `pcie_link_transitions_total{device="0000:01:00.0",kind="width_down"} 1`)))
+
+	rebooted, err := NewWatcher(sysfsRoot, WatcherOptions{State: state.NewStore(statePath, "boot-b")})
+	h.Is(hammy.NilError(err))
+	h.Is(hammy.Number(len(rebooted.BootLinks())).EqualTo(0))
+	h.Is(hammy.Number(len(rebooted.TransitionCounts())).EqualTo(0))
+}
+
+func TestEventsHandlerServesEmptyList(t *testing.T) {
+	h := hammy.New(t)
+
+	watcher, err := NewWatcher(t.TempDir(), WatcherOptions{})
+	h.Is(hammy.NilError(err))
+	rec := httptest.NewRecorder()
+	NewEventsHandler(watcher).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/events", nil))
+
+	var events []Event
+	h.Is(hammy.Number(rec.Code).EqualTo(http.StatusOK))
+	h.Is(hammy.String(strings.TrimSpace(rec.Body.String())).EqualTo("[]"))
+	h.Is(hammy.NilError(json.Unmarshal(rec.Body.Bytes(), &events)))
+}
+
+func writeWatchedLink(t *testing.T, devicePath, width string) {
+	t.Helper()
+	h := hammy.New(t)
+	h.Is(hammy.NilError(os.MkdirAll(devicePath, 0o755)))
+	files := map[string]string{
+		"current_link_speed": "32.0 GT/s PCIe",
+		"max_link_speed":     "32.0 GT/s PCIe",
+		"current_link_width": width,
+		"max_link_width":     "16",
+	}
+	for name, value := range files {
+		h.Is(hammy.NilError(os.WriteFile(filepath.Join(devicePath, name), []byte(value+"\n"), 0o644)))
+	}
+}
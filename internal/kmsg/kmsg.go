@@ -0,0 +1,115 @@
+// Package kmsg recognises PCIe error and link messages in the kernel log and
+// attributes them to PCI addresses. It understands both /dev/kmsg records
+// ("6,1234,5678901,-;message") and dmesg output ("[ 5.678901] message").
+package kmsg
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Event types.
+const (
+	// TypeBusError is a "PCIe Bus Error" report for one device.
+	TypeBusError = "bus_error"
+	// TypeAER is an error message received by a root port.
+	TypeAER = "aer"
+	// TypeAERMultiple is a root port receiving more than one error message
+	// before the first was handled.
+	TypeAERMultiple = "aer_multiple"
+	TypeLinkUp      = "link_up"
+	TypeLinkDown    = "link_down"
+	// TypeDPC is a Downstream Port Containment event.
+	TypeDPC = "dpc"
+)
+
+// Severities. Link and DPC events carry SeverityNone.
+const (
+	SeverityCorrected = "corrected"
+	SeverityNonFatal  = "nonfatal"
+	SeverityFatal     = "fatal"
+	SeverityUnknown   = "unknown"
+	SeverityNone      = "none"
+)
+
+// Event is one PCIe message from the kernel log.
+type Event struct {
+	Device   string
+	Type     string
+	Severity string
+}
+
+var (
+	kmsgHeader  = regexp.MustCompile(`^\d+,\d+,\d+,[^;]*;`)
+	dmesgPrefix = regexp.MustCompile(`^\[\s*\d+\.\d+\]\s*`)
+	address     = regexp.MustCompile(`\b[0-9a-fA-F]{4,8}:[0-9a-fA-F]{2}:[0-9a-fA-F]{2}\.[0-7]\b`)
+
+	busError = regexp.MustCompile(`PCIe Bus Error: severity=([^,]+)`)
+	// Kernels before 5.x logged "error received: id=0100" without an address,
+	// in which case the event is attributed to the reporting root port. Since
+	// 6.7 the severities read "Correctable" and "Uncorrectable" instead of
+	// "Corrected" and "Uncorrected".
+	aerReceived = regexp.MustCompile(`AER: (Multiple )?(Correct(?:ed|able)|Uncorrect(?:ed|able) \((?:Non-)?Fatal\)) error (?:message )?received`)
+	// Only hotplug slot messages count: network drivers also log "Link Down"
+	// next to their PCI address. Older kernels named the pciehp service
+	// device ("pciehp 0000:00:1c.0:pcie004: Slot(4): ...").
+	linkChange = regexp.MustCompile(`\bpciehp\b.*\bSlot\([^)]*\): Link (Up|Down)\b`)
+	dpcEvent   = regexp.MustCompile(`DPC: containment event`)
+)
+
+// Parse returns the PCIe event in line, or false when the line is not a
+// recognised PCIe message or names no PCI address.
+func Parse(line string) (Event, bool) {
+	// Continuation lines of /dev/kmsg records hold KEY=value metadata.
+	if strings.HasPrefix(line, " ") {
+		return Event{}, false
+	}
+	message := strings.TrimSpace(dmesgPrefix.ReplaceAllString(kmsgHeader.ReplaceAllString(line, ""), ""))
+
+	addresses := address.FindAllString(message, -1)
+	if len(addresses) == 0 {
+		return Event{}, false
+	}
+	device := strings.ToLower(addresses[0])
+
+	if m := busError.FindStringSubmatch(message); m != nil {
+		return Event{Device: device, Type: TypeBusError, Severity: severity(m[1])}, true
+	}
+	if m := aerReceived.FindStringSubmatch(message); m != nil {
+		eventType := TypeAER
+		if m[1] != "" {
+			eventType = TypeAERMultiple
+		}
+		// The source follows "received:"; the first address is the root port.
+		source := device
+		if len(addresses) > 1 {
+			source = strings.ToLower(addresses[len(addresses)-1])
+		}
+		return Event{Device: source, Type: eventType, Severity: severity(m[2])}, true
+	}
+	if dpcEvent.MatchString(message) {
+		return Event{Device: device, Type: TypeDPC, Severity: SeverityNone}, true
+	}
+	if m := linkChange.FindStringSubmatch(message); m != nil {
+		eventType := TypeLinkDown
+		if m[1] == "Up" {
+			eventType = TypeLinkUp
+		}
+		return Event{Device: device, Type: eventType, Severity: SeverityNone}, true
+	}
+	return Event{}, false
+}
+
+func severity(value string) string {
+	value = strings.ToLower(strings.TrimSpace(value))
+	switch {
+	case value == "corrected" || value == "correctable":
+		return SeverityCorrected
+	case strings.Contains(value, "non-fatal"):
+		return SeverityNonFatal
+	case strings.Contains(value, "fatal"):
+		return SeverityFatal
+	default:
+		return SeverityUnknown
+	}
+}
@@ -0,0 +1,97 @@
+package kmsg
+
+import (
+	"testing"
+
+	"github.com/gogunit/gunit/hammy"
+)
+
+func TestParse(t *testing.T) {
+	h := hammy.New(t)
+
+	cases := []struct {
+		line string
+		want Event
+	}{
+		{
+			line: "3,1021,5432100,-;nvidia 0000:3B:00.0: PCIe Bus Error: severity=Corrected, type=Physical Layer, (Receiver ID)",
+			want: Event{Device: "0000:3b:00.0", Type: TypeBusError, Severity: SeverityCorrected},
+		},
+		{
+			line: "[ 1234.567890] pcieport 0000:00:01.0: PCIe Bus Error: severity=Uncorrected (Non-Fatal), type=Transaction Layer, (Requester ID)",
+			want: Event{Device: "0000:00:01.0", Type: TypeBusError, Severity: SeverityNonFatal},
+		},
+		{
+			line: "pcieport 0000:00:01.0: PCIe Bus Error: severity=Uncorrected (Fatal), type=Transaction Layer, (Receiver ID)",
+			want: Event{Device: "0000:00:01.0", Type: TypeBusError, Severity: SeverityFatal},
+		},
+		{
+			line: "4,1022,5432101,-;pcieport 0000:00:01.0: AER: Multiple Uncorrected (Non-Fatal) error received: 0000:01:00.0",
+			want: Event{Device: "0000:01:00.0", Type: TypeAERMultiple, Severity: SeverityNonFatal},
+		},
+		{
+			line: "pcieport 0000:00:01.0: AER: Corrected error message received from 0000:01:00.0",
+			want: Event{Device: "0000:01:00.0", Type: TypeAER, Severity: SeverityCorrected},
+		},
+		{
+			line: "pcieport 0000:00:1c.0: AER: Corrected error received: id=00e0",
+			want: Event{Device: "0000:00:1c.0", Type: TypeAER, Severity: SeverityCorrected},
+		},
+		{
+			line: "pcieport 0000:00:01.0: PCIe Bus Error: severity=Correctable, type=Physical Layer, (Receiver ID)",
+			want: Event{Device: "0000:00:01.0", Type: TypeBusError, Severity: SeverityCorrected},
+		},
+		{
+			line: "pcieport 0000:00:01.0: AER: Correctable error message received from 0000:01:00.0",
+			want: Event{Device: "0000:01:00.0", Type: TypeAER, Severity: SeverityCorrected},
+		},
+		{
+			line: "pcieport 0000:00:01.0: AER: Uncorrectable (Non-Fatal) error message received from 0000:01:00.0",
+			want: Event{Device: "0000:01:00.0", Type: TypeAER, Severity: SeverityNonFatal},
+		},
+		{
+			line: "pcieport 0000:00:01.0: AER: Multiple Uncorrectable (Fatal) error message received from 0000:01:00.0",
+			want: Event{Device: "0000:01:00.0", Type: TypeAERMultiple, Severity: SeverityFatal},
+		},
+		{
+			line: "6,1100,6000000,-;pcieport 10000:e0:1a.0: pciehp: Slot(4): Link Down",
+			want: Event{Device: "10000:e0:1a.0", Type: TypeLinkDown, Severity: SeverityNone},
+		},
+		{
+			line: "pcieport 0000:00:01.0: pciehp: Slot(4-1): Link Up",
+			want: Event{Device: "0000:00:01.0", Type: TypeLinkUp, Severity: SeverityNone},
+		},
+		{
+			line: "pciehp 0000:00:1c.0:pcie004: Slot(4): Link Down",
+			want: Event{Device: "0000:00:1c.0", Type: TypeLinkDown, Severity: SeverityNone},
+		},
+		{
+			line: "pcieport 0000:00:01.0: DPC: containment event, status:0x1f01 source:0x0000",
+			want: Event{Device: "0000:00:01.0", Type: TypeDPC, Severity: SeverityNone},
+		},
+	}
+	for _, c := range cases {
+		event, ok := Parse(c.line)
+		h.Is(hammy.True(ok))
+		h.Is(hammy.String(event.Device).EqualTo(c.want.Device))
+		h.Is(hammy.String(event.Type).EqualTo(c.want.Type))
+		h.Is(hammy.String(event.Severity).EqualTo(c.want.Severity))
+	}
+}
+
+func TestParseIgnoresOtherLines(t *testing.T) {
+	h := hammy.New(t)
+
+	for _, line := range []string{
+		"",
+		" SUBSYSTEM=pci",
+		" DEVICE=+pci:0000:01:00.0",
+		"6,1200,7000000,-;e1000e: Link Down",
+		"mlx4_en 0000:03:00.0: ens1: Link Down",
+		"nvidia 0000:01:00.0:   device [10de:2235] error status/mask=00000001/0000a000",
+		"pci 0000:01:00.0: [10de:2235] type 00 class 0x030000",
+	} {
+		_, ok := Parse(line)
+		h.Is(hammy.False(ok))
+	}
+}
@@ -0,0 +1,103 @@
+package pcie
+
+import (
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// AERCounter is one named Advanced Error Reporting counter.
+type AERCounter struct {
+	Name  string
+	Value uint64
+}
+
+// AERStats contains the AER counters the kernel exposes for a device.
+// A nil slice means the corresponding sysfs file is absent, which is the case
+// on kernels older than 4.17 and for devices without the AER capability.
+type AERStats struct {
+	Correctable []AERCounter
+	NonFatal    []AERCounter
+	Fatal       []AERCounter
+	// RootPort holds aer_rootport_total_err_* values keyed by severity name
+	// (correctable, nonfatal, fatal). Only root ports provide these files.
+	RootPort []AERCounter
+}
+
+var aerRootPortFiles = []struct {
+	file     string
+	severity string
+}{
+	{file: "aer_rootport_total_err_cor", severity: "correctable"},
+	{file: "aer_rootport_total_err_nonfatal", severity: "nonfatal"},
+	{file: "aer_rootport_total_err_fatal", severity: "fatal"},
+}
+
+func readAER(devicePath, address string) (AERStats, error) {
+	var stats AERStats
+	var err error
+
+	stats.Correctable, err = readAERCounters(devicePath, address, "aer_dev_correctable")
+	if err != nil {
+		return AERStats{}, err
+	}
+	stats.NonFatal, err = readAERCounters(devicePath, address, "aer_dev_nonfatal")
+	if err != nil {
+		return AERStats{}, err
+	}
+	stats.Fatal, err = readAERCounters(devicePath, address, "aer_dev_fatal")
+	if err != nil {
+		return AERStats{}, err
+	}
+
+	for _, rootPortFile := range aerRootPortFiles {
+		raw, ok, err := readOptionalTrim(filepath.Join(devicePath, rootPortFile.file))
+		if err != nil {
+			return AERStats{}, &DeviceError{Address: address, Op: "read", File: rootPortFile.file, Err: err}
+		}
+		if !ok {
+			continue
+		}
+		value, err := strconv.ParseUint(raw, 10, 64)
+		if err != nil {
+			return AERStats{}, &DeviceError{Address: address, Op: "parse", File: rootPortFile.file, Err: err}
+		}
+		stats.RootPort = append(stats.RootPort, AERCounter{Name: rootPortFile.severity, Value: value})
+	}
+
+	return stats, nil
+}
+
+func readAERCounters(devicePath, address, file string) ([]AERCounter, error) {
+	raw, ok, err := readOptionalTrim(filepath.Join(devicePath, file))
+	if err != nil {
+		return nil, &DeviceError{Address: address, Op: "read", File: file, Err: err}
+	}
+	if !ok {
+		return nil, nil
+	}
+	return parseAERCounters(raw), nil
+}
+
+// parseAERCounters parses the "<name> <count>" lines of an aer_dev_* file.
+// The kernel appends a TOTAL_ERR_* line that is the sum of the named counters;
+// it is dropped so exported series can be summed without double counting.
+// Lines that do not match the expected shape are ignored.
+func parseAERCounters(raw string) []AERCounter {
+	counters := make([]AERCounter, 0, 16)
+	for _, line := range strings.Split(raw, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			continue
+		}
+		if strings.HasPrefix(fields[0], "TOTAL_") {
+			continue
+		}
+		value, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			continue
+		}
+		counters = append(counters, AERCounter{Name: fields[0], Value: value})
+	}
+	return counters
+}
@@ -0,0 +1,51 @@
+package pcie
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/gogunit/gunit/hammy"
+)
+
+func TestReadDevicesIncludesAERCounters(t *testing.T) {
+	h := hammy.New(t)
+
+	devices, _, err := ReadDevices(filepath.Join("testdata", "sysfs"))
+	h.Is(hammy.NilError(err))
+	h.Is(hammy.Number(len(devices)).EqualTo(2))
+
+	gpu := devices[0]
+	h.Is(hammy.Number(len(gpu.AER.Correctable)).EqualTo(8))
+	h.Is(hammy.Slice(gpu.AER.Correctable).Contains(AERCounter{Name: "BadTLP", Value: 3}, AERCounter{Name: "BadDLLP", Value: 1}))
+	h.Is(hammy.Slice(gpu.AER.NonFatal).Contains(AERCounter{Name: "CmpltTO", Value: 2}))
+	h.Is(hammy.Number(len(gpu.AER.Fatal)).EqualTo(18))
+	h.Is(hammy.Slice(gpu.AER.RootPort).IsEmpty())
+
+	nic := devices[1]
+	h.Is(hammy.True(nic.AER.Correctable == nil))
+	h.Is(hammy.True(nic.AER.Fatal == nil))
+}
+
+func TestReadAERRootPortTotals(t *testing.T) {
+	h := hammy.New(t)
+
+	devicePath := t.TempDir()
+	mustWriteFile(t, filepath.Join(devicePath, "aer_rootport_total_err_cor"), "12\n")
+	mustWriteFile(t, filepath.Join(devicePath, "aer_rootport_total_err_nonfatal"), "1\n")
+	mustWriteFile(t, filepath.Join(devicePath, "aer_rootport_total_err_fatal"), "0\n")
+
+	stats, err := readAER(devicePath, "0000:00:01.0")
+	h.Is(hammy.NilError(err))
+	h.Is(hammy.Slice(stats.RootPort).EqualTo(
+		AERCounter{Name: "correctable", Value: 12},
+		AERCounter{Name: "nonfatal", Value: 1},
+		AERCounter{Name: "fatal", Value: 0},
+	))
+}
+
+func TestParseAERCountersSkipsTotalsAndMalformedLines(t *testing.T) {
+	h := hammy.New(t)
+
+	counters := parseAERCounters("RxErr 5\nbogus\nBadTLP x\nTOTAL_ERR_COR 5\n")
+	h.Is(hammy.Slice(counters).EqualTo(AERCounter{Name: "RxErr", Value: 5}))
+}
@@ -0,0 +1,34 @@
+package pcie
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// ASPMPolicy is the system-wide ASPM policy of the pcie_aspm module. Both
+// fields are empty when the kernel is built without ASPM support.
+type ASPMPolicy struct {
+	// Current is the policy in effect, e.g. default or powersupersave.
+	Current   string
+	Available []string
+}
+
+// ReadASPMPolicy reads sysfsRoot/module/pcie_aspm/parameters/policy, which
+// lists every policy with the active one in brackets:
+// "default [performance] powersave powersupersave".
+func ReadASPMPolicy(sysfsRoot string) (ASPMPolicy, error) {
+	path := filepath.Join(sysfsRoot, "module", "pcie_aspm", "parameters", "policy")
+	value, ok, err := readOptionalTrim(path)
+	if err != nil || !ok {
+		return ASPMPolicy{}, err
+	}
+	var policy ASPMPolicy
+	for _, field := range strings.Fields(value) {
+		if strings.HasPrefix(field, "[") && strings.HasSuffix(field, "]") {
+			field = strings.Trim(field, "[]")
+			policy.Current = field
+		}
+		policy.Available = append(policy.Available, field)
+	}
+	return policy, nil
+}
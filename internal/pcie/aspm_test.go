@@ -0,0 +1,38 @@
+package pcie
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/gogunit/gunit/hammy"
+)
+
+func TestReadASPMPolicy(t *testing.T) {
+	h := hammy.New(t)
+
+	sysfsRoot := t.TempDir()
+	policyPath := filepath.Join(sysfsRoot, "module", "pcie_aspm", "parameters")
+	mustMkdirAll(t, policyPath)
+	mustWriteFile(t, filepath.Join(policyPath, "policy"), "default performance [powersupersave] powersave\n")
+
+	policy, err := ReadASPMPolicy(sysfsRoot)
+	h.Is(hammy.NilError(err))
+	h.Is(hammy.String(policy.Current).EqualTo("powersupersave"))
+	h.Is(hammy.Slice(policy.Available).EqualTo("default", "performance", "powersupersave", "powersave"))
+
+	missing, err := ReadASPMPolicy(t.TempDir())
+	h.Is(hammy.NilError(err))
+	h.Is(hammy.String(missing.Current).EqualTo(""))
+	h.Is(hammy.Slice(missing.Available).IsEmpty())
+}
+
+func TestLinkControlASPMState(t *testing.T) {
+	h := hammy.New(t)
+
+	state, ok := LinkControl{Name: "l1_2_aspm"}.ASPMState()
+	h.Is(hammy.True(ok))
+	h.Is(hammy.String(state).EqualTo("l1_2"))
+
+	_, ok = LinkControl{Name: "clkpm"}.ASPMState()
+	h.Is(hammy.False(ok))
+}
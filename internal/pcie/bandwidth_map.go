@@ -1,39 +1,45 @@
 package pcie
 
-import "fmt"
+import (
+	"fmt"
+	"math"
+)
 
-// LaneCounts tracks the standard lane widths we report.
-var LaneCounts = []int{1, 2, 4, 8, 16}
+// LaneCounts tracks the link widths defined by the PCIe specification.
+var LaneCounts = []int{1, 2, 4, 8, 12, 16, 32}
 
 // VersionBandwidth defines theoretical single-direction PCIe throughput.
 // Values account for line encoding only and do not include higher-layer protocol overhead.
 type VersionBandwidth struct {
 	Version          string
 	TransferRateGTps float64
+	Encoding         string
 	ThroughputGBps   map[int]float64
 }
 
 // VersionBandwidthMap contains PCIe generation capabilities used for expected throughput checks.
-// The table is intentionally limited to Gen1-Gen5, which aligns with current target systems.
+// Gen6 and Gen7 use PAM4 signalling and always run in FLIT mode, where each
+// 256-byte FLIT carries 242 bytes of TLP and DLLP payload (the rest is CRC and FEC).
 var VersionBandwidthMap = map[string]VersionBandwidth{
-	"1.0": buildVersionBandwidth("1.0", 2.5, 0.250000),
-	"2.0": buildVersionBandwidth("2.0", 5.0, 0.500000),
-	"3.0": buildVersionBandwidth("3.0", 8.0, 0.984615),
-	"4.0": buildVersionBandwidth("4.0", 16.0, 1.969231),
-	"5.0": buildVersionBandwidth("5.0", 32.0, 3.938462),
+	"1.0": buildVersionBandwidth("1.0", 2.5, "8b/10b", 0.250000),
+	"2.0": buildVersionBandwidth("2.0", 5.0, "8b/10b", 0.500000),
+	"3.0": buildVersionBandwidth("3.0", 8.0, "128b/130b", 0.984615),
+	"4.0": buildVersionBandwidth("4.0", 16.0, "128b/130b", 1.969231),
+	"5.0": buildVersionBandwidth("5.0", 32.0, "128b/130b", 3.938462),
+	"6.0": buildVersionBandwidth("6.0", 64.0, "PAM4 FLIT 242B/256B", 64.0/8*242/256),
+	"7.0": buildVersionBandwidth("7.0", 128.0, "PAM4 FLIT 242B/256B", 128.0/8*242/256),
 }
 
-func buildVersionBandwidth(version string, transferRateGTps, x1GBps float64) VersionBandwidth {
+func buildVersionBandwidth(version string, transferRateGTps float64, encoding string, x1GBps float64) VersionBandwidth {
+	throughput := make(map[int]float64, len(LaneCounts))
+	for _, lanes := range LaneCounts {
+		throughput[lanes] = x1GBps * float64(lanes)
+	}
 	return VersionBandwidth{
 		Version:          version,
 		TransferRateGTps: transferRateGTps,
-		ThroughputGBps: map[int]float64{
-			1:  x1GBps,
-			2:  x1GBps * 2,
-			4:  x1GBps * 4,
-			8:  x1GBps * 8,
-			16: x1GBps * 16,
-		},
+		Encoding:         encoding,
+		ThroughputGBps:   throughput,
 	}
 }
 
@@ -51,3 +57,36 @@ func ThroughputGBps(version string, lanes int) (float64, error) {
 
 	return throughput, nil
 }
+
+// VersionForSpeed maps a sysfs link speed such as "64.0 GT/s PCIe" or
+// "8 GT/s" to its PCIe version. Older kernels omit the decimal and suffix.
+func VersionForSpeed(speed string) (string, bool) {
+	transferRate, ok := parseLeadingFloat(speed)
+	if !ok {
+		return "", false
+	}
+	for version, entry := range VersionBandwidthMap {
+		if math.Abs(entry.TransferRateGTps-transferRate) < 1e-6 {
+			return version, true
+		}
+	}
+	return "", false
+}
+
+// LinkThroughputGBps returns the theoretical throughput of a link described by
+// sysfs speed and width strings.
+func LinkThroughputGBps(speed, width string) (float64, bool) {
+	version, ok := VersionForSpeed(speed)
+	if !ok {
+		return 0, false
+	}
+	lanes, ok := parseFirstInt(width)
+	if !ok {
+		return 0, false
+	}
+	throughput, err := ThroughputGBps(version, lanes)
+	if err != nil {
+		return 0, false
+	}
+	return throughput, true
+}
@@ -27,9 +27,64 @@ func TestThroughputGBpsLookup(t *testing.T) {
 	h.Is(hammy.NilError(err))
 	h.Is(hammy.Number(value).Within(31.507696, 0.000001))
 
-	_, err = ThroughputGBps("6.0", 16)
+	_, err = ThroughputGBps("8.0", 16)
 	h.Is(hammy.String(err.Error()).Contains("unsupported PCIe version"))
 
-	_, err = ThroughputGBps("4.0", 12)
+	_, err = ThroughputGBps("4.0", 3)
 	h.Is(hammy.String(err.Error()).Contains("unsupported lane count"))
 }
+
+func TestThroughputMapFlitModeGenerations(t *testing.T) {
+	h := hammy.New(t)
+
+	v6, ok := VersionBandwidthMap["6.0"]
+	h.Is(hammy.True(ok))
+	h.Is(hammy.Number(v6.TransferRateGTps).Within(64.0, 0.000001))
+	h.Is(hammy.Number(v6.ThroughputGBps[1]).Within(7.5625, 0.000001))
+	h.Is(hammy.Number(v6.ThroughputGBps[16]).Within(121.0, 0.000001))
+
+	v7, ok := VersionBandwidthMap["7.0"]
+	h.Is(hammy.True(ok))
+	h.Is(hammy.Number(v7.ThroughputGBps[32]).Within(484.0, 0.000001))
+
+	value, err := ThroughputGBps("5.0", 12)
+	h.Is(hammy.NilError(err))
+	h.Is(hammy.Number(value).Within(47.261544, 0.000001))
+}
+
+func TestVersionForSpeed(t *testing.T) {
+	h := hammy.New(t)
+
+	cases := map[string]string{
+		"2.5 GT/s PCIe":   "1.0",
+		"5 GT/s":          "2.0",
+		"8.0 GT/s PCIe":   "3.0",
+		"16 GT/s PCIe":    "4.0",
+		"32.0 GT/s PCIe":  "5.0",
+		"64.0 GT/s PCIe":  "6.0",
+		"128.0 GT/s PCIe": "7.0",
+	}
+	for speed, want := range cases {
+		version, ok := VersionForSpeed(speed)
+		h.Is(hammy.True(ok))
+		h.Is(hammy.String(version).EqualTo(want))
+	}
+
+	_, ok := VersionForSpeed("Unknown")
+	h.Is(hammy.False(ok))
+	_, ok = VersionForSpeed("20 GT/s")
+	h.Is(hammy.False(ok))
+}
+
+func TestLinkThroughputGBps(t *testing.T) {
+	h := hammy.New(t)
+
+	value, ok := LinkThroughputGBps("64.0 GT/s PCIe", "16")
+	h.Is(hammy.True(ok))
+	h.Is(hammy.Number(value).Within(121.0, 0.000001))
+
+	_, ok = LinkThroughputGBps("Unknown", "16")
+	h.Is(hammy.False(ok))
+	_, ok = LinkThroughputGBps("16.0 GT/s PCIe", "3")
+	h.Is(hammy.False(ok))
+}
@@ -0,0 +1,74 @@
+package pcie
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// pciAddressPattern matches a PCI address. Domains are usually four hex
+// digits, but devices behind an Intel VMD controller sit in synthetic domains
+// numbered from 0x10000, so up to eight digits are accepted.
+var pciAddressPattern = regexp.MustCompile(`^([0-9a-fA-F]{4,8}):([0-9a-fA-F]{2}):([0-9a-fA-F]{2})\.([0-7])$`)
+
+// BDF is a parsed PCI address: domain, bus, device and function.
+type BDF struct {
+	Domain   uint32
+	Bus      uint8
+	Device   uint8
+	Function uint8
+}
+
+// ParseBDF parses an address such as "0000:01:00.0" or "10000:e1:00.0".
+func ParseBDF(address string) (BDF, error) {
+	m := pciAddressPattern.FindStringSubmatch(strings.TrimSpace(address))
+	if m == nil {
+		return BDF{}, fmt.Errorf("invalid pci address %q", address)
+	}
+	domain, _ := strconv.ParseUint(m[1], 16, 32)
+	bus, _ := strconv.ParseUint(m[2], 16, 8)
+	device, _ := strconv.ParseUint(m[3], 16, 8)
+	function, _ := strconv.ParseUint(m[4], 10, 8)
+	if device > 0x1f {
+		return BDF{}, fmt.Errorf("invalid pci address %q: device %#x out of range", address, device)
+	}
+	return BDF{Domain: uint32(domain), Bus: uint8(bus), Device: uint8(device), Function: uint8(function)}, nil
+}
+
+// String formats the address the way sysfs names devices, with at least four
+// domain digits.
+func (b BDF) String() string {
+	return fmt.Sprintf("%04x:%02x:%02x.%x", b.Domain, b.Bus, b.Device, b.Function)
+}
+
+// Less orders addresses numerically by domain, bus, device and function.
+func (b BDF) Less(other BDF) bool {
+	if b.Domain != other.Domain {
+		return b.Domain < other.Domain
+	}
+	if b.Bus != other.Bus {
+		return b.Bus < other.Bus
+	}
+	if b.Device != other.Device {
+		return b.Device < other.Device
+	}
+	return b.Function < other.Function
+}
+
+// LessAddress orders two address strings numerically. Addresses that do not
+// parse sort after those that do, and lexically among themselves.
+func LessAddress(a, b string) bool {
+	bdfA, errA := ParseBDF(a)
+	bdfB, errB := ParseBDF(b)
+	switch {
+	case errA == nil && errB == nil:
+		return bdfA.Less(bdfB)
+	case errA == nil:
+		return true
+	case errB == nil:
+		return false
+	default:
+		return a < b
+	}
+}
@@ -0,0 +1,73 @@
+package pcie
+
+import (
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/gogunit/gunit/hammy"
+)
+
+func TestParseBDF(t *testing.T) {
+	h := hammy.New(t)
+
+	bdf, err := ParseBDF("0000:3b:00.1")
+	h.Is(hammy.NilError(err))
+	h.Is(hammy.True(bdf == BDF{Domain: 0, Bus: 0x3b, Device: 0, Function: 1}))
+	h.Is(hammy.String(bdf.String()).EqualTo("0000:3b:00.1"))
+
+	vmd, err := ParseBDF("10000:E1:00.0")
+	h.Is(hammy.NilError(err))
+	h.Is(hammy.Number(vmd.Domain).EqualTo(0x10000))
+	h.Is(hammy.String(vmd.String()).EqualTo("10000:e1:00.0"))
+
+	for _, invalid := range []string{"", "pci0000:00", "000:01:00.0", "0000:01:00.8", "0000:01:20.0", "0000:01:00"} {
+		_, err := ParseBDF(invalid)
+		h.Is(hammy.Error(err))
+	}
+}
+
+func TestLessAddressOrdersNumerically(t *testing.T) {
+	h := hammy.New(t)
+
+	addresses := []string{"10000:01:00.0", "invalid", "ffff:00:00.0", "0000:0a:00.0", "0000:02:00.0"}
+	sort.Slice(addresses, func(i, j int) bool {
+		return LessAddress(addresses[i], addresses[j])
+	})
+	h.Is(hammy.Slice(addresses).EqualTo("0000:02:00.0", "0000:0a:00.0", "ffff:00:00.0", "10000:01:00.0", "invalid"))
+}
+
+func TestReadTreePlacesVMDDomainBelowController(t *testing.T) {
+	h := hammy.New(t)
+
+	sysfsRoot := t.TempDir()
+	vmd := filepath.Join(sysfsRoot, "devices", "pci0000:00", "0000:00:0e.0")
+	rootPort := filepath.Join(vmd, "pci10000:00", "10000:00:02.0")
+	nvme := filepath.Join(rootPort, "10000:01:00.0")
+	other := filepath.Join(sysfsRoot, "devices", "pci0000:00", "0000:17:00.0")
+
+	mustMkdirAll(t, vmd)
+	mustWriteFile(t, filepath.Join(vmd, "class"), "0x010400\n")
+	writeLinkFixture(t, rootPort, "0x060400", "16.0 GT/s PCIe", "4", "16.0 GT/s PCIe", "4")
+	writeLinkFixture(t, nvme, "0x010802", "16.0 GT/s PCIe", "4", "16.0 GT/s PCIe", "4")
+	writeLinkFixture(t, other, "0x020000", "16.0 GT/s PCIe", "16", "16.0 GT/s PCIe", "16")
+	linkBusDevices(t, sysfsRoot, vmd, rootPort, nvme, other)
+
+	tree, deviceErrs, err := ReadTree(sysfsRoot)
+	h.Is(hammy.NilError(err))
+	h.Is(hammy.Slice(deviceErrs).IsEmpty())
+	h.Is(hammy.Number(len(tree)).EqualTo(2))
+	h.Is(hammy.String(tree[0].BusID).EqualTo("0000:00:0e.0"))
+	h.Is(hammy.String(tree[1].BusID).EqualTo("0000:17:00.0"))
+	h.Is(hammy.Number(len(tree[0].Children)).EqualTo(1))
+	h.Is(hammy.String(tree[0].Children[0].BusID).EqualTo("10000:00:02.0"))
+	h.Is(hammy.String(tree[0].Children[0].Children[0].BusID).EqualTo("10000:01:00.0"))
+
+	devices, _, err := ReadDevices(sysfsRoot)
+	h.Is(hammy.NilError(err))
+	h.Is(hammy.Number(len(devices)).EqualTo(3))
+	h.Is(hammy.String(devices[0].Address).EqualTo("0000:17:00.0"))
+	h.Is(hammy.String(devices[2].Address).EqualTo("10000:01:00.0"))
+	h.Is(hammy.String(devices[2].Parent).EqualTo("10000:00:02.0"))
+	h.Is(hammy.String(devices[1].Parent).EqualTo("0000:00:0e.0"))
+}
@@ -0,0 +1,81 @@
+package pcie
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+)
+
+// OS binding kinds, in the order they are reported.
+const (
+	BindingNet        = "net"
+	BindingNVMe       = "nvme"
+	BindingBlock      = "block"
+	BindingInfiniBand = "infiniband"
+	BindingDRM        = "drm"
+)
+
+// bindingKinds are the class subdirectories the kernel creates under a PCI
+// function for the devices its driver registers.
+var bindingKinds = []string{BindingNet, BindingNVMe, BindingBlock, BindingInfiniBand, BindingDRM}
+
+// nvmeNamespacePattern matches namespace block devices such as nvme3n1 under
+// nvme/<controller>/. Partitions (nvme3n1p1) are not reported.
+var nvmeNamespacePattern = regexp.MustCompile(`^nvme\d+(c\d+)?n\d+$`)
+
+// OSBinding is a kernel device name bound to a PCI function, such as a
+// network interface (eth2), an NVMe namespace (nvme3n1) or an RDMA device
+// (mlx5_1).
+type OSBinding struct {
+	Kind string `json:"kind"`
+	Name string `json:"name"`
+}
+
+func readOSBindings(devicePath, address string) ([]OSBinding, error) {
+	var bindings []OSBinding
+	var namespaces []OSBinding
+	for _, kind := range bindingKinds {
+		names, err := readDirNames(filepath.Join(devicePath, kind))
+		if err != nil {
+			return nil, &DeviceError{Address: address, Op: "read", File: kind, Err: err}
+		}
+		for _, name := range names {
+			bindings = append(bindings, OSBinding{Kind: kind, Name: name})
+			if kind != BindingNVMe {
+				continue
+			}
+			controllerNames, err := readDirNames(filepath.Join(devicePath, kind, name))
+			if err != nil {
+				return nil, &DeviceError{Address: address, Op: "read", File: kind + "/" + name, Err: err}
+			}
+			for _, controllerName := range controllerNames {
+				if nvmeNamespacePattern.MatchString(controllerName) {
+					namespaces = append(namespaces, OSBinding{Kind: BindingBlock, Name: controllerName})
+				}
+			}
+		}
+		if kind == BindingBlock {
+			bindings = append(bindings, namespaces...)
+		}
+	}
+	return bindings, nil
+}
+
+// readDirNames returns the entry names of dir sorted by name, or nothing
+// when dir does not exist.
+func readDirNames(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	names := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	return names, nil
+}
@@ -0,0 +1,62 @@
+package pcie
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/gogunit/gunit/hammy"
+)
+
+func TestReadOSBindings(t *testing.T) {
+	h := hammy.New(t)
+
+	devicePath := t.TempDir()
+	mustMkdirAll(t, filepath.Join(devicePath, "net", "eth2"))
+	mustMkdirAll(t, filepath.Join(devicePath, "net", "eth3"))
+	mustMkdirAll(t, filepath.Join(devicePath, "infiniband", "mlx5_1"))
+	mustMkdirAll(t, filepath.Join(devicePath, "nvme", "nvme3", "nvme3n1"))
+	mustMkdirAll(t, filepath.Join(devicePath, "nvme", "nvme3", "nvme3n1p1"))
+	mustMkdirAll(t, filepath.Join(devicePath, "nvme", "nvme3", "power"))
+	mustMkdirAll(t, filepath.Join(devicePath, "drm", "card1"))
+	mustMkdirAll(t, filepath.Join(devicePath, "drm", "renderD129"))
+
+	bindings, err := readOSBindings(devicePath, "0000:17:00.0")
+	h.Is(hammy.NilError(err))
+	h.Is(hammy.Slice(bindings).EqualTo(
+		OSBinding{Kind: BindingNet, Name: "eth2"},
+		OSBinding{Kind: BindingNet, Name: "eth3"},
+		OSBinding{Kind: BindingNVMe, Name: "nvme3"},
+		OSBinding{Kind: BindingBlock, Name: "nvme3n1"},
+		OSBinding{Kind: BindingInfiniBand, Name: "mlx5_1"},
+		OSBinding{Kind: BindingDRM, Name: "card1"},
+		OSBinding{Kind: BindingDRM, Name: "renderD129"},
+	))
+
+	none, err := readOSBindings(t.TempDir(), "0000:18:00.0")
+	h.Is(hammy.NilError(err))
+	h.Is(hammy.Slice(none).IsEmpty())
+}
+
+func TestReadDevicesKeepsDeviceWhenBindingsFailToRead(t *testing.T) {
+	h := hammy.New(t)
+
+	sysfsRoot := t.TempDir()
+	nic := filepath.Join(sysfsRoot, "devices", "pci0000:00", "0000:01:00.0")
+	writeLinkFixture(t, nic, "0x020000", "16.0 GT/s PCIe", "16", "16.0 GT/s PCIe", "16")
+	// A file where the net/ directory should be makes the listing fail.
+	mustWriteFile(t, filepath.Join(nic, "net"), "")
+	linkBusDevices(t, sysfsRoot, nic)
+
+	devices, deviceErrs, err := ReadDevices(sysfsRoot)
+	h.Is(hammy.NilError(err))
+	h.Is(hammy.Number(len(devices)).EqualTo(1))
+	h.Is(hammy.Slice(devices[0].OSBindings).IsEmpty())
+	h.Is(hammy.Number(len(deviceErrs)).EqualTo(1))
+	h.Is(hammy.String(deviceErrs[0].File).EqualTo("net"))
+
+	devices, tree, deviceErrs, err := ReadDevicesAndTree(sysfsRoot)
+	h.Is(hammy.NilError(err))
+	h.Is(hammy.Number(len(devices)).EqualTo(1))
+	h.Is(hammy.Number(len(deviceErrs)).EqualTo(1))
+	h.Is(hammy.String(tree[0].Error).EqualTo(""))
+}
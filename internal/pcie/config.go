@@ -0,0 +1,155 @@
+package pcie
+
+import (
+	"encoding/binary"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// Offsets in the standard configuration header and the PCI Express capability.
+// See PCI Express Base Specification, section 7.5.
+const (
+	configStatusOffset     = 0x06
+	configCapPointerOffset = 0x34
+	configHeaderSize       = 0x40
+
+	statusCapabilityList = 0x0010
+
+	capIDPCIExpress = 0x10
+
+	pcieCapsOffset    = 0x02
+	pcieDevCapOffset  = 0x04
+	pcieDevCtlOffset  = 0x08
+	pcieLinkCapOffset = 0x0c
+	pcieLinkStaOffset = 0x12
+	pcieDevCap2       = 0x24
+	pcieDevCtl2       = 0x28
+	pcieLinkCap2      = 0x2c
+	pcieLinkCtl2      = 0x30
+
+	linkStaTraining            = 0x0800
+	linkStaDLLActive           = 0x2000
+	linkStaBandwidthManagement = 0x4000
+	linkStaAutonomousBandwidth = 0x8000
+)
+
+// linkSpeedsGTps maps the encoded link speed values used by LnkCap, LnkSta and
+// LnkCtl2 to transfer rates. Encoding n corresponds to bit n-1 of the
+// Supported Link Speeds Vector in LnkCap2, which the kernel assumes as well.
+var linkSpeedsGTps = map[uint32]float64{
+	1: 2.5,
+	2: 5.0,
+	3: 8.0,
+	4: 16.0,
+	5: 32.0,
+	6: 64.0,
+	7: 128.0,
+}
+
+// LinkRegisters holds link fields decoded from the PCI Express capability in
+// <bdf>/config. Speeds use the same text format as current_link_speed.
+type LinkRegisters struct {
+	MaxSpeed     string
+	MaxWidth     int
+	CurrentSpeed string
+	CurrentWidth int
+	// TargetSpeed and SupportedSpeeds come from LnkCtl2/LnkCap2 and are empty
+	// for capability version 1 devices or when those registers are unreadable.
+	TargetSpeed               string
+	SupportedSpeeds           []string
+	LinkTraining              bool
+	DLLLinkActive             bool
+	BandwidthManagementStatus bool
+	AutonomousBandwidthStatus bool
+}
+
+// readConfig returns nil without error when config space is missing or not
+// readable by this process. Unprivileged readers only get the first 64 bytes
+// of config, which never contain the capability list itself, so decoders
+// treat a short read as a missing capability.
+func readConfig(devicePath, address string) ([]byte, error) {
+	config, err := os.ReadFile(filepath.Join(devicePath, "config"))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) || errors.Is(err, fs.ErrPermission) {
+			return nil, nil
+		}
+		return nil, &DeviceError{Address: address, Op: "read", File: "config", Err: err}
+	}
+	return config, nil
+}
+
+func decodeLinkRegisters(config []byte) (LinkRegisters, bool) {
+	offset, ok := findCapability(config, capIDPCIExpress)
+	if !ok || offset+pcieLinkStaOffset+2 > len(config) {
+		return LinkRegisters{}, false
+	}
+
+	linkCap := binary.LittleEndian.Uint32(config[offset+pcieLinkCapOffset:])
+	linkSta := binary.LittleEndian.Uint16(config[offset+pcieLinkStaOffset:])
+
+	registers := LinkRegisters{
+		MaxSpeed:                  formatLinkSpeed(linkCap & 0xf),
+		MaxWidth:                  int((linkCap >> 4) & 0x3f),
+		CurrentSpeed:              formatLinkSpeed(uint32(linkSta & 0xf)),
+		CurrentWidth:              int((linkSta >> 4) & 0x3f),
+		LinkTraining:              linkSta&linkStaTraining != 0,
+		DLLLinkActive:             linkSta&linkStaDLLActive != 0,
+		BandwidthManagementStatus: linkSta&linkStaBandwidthManagement != 0,
+		AutonomousBandwidthStatus: linkSta&linkStaAutonomousBandwidth != 0,
+	}
+
+	// LnkCap2/LnkCtl2 only exist from capability version 2 onwards.
+	capVersion := binary.LittleEndian.Uint16(config[offset+pcieCapsOffset:]) & 0xf
+	if capVersion >= 2 && offset+pcieLinkCtl2+2 <= len(config) {
+		linkCap2 := binary.LittleEndian.Uint32(config[offset+pcieLinkCap2:])
+		linkCtl2 := binary.LittleEndian.Uint16(config[offset+pcieLinkCtl2:])
+
+		vector := (linkCap2 >> 1) & 0x7f
+		for bit := uint32(0); bit < 7; bit++ {
+			if vector&(1<<bit) != 0 {
+				registers.SupportedSpeeds = append(registers.SupportedSpeeds, formatLinkSpeed(bit+1))
+			}
+		}
+		registers.TargetSpeed = formatLinkSpeed(uint32(linkCtl2 & 0xf))
+	}
+
+	return registers, true
+}
+
+// findCapability walks the standard capability list and returns the offset of
+// the capability with the given ID. It stops at the first pointer that falls
+// outside the readable portion of config.
+func findCapability(config []byte, id byte) (int, bool) {
+	if len(config) < configHeaderSize {
+		return 0, false
+	}
+	status := binary.LittleEndian.Uint16(config[configStatusOffset:])
+	if status&statusCapabilityList == 0 {
+		return 0, false
+	}
+
+	pointer := int(config[configCapPointerOffset] &^ 0x3)
+	// The list lives in the 192 bytes after the header, so at most 48 entries
+	// fit; the bound also protects against malformed, looping lists.
+	for i := 0; i < 48 && pointer >= configHeaderSize; i++ {
+		if pointer+2 > len(config) {
+			return 0, false
+		}
+		if config[pointer] == id {
+			return pointer, true
+		}
+		pointer = int(config[pointer+1] &^ 0x3)
+	}
+	return 0, false
+}
+
+func formatLinkSpeed(encoded uint32) string {
+	speed, ok := linkSpeedsGTps[encoded]
+	if !ok {
+		return "Unknown"
+	}
+	return strconv.FormatFloat(speed, 'f', 1, 64) + " GT/s PCIe"
+}
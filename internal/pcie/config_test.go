@@ -0,0 +1,114 @@
+package pcie
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gogunit/gunit/hammy"
+)
+
+// buildConfig returns a 256-byte config space with a power management
+// capability at 0x40 chained to a PCI Express capability at 0x60.
+func buildConfig(linkCap uint32, linkSta uint16, linkCap2 uint32, linkCtl2 uint16) []byte {
+	config := make([]byte, 256)
+	binary.LittleEndian.PutUint16(config[0x00:], 0x10de)
+	binary.LittleEndian.PutUint16(config[configStatusOffset:], statusCapabilityList)
+	config[configCapPointerOffset] = 0x40
+
+	config[0x40] = 0x01
+	config[0x41] = 0x60
+
+	config[0x60] = capIDPCIExpress
+	config[0x61] = 0x00
+	binary.LittleEndian.PutUint16(config[0x60+pcieCapsOffset:], 0x0002)
+	binary.LittleEndian.PutUint32(config[0x60+pcieLinkCapOffset:], linkCap)
+	binary.LittleEndian.PutUint16(config[0x60+pcieLinkStaOffset:], linkSta)
+	binary.LittleEndian.PutUint32(config[0x60+pcieLinkCap2:], linkCap2)
+	binary.LittleEndian.PutUint16(config[0x60+pcieLinkCtl2:], linkCtl2)
+	return config
+}
+
+func TestDecodeLinkRegisters(t *testing.T) {
+	h := hammy.New(t)
+
+	// Gen5 x16 capable, trained at Gen4 x8 with DLL active and bandwidth management status set.
+	config := buildConfig(0x5|16<<4, 0x4|8<<4|linkStaDLLActive|linkStaBandwidthManagement, 0x1f<<1, 0x5)
+
+	registers, ok := decodeLinkRegisters(config)
+	h.Is(hammy.True(ok))
+	h.Is(hammy.String(registers.MaxSpeed).EqualTo("32.0 GT/s PCIe"))
+	h.Is(hammy.Number(registers.MaxWidth).EqualTo(16))
+	h.Is(hammy.String(registers.CurrentSpeed).EqualTo("16.0 GT/s PCIe"))
+	h.Is(hammy.Number(registers.CurrentWidth).EqualTo(8))
+	h.Is(hammy.String(registers.TargetSpeed).EqualTo("32.0 GT/s PCIe"))
+	h.Is(hammy.Slice(registers.SupportedSpeeds).EqualTo(
+		"2.5 GT/s PCIe", "5.0 GT/s PCIe", "8.0 GT/s PCIe", "16.0 GT/s PCIe", "32.0 GT/s PCIe"))
+	h.Is(hammy.False(registers.LinkTraining))
+	h.Is(hammy.True(registers.DLLLinkActive))
+	h.Is(hammy.True(registers.BandwidthManagementStatus))
+	h.Is(hammy.False(registers.AutonomousBandwidthStatus))
+}
+
+func TestDecodeLinkRegistersUnprivilegedRead(t *testing.T) {
+	h := hammy.New(t)
+
+	config := buildConfig(0x4|16<<4, 0x4|16<<4, 0, 0)
+
+	_, ok := decodeLinkRegisters(config[:configHeaderSize])
+	h.Is(hammy.False(ok))
+
+	_, ok = decodeLinkRegisters(config[:0x20])
+	h.Is(hammy.False(ok))
+}
+
+func TestDecodeLinkRegistersWithoutCapabilityList(t *testing.T) {
+	h := hammy.New(t)
+
+	config := buildConfig(0x4|16<<4, 0x4|16<<4, 0, 0)
+	binary.LittleEndian.PutUint16(config[configStatusOffset:], 0)
+
+	_, ok := decodeLinkRegisters(config)
+	h.Is(hammy.False(ok))
+}
+
+func TestReadDevicesFallsBackToConfigSpace(t *testing.T) {
+	h := hammy.New(t)
+
+	sysfsRoot := t.TempDir()
+	devicePath := filepath.Join(sysfsRoot, "bus", "pci", "devices", "0000:01:00.0")
+	mustMkdirAll(t, devicePath)
+	mustWriteFile(t, filepath.Join(devicePath, "vendor"), "0x10de\n")
+	mustWriteFile(t, filepath.Join(devicePath, "device"), "0x2331\n")
+	mustWriteFile(t, filepath.Join(devicePath, "class"), "0x030200\n")
+	config := buildConfig(0x5|16<<4, 0x5|16<<4|linkStaDLLActive, 0x1f<<1, 0x5)
+	h.Is(hammy.NilError(os.WriteFile(filepath.Join(devicePath, "config"), config, 0o644)))
+
+	devices, _, err := ReadDevices(sysfsRoot)
+	h.Is(hammy.NilError(err))
+	h.Is(hammy.Number(len(devices)).EqualTo(1))
+	h.Is(hammy.String(devices[0].CurrentLinkSpeed).EqualTo("32.0 GT/s PCIe"))
+	h.Is(hammy.String(devices[0].MaxLinkWidth).EqualTo("16"))
+	h.Is(hammy.True(devices[0].NegotiatedOK))
+	h.Is(hammy.True(devices[0].LinkRegisters.DLLLinkActive))
+
+	tree, _, err := ReadTree(sysfsRoot)
+	h.Is(hammy.NilError(err))
+	h.Is(hammy.Number(len(tree)).EqualTo(1))
+	h.Is(hammy.String(tree[0].LinkStatus).EqualTo("32.0 GT/s PCIe x16"))
+}
+
+func TestReadDevicesIgnoresTruncatedConfigSpace(t *testing.T) {
+	h := hammy.New(t)
+
+	sysfsRoot := t.TempDir()
+	devicePath := filepath.Join(sysfsRoot, "bus", "pci", "devices", "0000:01:00.0")
+	mustMkdirAll(t, devicePath)
+	config := buildConfig(0x5|16<<4, 0x5|16<<4, 0, 0)
+	h.Is(hammy.NilError(os.WriteFile(filepath.Join(devicePath, "config"), config[:configHeaderSize], 0o644)))
+
+	devices, _, err := ReadDevices(sysfsRoot)
+	h.Is(hammy.NilError(err))
+	h.Is(hammy.Number(len(devices)).EqualTo(0))
+}
@@ -0,0 +1,77 @@
+package pcie
+
+// Link degradation reasons reported in Device.DegradationReason.
+const (
+	DegradationNone               = "none"
+	DegradationUpstreamCapability = "upstream_capability"
+	DegradationMistrainedWidth    = "mistrained_width"
+	DegradationMistrainedSpeed    = "mistrained_speed"
+	DegradationUnknown            = "unknown"
+	// DegradationPowerManaged is only assigned by ApplyPowerManagement.
+	DegradationPowerManaged = "power_managed"
+)
+
+// DegradationReasons lists every value DegradationReason can take, in a stable
+// order for state-set style metrics.
+var DegradationReasons = []string{
+	DegradationNone,
+	DegradationUpstreamCapability,
+	DegradationMistrainedWidth,
+	DegradationMistrainedSpeed,
+	DegradationUnknown,
+	DegradationPowerManaged,
+}
+
+// classifyDegradations sets DegradationReason on every device, comparing its
+// maximum link against the upstream port's maximum when the parent is known.
+func classifyDegradations(devices []Device) {
+	byAddress := indexByAddress(devices)
+	for i := range devices {
+		if devices[i].SRIOV.IsVF() {
+			continue
+		}
+		var parent *Device
+		if j, ok := byAddress[devices[i].Parent]; ok {
+			parent = &devices[j]
+		}
+		devices[i].DegradationReason = classifyDegradation(devices[i], parent)
+	}
+}
+
+// classifyDegradation explains why a link runs below its maximum. A dimension
+// is upstream-limited when the upstream port cannot go as fast or as wide as
+// the device and the link trained to the upstream port's maximum; anything
+// else below the device maximum is treated as a mis-train. Width is reported
+// ahead of speed because lost lanes usually point at a physical fault.
+func classifyDegradation(device Device, parent *Device) string {
+	if device.NegotiatedOK {
+		return DegradationNone
+	}
+
+	currentSpeed, currentSpeedOK := parseLeadingFloat(device.CurrentLinkSpeed)
+	maxSpeed, maxSpeedOK := parseLeadingFloat(device.MaxLinkSpeed)
+	currentWidth, currentWidthOK := parseFirstInt(device.CurrentLinkWidth)
+	maxWidth, maxWidthOK := parseFirstInt(device.MaxLinkWidth)
+	if !(currentSpeedOK && maxSpeedOK && currentWidthOK && maxWidthOK) {
+		return DegradationUnknown
+	}
+
+	speedLimited := false
+	widthLimited := false
+	if parent != nil {
+		if parentMaxSpeed, ok := parseLeadingFloat(parent.MaxLinkSpeed); ok {
+			speedLimited = parentMaxSpeed < maxSpeed && currentSpeed+1e-9 >= parentMaxSpeed
+		}
+		if parentMaxWidth, ok := parseFirstInt(parent.MaxLinkWidth); ok {
+			widthLimited = parentMaxWidth < maxWidth && currentWidth >= parentMaxWidth
+		}
+	}
+
+	if currentWidth < maxWidth && !widthLimited {
+		return DegradationMistrainedWidth
+	}
+	if currentSpeed+1e-9 < maxSpeed && !speedLimited {
+		return DegradationMistrainedSpeed
+	}
+	return DegradationUpstreamCapability
+}
@@ -0,0 +1,53 @@
+package pcie
+
+import (
+	"testing"
+
+	"github.com/gogunit/gunit/hammy"
+)
+
+func TestClassifyDegradation(t *testing.T) {
+	gpu := Device{
+		CurrentLinkSpeed: "32.0 GT/s PCIe",
+		MaxLinkSpeed:     "32.0 GT/s PCIe",
+		CurrentLinkWidth: "8",
+		MaxLinkWidth:     "16",
+	}
+	x8Port := &Device{MaxLinkSpeed: "32.0 GT/s PCIe", MaxLinkWidth: "8"}
+	x16Port := &Device{MaxLinkSpeed: "32.0 GT/s PCIe", MaxLinkWidth: "16"}
+	gen4Port := &Device{MaxLinkSpeed: "16.0 GT/s PCIe", MaxLinkWidth: "16"}
+
+	gen4Link := gpu
+	gen4Link.CurrentLinkSpeed = "16.0 GT/s PCIe"
+	gen4Link.CurrentLinkWidth = "16"
+
+	gen3Link := gen4Link
+	gen3Link.CurrentLinkSpeed = "8.0 GT/s PCIe"
+
+	healthy := gpu
+	healthy.NegotiatedOK = true
+
+	unparsed := gpu
+	unparsed.CurrentLinkSpeed = "Unknown"
+
+	cases := map[string]struct {
+		device Device
+		parent *Device
+		want   string
+	}{
+		"negotiated ok":           {device: healthy, parent: x8Port, want: DegradationNone},
+		"x8 upstream port":        {device: gpu, parent: x8Port, want: DegradationUpstreamCapability},
+		"x16 upstream port":       {device: gpu, parent: x16Port, want: DegradationMistrainedWidth},
+		"no parent":               {device: gpu, parent: nil, want: DegradationMistrainedWidth},
+		"gen4 upstream port":      {device: gen4Link, parent: gen4Port, want: DegradationUpstreamCapability},
+		"below gen4 upstream cap": {device: gen3Link, parent: gen4Port, want: DegradationMistrainedSpeed},
+		"unparsable speed":        {device: unparsed, parent: x16Port, want: DegradationUnknown},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			h := hammy.New(t)
+			h.Is(hammy.String(classifyDegradation(tc.device, tc.parent)).EqualTo(tc.want))
+		})
+	}
+}
@@ -0,0 +1,131 @@
+package pcie
+
+import "encoding/binary"
+
+// Device Capabilities, Device Control and their second versions. See PCI
+// Express Base Specification, sections 7.5.3.3, 7.5.3.4, 7.5.3.15 and
+// 7.5.3.16.
+const (
+	devCapMaxPayloadMask  = 0x00000007
+	devCapExtendedTag     = 0x00000020
+	devCtlRelaxedOrdering = 0x0010
+	devCtlMaxPayloadShift = 5
+	devCtlExtendedTag     = 0x0100
+	devCtlNoSnoop         = 0x0800
+	devCtlMaxReadShift    = 12
+
+	devCap2LTR                = 0x00000800
+	devCap2TenBitTagRequester = 0x00020000
+	devCap2OBFFMask           = 0x000c0000
+	devCtl2LTR                = 0x0400
+	devCtl2TenBitTagRequester = 0x1000
+	devCtl2OBFFMask           = 0x6000
+)
+
+// DeviceControl holds the transaction layer settings decoded from the Device
+// Capabilities and Device Control registers. Sizes are in bytes.
+type DeviceControl struct {
+	MaxPayloadSupported   int
+	MaxPayload            int
+	MaxReadRequest        int
+	RelaxedOrdering       bool
+	ExtendedTagsSupported bool
+	ExtendedTags          bool
+	NoSnoop               bool
+	// Control2 is false for capability version 1 devices, which have no
+	// DevCap2/DevCtl2; the fields below are then all false.
+	Control2            bool
+	TenBitTagsSupported bool
+	TenBitTags          bool
+	LTRSupported        bool
+	LTR                 bool
+	OBFFSupported       bool
+	OBFF                bool
+	// PathMaxPayloadSupported is the largest payload every device from this
+	// one up to its root port supports, or zero when a hop on the path does
+	// not expose its Device Capabilities. MaxPayload below it is a
+	// misconfiguration that costs throughput without any benefit.
+	PathMaxPayloadSupported int
+}
+
+// MaxPayloadBelowPath reports whether the configured payload size is smaller
+// than what every hop on the path supports.
+func (c *DeviceControl) MaxPayloadBelowPath() bool {
+	return c != nil && c.PathMaxPayloadSupported > 0 && c.MaxPayload < c.PathMaxPayloadSupported
+}
+
+func decodeDeviceControl(config []byte) (DeviceControl, bool) {
+	offset, ok := findCapability(config, capIDPCIExpress)
+	if !ok || offset+pcieDevCtlOffset+2 > len(config) {
+		return DeviceControl{}, false
+	}
+
+	devCap := binary.LittleEndian.Uint32(config[offset+pcieDevCapOffset:])
+	devCtl := binary.LittleEndian.Uint16(config[offset+pcieDevCtlOffset:])
+	control := DeviceControl{
+		MaxPayloadSupported:   128 << (devCap & devCapMaxPayloadMask),
+		MaxPayload:            128 << ((devCtl >> devCtlMaxPayloadShift) & 0x7),
+		MaxReadRequest:        128 << ((devCtl >> devCtlMaxReadShift) & 0x7),
+		RelaxedOrdering:       devCtl&devCtlRelaxedOrdering != 0,
+		ExtendedTagsSupported: devCap&devCapExtendedTag != 0,
+		ExtendedTags:          devCtl&devCtlExtendedTag != 0,
+		NoSnoop:               devCtl&devCtlNoSnoop != 0,
+	}
+
+	// DevCap2/DevCtl2 only exist from capability version 2 onwards.
+	capVersion := binary.LittleEndian.Uint16(config[offset+pcieCapsOffset:]) & 0xf
+	if capVersion >= 2 && offset+pcieDevCtl2+2 <= len(config) {
+		devCap2 := binary.LittleEndian.Uint32(config[offset+pcieDevCap2:])
+		devCtl2 := binary.LittleEndian.Uint16(config[offset+pcieDevCtl2:])
+		control.Control2 = true
+		control.TenBitTagsSupported = devCap2&devCap2TenBitTagRequester != 0
+		control.TenBitTags = devCtl2&devCtl2TenBitTagRequester != 0
+		control.LTRSupported = devCap2&devCap2LTR != 0
+		control.LTR = devCtl2&devCtl2LTR != 0
+		control.OBFFSupported = devCap2&devCap2OBFFMask != 0
+		control.OBFF = devCtl2&devCtl2OBFFMask != 0
+	}
+	return control, true
+}
+
+func decodeDeviceControlPointer(config []byte) *DeviceControl {
+	control, ok := decodeDeviceControl(config)
+	if !ok {
+		return nil
+	}
+	return &control
+}
+
+// resolvePathPayloads fills DeviceControl.PathMaxPayloadSupported by walking
+// Parent links up to a device without a parent. A parent that is not in the
+// device list, such as a port that failed to read or a VMD controller, leaves
+// the path unknown rather than ending it early.
+func resolvePathPayloads(devices []Device) {
+	byAddress := indexByAddress(devices)
+	for i := range devices {
+		if devices[i].DeviceControl == nil || devices[i].SRIOV.IsVF() {
+			continue
+		}
+		supported := devices[i].DeviceControl.MaxPayloadSupported
+		visited := map[int]bool{i: true}
+		for j := i; devices[j].Parent != ""; {
+			next, ok := byAddress[devices[j].Parent]
+			if !ok {
+				supported = 0
+				break
+			}
+			if visited[next] {
+				break
+			}
+			visited[next] = true
+			hop := devices[next].DeviceControl
+			if hop == nil {
+				supported = 0
+				break
+			}
+			supported = min(supported, hop.MaxPayloadSupported)
+			j = next
+		}
+		devices[i].DeviceControl.PathMaxPayloadSupported = supported
+	}
+}
@@ -0,0 +1,107 @@
+package pcie
+
+import (
+	"encoding/binary"
+	"path/filepath"
+	"testing"
+
+	"github.com/gogunit/gunit/hammy"
+)
+
+// buildDeviceControlConfig returns a config space whose PCI Express
+// capability carries the given device registers.
+func buildDeviceControlConfig(devCap uint32, devCtl uint16, devCap2 uint32, devCtl2 uint16) []byte {
+	config := buildConfig(0x4|16<<4, 0x4|16<<4, 0, 0)
+	binary.LittleEndian.PutUint32(config[0x60+pcieDevCapOffset:], devCap)
+	binary.LittleEndian.PutUint16(config[0x60+pcieDevCtlOffset:], devCtl)
+	binary.LittleEndian.PutUint32(config[0x60+pcieDevCap2:], devCap2)
+	binary.LittleEndian.PutUint16(config[0x60+pcieDevCtl2:], devCtl2)
+	return config
+}
+
+func TestDecodeDeviceControl(t *testing.T) {
+	h := hammy.New(t)
+
+	// 512 byte MPS supported with extended tags; configured for MPS 256,
+	// MRRS 4096, relaxed ordering and no snoop. 10-bit tags and LTR are
+	// supported, only LTR is enabled.
+	config := buildDeviceControlConfig(
+		0x2|devCapExtendedTag,
+		1<<devCtlMaxPayloadShift|5<<devCtlMaxReadShift|devCtlRelaxedOrdering|devCtlNoSnoop,
+		devCap2LTR|devCap2TenBitTagRequester,
+		devCtl2LTR)
+
+	control, ok := decodeDeviceControl(config)
+	h.Is(hammy.True(ok))
+	h.Is(hammy.Number(control.MaxPayloadSupported).EqualTo(512))
+	h.Is(hammy.Number(control.MaxPayload).EqualTo(256))
+	h.Is(hammy.Number(control.MaxReadRequest).EqualTo(4096))
+	h.Is(hammy.True(control.RelaxedOrdering))
+	h.Is(hammy.True(control.ExtendedTagsSupported))
+	h.Is(hammy.False(control.ExtendedTags))
+	h.Is(hammy.True(control.NoSnoop))
+	h.Is(hammy.True(control.Control2))
+	h.Is(hammy.True(control.TenBitTagsSupported))
+	h.Is(hammy.False(control.TenBitTags))
+	h.Is(hammy.True(control.LTRSupported))
+	h.Is(hammy.True(control.LTR))
+	h.Is(hammy.False(control.OBFFSupported))
+	h.Is(hammy.False(control.OBFF))
+
+	_, ok = decodeDeviceControl(config[:configHeaderSize])
+	h.Is(hammy.False(ok))
+}
+
+func TestReadDevicesFlagsMaxPayloadBelowPath(t *testing.T) {
+	h := hammy.New(t)
+
+	sysfsRoot := t.TempDir()
+	rootPort := filepath.Join(sysfsRoot, "devices", "pci0000:00", "0000:00:01.0")
+	gpu := filepath.Join(rootPort, "0000:01:00.0")
+	unreadable := filepath.Join(sysfsRoot, "devices", "pci0000:00", "0000:00:02.0")
+	nic := filepath.Join(unreadable, "0000:02:00.0")
+
+	writeLinkFixture(t, rootPort, "0x060400", "16.0 GT/s PCIe", "16", "16.0 GT/s PCIe", "16")
+	writeLinkFixture(t, gpu, "0x030200", "16.0 GT/s PCIe", "16", "16.0 GT/s PCIe", "16")
+	writeLinkFixture(t, unreadable, "0x060400", "16.0 GT/s PCIe", "16", "16.0 GT/s PCIe", "16")
+	writeLinkFixture(t, nic, "0x020000", "16.0 GT/s PCIe", "16", "16.0 GT/s PCIe", "16")
+	// Root port supports 512 bytes and the GPU 256, but the GPU is left at 128.
+	mustWriteFile(t, filepath.Join(rootPort, "config"), string(buildDeviceControlConfig(0x2, 0x2<<devCtlMaxPayloadShift, 0, 0)))
+	mustWriteFile(t, filepath.Join(gpu, "config"), string(buildDeviceControlConfig(0x1, 0, 0, 0)))
+	mustWriteFile(t, filepath.Join(nic, "config"), string(buildDeviceControlConfig(0x1, 0, 0, 0)))
+	linkBusDevices(t, sysfsRoot, rootPort, gpu, unreadable, nic)
+
+	devices, _, err := ReadDevices(sysfsRoot)
+	h.Is(hammy.NilError(err))
+	h.Is(hammy.Number(len(devices)).EqualTo(4))
+
+	port := devices[0].DeviceControl
+	h.Is(hammy.Number(port.PathMaxPayloadSupported).EqualTo(512))
+	h.Is(hammy.False(port.MaxPayloadBelowPath()))
+
+	gpuControl := devices[2].DeviceControl
+	h.Is(hammy.String(devices[2].Address).EqualTo("0000:01:00.0"))
+	h.Is(hammy.Number(gpuControl.PathMaxPayloadSupported).EqualTo(256))
+	h.Is(hammy.True(gpuControl.MaxPayloadBelowPath()))
+
+	// The NIC's upstream port has no readable config, so the path is unknown.
+	h.Is(hammy.Nil(devices[1].DeviceControl))
+	nicControl := devices[3].DeviceControl
+	h.Is(hammy.Number(nicControl.PathMaxPayloadSupported).EqualTo(0))
+	h.Is(hammy.False(nicControl.MaxPayloadBelowPath()))
+}
+
+func TestResolvePathPayloadsUnknownParent(t *testing.T) {
+	h := hammy.New(t)
+
+	// The root port is not in the device list, e.g. it failed to read.
+	devices := []Device{{
+		Address:       "0000:01:00.0",
+		Parent:        "0000:00:01.0",
+		DeviceControl: &DeviceControl{MaxPayloadSupported: 512, MaxPayload: 128},
+	}}
+	resolvePathPayloads(devices)
+
+	h.Is(hammy.Number(devices[0].DeviceControl.PathMaxPayloadSupported).EqualTo(0))
+	h.Is(hammy.False(devices[0].DeviceControl.MaxPayloadBelowPath()))
+}
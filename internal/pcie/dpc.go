@@ -0,0 +1,195 @@
+package pcie
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// Downstream Port Containment and Slot Status. See PCI Express Base
+// Specification, sections 7.5.3.11 and 7.9.14.
+const (
+	extendedCapOffset = 0x100
+	extCapIDDPC       = 0x1d
+
+	pcieCapsSlotImplemented = 0x0100
+	pcieCapsPortTypeShift   = 4
+	pcieSlotStaOffset       = 0x1a
+
+	portTypeRootPort       = 0x4
+	portTypeDownstreamPort = 0x6
+
+	dpcCapOffset         = 0x04
+	dpcCtlOffset         = 0x06
+	dpcStatusOffset      = 0x08
+	dpcSourceIDOffset    = 0x0a
+	dpcRPPIOStatusOffset = 0x0c
+
+	dpcCapRPExtensions      = 0x0020
+	dpcCtlTriggerMask       = 0x0003
+	dpcStatusTriggered      = 0x0001
+	dpcStatusReasonShift    = 1
+	dpcStatusRPBusy         = 0x0010
+	dpcStatusReasonExtShift = 5
+
+	slotStaAttentionButton  = 0x0001
+	slotStaPowerFault       = 0x0002
+	slotStaMRLSensorChanged = 0x0004
+	slotStaPresenceChanged  = 0x0008
+	slotStaPresenceDetected = 0x0040
+	slotStaDataLinkChanged  = 0x0100
+)
+
+// DPC trigger reasons.
+const (
+	DPCReasonUnmaskedUncorrectable = "unmasked_uncorrectable"
+	DPCReasonNonFatal              = "err_nonfatal"
+	DPCReasonFatal                 = "err_fatal"
+	DPCReasonRPPIO                 = "rp_pio"
+	DPCReasonSoftware              = "software"
+)
+
+// DPCReasons lists every DPC trigger reason in a stable order.
+var DPCReasons = []string{
+	DPCReasonUnmaskedUncorrectable,
+	DPCReasonNonFatal,
+	DPCReasonFatal,
+	DPCReasonRPPIO,
+	DPCReasonSoftware,
+}
+
+// DPCStatus is the state of the Downstream Port Containment capability of a
+// root port or switch downstream port. A triggered port has taken its link
+// down and stays contained until software clears the status.
+type DPCStatus struct {
+	// Enabled is true when DPC triggers on ERR_FATAL or ERR_NONFATAL.
+	Enabled   bool
+	Triggered bool
+	// Reason is one of the DPCReason* constants and is empty unless
+	// Triggered is set.
+	Reason string
+	// SourceID is the address of the requester that sent the triggering
+	// error message, empty unless Reason is err_nonfatal or err_fatal. The
+	// register only holds bus, device and function; the requester is always
+	// in the port's own domain.
+	SourceID string
+	// RPExtensions reports root port PIO support; RPBusy and RPPIOStatus
+	// are only meaningful when it is set.
+	RPExtensions bool
+	RPBusy       bool
+	RPPIOStatus  uint32
+}
+
+// SlotStatus holds the Slot Status register of a port that implements a
+// slot. The *Changed fields latch until software clears them.
+type SlotStatus struct {
+	AttentionButtonPressed    bool
+	PowerFaultDetected        bool
+	MRLSensorChanged          bool
+	PresenceDetectChanged     bool
+	PresenceDetected          bool
+	DataLinkLayerStateChanged bool
+}
+
+// decodePortStatus decodes DPC and Slot Status for root ports and switch
+// downstream ports. Either result is nil when the port does not implement it
+// or config space is too short to contain it. address is the port's own
+// address, whose domain completes the DPC error source.
+func decodePortStatus(config []byte, address string) (*DPCStatus, *SlotStatus) {
+	offset, ok := findCapability(config, capIDPCIExpress)
+	if !ok || offset+pcieSlotStaOffset+2 > len(config) {
+		return nil, nil
+	}
+	caps := binary.LittleEndian.Uint16(config[offset+pcieCapsOffset:])
+	switch (caps >> pcieCapsPortTypeShift) & 0xf {
+	case portTypeRootPort, portTypeDownstreamPort:
+	default:
+		return nil, nil
+	}
+
+	var slot *SlotStatus
+	if caps&pcieCapsSlotImplemented != 0 {
+		status := binary.LittleEndian.Uint16(config[offset+pcieSlotStaOffset:])
+		slot = &SlotStatus{
+			AttentionButtonPressed:    status&slotStaAttentionButton != 0,
+			PowerFaultDetected:        status&slotStaPowerFault != 0,
+			MRLSensorChanged:          status&slotStaMRLSensorChanged != 0,
+			PresenceDetectChanged:     status&slotStaPresenceChanged != 0,
+			PresenceDetected:          status&slotStaPresenceDetected != 0,
+			DataLinkLayerStateChanged: status&slotStaDataLinkChanged != 0,
+		}
+	}
+
+	dpcOffset, ok := findExtendedCapability(config, extCapIDDPC)
+	if !ok || dpcOffset+dpcRPPIOStatusOffset+4 > len(config) {
+		return nil, slot
+	}
+	dpcCap := binary.LittleEndian.Uint16(config[dpcOffset+dpcCapOffset:])
+	dpcCtl := binary.LittleEndian.Uint16(config[dpcOffset+dpcCtlOffset:])
+	status := binary.LittleEndian.Uint16(config[dpcOffset+dpcStatusOffset:])
+	dpc := &DPCStatus{
+		Enabled:      dpcCtl&dpcCtlTriggerMask != 0,
+		Triggered:    status&dpcStatusTriggered != 0,
+		RPExtensions: dpcCap&dpcCapRPExtensions != 0,
+	}
+	if dpc.RPExtensions {
+		dpc.RPBusy = status&dpcStatusRPBusy != 0
+		dpc.RPPIOStatus = binary.LittleEndian.Uint32(config[dpcOffset+dpcRPPIOStatusOffset:])
+	}
+	if dpc.Triggered {
+		dpc.Reason = dpcReason(status)
+		if dpc.Reason == DPCReasonNonFatal || dpc.Reason == DPCReasonFatal {
+			dpc.SourceID = dpcSourceAddress(binary.LittleEndian.Uint16(config[dpcOffset+dpcSourceIDOffset:]), address)
+		}
+	}
+	return dpc, slot
+}
+
+// dpcSourceAddress formats a requester ID in the domain of portAddress. It
+// falls back to "bb:dd.f" when the port address cannot be parsed.
+func dpcSourceAddress(source uint16, portAddress string) string {
+	bdf := BDF{Bus: uint8(source >> 8), Device: uint8(source>>3) & 0x1f, Function: uint8(source) & 0x7}
+	port, err := ParseBDF(portAddress)
+	if err != nil {
+		return fmt.Sprintf("%02x:%02x.%x", bdf.Bus, bdf.Device, bdf.Function)
+	}
+	bdf.Domain = port.Domain
+	return bdf.String()
+}
+
+func dpcReason(status uint16) string {
+	switch (status >> dpcStatusReasonShift) & 0x3 {
+	case 0:
+		return DPCReasonUnmaskedUncorrectable
+	case 1:
+		return DPCReasonNonFatal
+	case 2:
+		return DPCReasonFatal
+	}
+	if (status>>dpcStatusReasonExtShift)&0x3 == 0 {
+		return DPCReasonRPPIO
+	}
+	return DPCReasonSoftware
+}
+
+// findExtendedCapability walks the extended capability list that starts at
+// 0x100. Config space read without privileges, or from conventional PCI
+// devices, is too short to contain it.
+func findExtendedCapability(config []byte, id uint16) (int, bool) {
+	pointer := extendedCapOffset
+	// Each entry takes at least four bytes of the 3840 available, and the
+	// bound also protects against malformed, looping lists.
+	for i := 0; i < 960 && pointer >= extendedCapOffset; i++ {
+		if pointer+4 > len(config) {
+			return 0, false
+		}
+		header := binary.LittleEndian.Uint32(config[pointer:])
+		if header == 0 || header == 0xffffffff {
+			return 0, false
+		}
+		if uint16(header&0xffff) == id {
+			return pointer, true
+		}
+		pointer = int(header>>20) &^ 0x3
+	}
+	return 0, false
+}
@@ -0,0 +1,79 @@
+package pcie
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/gogunit/gunit/hammy"
+)
+
+// buildPortConfig returns a 4 KiB config space for a root port with a slot,
+// an AER extended capability at 0x100 and DPC at 0x140.
+func buildPortConfig(slotSta, dpcCap, dpcCtl, dpcStatus, dpcSource uint16, rpPIO uint32) []byte {
+	config := make([]byte, 4096)
+	copy(config, buildConfig(0x4|16<<4, 0x4|16<<4, 0, 0))
+	binary.LittleEndian.PutUint16(config[0x60+pcieCapsOffset:], 0x0002|portTypeRootPort<<pcieCapsPortTypeShift|pcieCapsSlotImplemented)
+	binary.LittleEndian.PutUint16(config[0x60+pcieSlotStaOffset:], slotSta)
+
+	binary.LittleEndian.PutUint32(config[0x100:], 0x0001|0x1<<16|0x140<<20)
+	binary.LittleEndian.PutUint32(config[0x140:], extCapIDDPC|0x1<<16)
+	binary.LittleEndian.PutUint16(config[0x140+dpcCapOffset:], dpcCap)
+	binary.LittleEndian.PutUint16(config[0x140+dpcCtlOffset:], dpcCtl)
+	binary.LittleEndian.PutUint16(config[0x140+dpcStatusOffset:], dpcStatus)
+	binary.LittleEndian.PutUint16(config[0x140+dpcSourceIDOffset:], dpcSource)
+	binary.LittleEndian.PutUint32(config[0x140+dpcRPPIOStatusOffset:], rpPIO)
+	return config
+}
+
+func TestDecodePortStatusTriggeredByFatalError(t *testing.T) {
+	h := hammy.New(t)
+
+	config := buildPortConfig(
+		slotStaDataLinkChanged|slotStaPresenceChanged,
+		dpcCapRPExtensions, 0x2,
+		dpcStatusTriggered|2<<dpcStatusReasonShift, 0x0108, 0)
+
+	dpc, slot := decodePortStatus(config, "10000:e0:1a.0")
+	h.Is(hammy.True(dpc != nil))
+	h.Is(hammy.True(dpc.Enabled))
+	h.Is(hammy.True(dpc.Triggered))
+	h.Is(hammy.String(dpc.Reason).EqualTo(DPCReasonFatal))
+	h.Is(hammy.String(dpc.SourceID).EqualTo("10000:01:01.0"))
+	h.Is(hammy.True(dpc.RPExtensions))
+	h.Is(hammy.False(dpc.RPBusy))
+
+	h.Is(hammy.True(slot != nil))
+	h.Is(hammy.False(slot.PresenceDetected))
+	h.Is(hammy.True(slot.PresenceDetectChanged))
+	h.Is(hammy.True(slot.DataLinkLayerStateChanged))
+	h.Is(hammy.False(slot.PowerFaultDetected))
+}
+
+func TestDecodePortStatusRPPIOTrigger(t *testing.T) {
+	h := hammy.New(t)
+
+	config := buildPortConfig(slotStaPresenceDetected, dpcCapRPExtensions, 0x1,
+		dpcStatusTriggered|3<<dpcStatusReasonShift|dpcStatusRPBusy, 0, 0x00010000)
+
+	dpc, _ := decodePortStatus(config, "0000:00:01.0")
+	h.Is(hammy.String(dpc.Reason).EqualTo(DPCReasonRPPIO))
+	h.Is(hammy.String(dpc.SourceID).EqualTo(""))
+	h.Is(hammy.True(dpc.RPBusy))
+	h.Is(hammy.Number(dpc.RPPIOStatus).EqualTo(0x00010000))
+}
+
+func TestDecodePortStatusSkipsEndpointsAndShortReads(t *testing.T) {
+	h := hammy.New(t)
+
+	config := buildPortConfig(slotStaPresenceDetected, 0, 0x1, 0, 0, 0)
+
+	// Without the extended space only Slot Status is available.
+	dpc, slot := decodePortStatus(config[:256], "0000:00:01.0")
+	h.Is(hammy.Nil(dpc))
+	h.Is(hammy.True(slot.PresenceDetected))
+
+	binary.LittleEndian.PutUint16(config[0x60+pcieCapsOffset:], 0x0002)
+	dpc, slot = decodePortStatus(config, "0000:00:01.0")
+	h.Is(hammy.Nil(dpc))
+	h.Is(hammy.Nil(slot))
+}
@@ -0,0 +1,45 @@
+package pcie
+
+// Expectation replaces the device maximum as the link a device is judged
+// against, for devices that legitimately run below what they advertise.
+type Expectation struct {
+	// Rule names the policy rule that produced the expectation.
+	Rule string
+	// Speed and Width are the expected negotiated link. An empty value keeps
+	// the device maximum for that dimension.
+	Speed string
+	Width string
+	// Ignore reports the link as healthy whatever it negotiated.
+	Ignore bool
+}
+
+// ApplyExpectation re-evaluates the device's negotiation against e. A device
+// that meets its expectation is reported as negotiated OK with no
+// degradation reason; one that does not keeps the reason classified against
+// its maximum.
+func (d *Device) ApplyExpectation(e Expectation) {
+	d.Expectation = &e
+	if e.Ignore {
+		d.NegotiatedOK = true
+		d.DegradationReason = DegradationNone
+		return
+	}
+
+	speed := d.MaxLinkSpeed
+	if e.Speed != "" {
+		speed = e.Speed
+	}
+	width := d.MaxLinkWidth
+	if e.Width != "" {
+		width = e.Width
+	}
+
+	speedRatio, speedOK := compareSpeed(d.CurrentLinkSpeed, speed)
+	widthRatio, widthOK := compareWidth(d.CurrentLinkWidth, width)
+	d.SpeedRatio = speedRatio
+	d.WidthRatio = widthRatio
+	d.NegotiatedOK = speedOK && widthOK
+	if d.NegotiatedOK {
+		d.DegradationReason = DegradationNone
+	}
+}
@@ -0,0 +1,41 @@
+package pcie
+
+import (
+	"testing"
+
+	"github.com/gogunit/gunit/hammy"
+)
+
+func TestApplyExpectation(t *testing.T) {
+	h := hammy.New(t)
+
+	bmc := Device{
+		CurrentLinkSpeed:  "2.5 GT/s PCIe",
+		MaxLinkSpeed:      "5.0 GT/s PCIe",
+		CurrentLinkWidth:  "1",
+		MaxLinkWidth:      "1",
+		DegradationReason: DegradationMistrainedSpeed,
+	}
+	capped := bmc
+	bmc.ApplyExpectation(Expectation{Rule: "bmc-vga", Speed: "2.5 GT/s"})
+	h.Is(hammy.True(bmc.NegotiatedOK))
+	h.Is(hammy.Number(bmc.SpeedRatio).Within(1.0, 0.00001))
+	h.Is(hammy.String(bmc.DegradationReason).EqualTo(DegradationNone))
+	h.Is(hammy.String(bmc.Expectation.Rule).EqualTo("bmc-vga"))
+
+	nic := Device{
+		CurrentLinkSpeed:  "16.0 GT/s PCIe",
+		MaxLinkSpeed:      "16.0 GT/s PCIe",
+		CurrentLinkWidth:  "4",
+		MaxLinkWidth:      "16",
+		DegradationReason: DegradationMistrainedWidth,
+	}
+	nic.ApplyExpectation(Expectation{Rule: "capped-nic", Width: "8"})
+	h.Is(hammy.False(nic.NegotiatedOK))
+	h.Is(hammy.Number(nic.WidthRatio).Within(0.5, 0.00001))
+	h.Is(hammy.String(nic.DegradationReason).EqualTo(DegradationMistrainedWidth))
+
+	capped.ApplyExpectation(Expectation{Rule: "ignored", Ignore: true})
+	h.Is(hammy.True(capped.NegotiatedOK))
+	h.Is(hammy.String(capped.DegradationReason).EqualTo(DegradationNone))
+}
@@ -0,0 +1,166 @@
+package pcie
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+)
+
+// FilterRule selects devices. Empty fields match anything; set fields must
+// all match.
+type FilterRule struct {
+	// ClassPrefix matches the leading hex digits of the class code, e.g.
+	// "0302" for 3D controllers.
+	ClassPrefix string `json:"class_prefix,omitempty"`
+	VendorID    string `json:"vendor_id,omitempty"`
+	DeviceID    string `json:"device_id,omitempty"`
+	Driver      string `json:"driver,omitempty"`
+	// Address is a regular expression matched against the PCI address.
+	Address string `json:"address,omitempty"`
+
+	address *regexp.Regexp
+}
+
+// FilterConfig is the JSON form of a Filter.
+type FilterConfig struct {
+	Include []FilterRule `json:"include,omitempty"`
+	Exclude []FilterRule `json:"exclude,omitempty"`
+	// Tree also applies the filter to the topology tree.
+	Tree bool `json:"tree,omitempty"`
+}
+
+// Filter keeps a device when it matches any include rule, or there are no
+// include rules, and matches no exclude rule. A nil Filter keeps everything.
+type Filter struct {
+	include []FilterRule
+	exclude []FilterRule
+}
+
+// NewFilter validates the rules and compiles their address expressions.
+func NewFilter(include, exclude []FilterRule) (*Filter, error) {
+	f := &Filter{}
+	var err error
+	if f.include, err = compileFilterRules(include); err != nil {
+		return nil, fmt.Errorf("include: %w", err)
+	}
+	if f.exclude, err = compileFilterRules(exclude); err != nil {
+		return nil, fmt.Errorf("exclude: %w", err)
+	}
+	return f, nil
+}
+
+func compileFilterRules(rules []FilterRule) ([]FilterRule, error) {
+	compiled := make([]FilterRule, 0, len(rules))
+	for i, rule := range rules {
+		if rule.ClassPrefix == "" && rule.VendorID == "" && rule.DeviceID == "" && rule.Driver == "" && rule.Address == "" {
+			return nil, fmt.Errorf("rule %d sets no fields", i)
+		}
+		if rule.Address != "" {
+			address, err := regexp.Compile(rule.Address)
+			if err != nil {
+				return nil, fmt.Errorf("rule %d: address: %w", i, err)
+			}
+			rule.address = address
+		}
+		compiled = append(compiled, rule)
+	}
+	return compiled, nil
+}
+
+// LoadFilterConfig reads a FilterConfig from a JSON file.
+func LoadFilterConfig(path string) (FilterConfig, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return FilterConfig{}, fmt.Errorf("open filter config %s: %w", path, err)
+	}
+	defer f.Close()
+
+	config, err := ParseFilterConfig(f)
+	if err != nil {
+		return FilterConfig{}, fmt.Errorf("parse filter config %s: %w", path, err)
+	}
+	return config, nil
+}
+
+// ParseFilterConfig decodes a FilterConfig, rejecting unknown fields.
+func ParseFilterConfig(r io.Reader) (FilterConfig, error) {
+	var config FilterConfig
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&config); err != nil {
+		return FilterConfig{}, err
+	}
+	return config, nil
+}
+
+// Devices returns the devices the filter keeps. Paths and degradation
+// reasons have already been resolved against the full device list, so
+// filtering does not change them.
+func (f *Filter) Devices(devices []Device) []Device {
+	if f == nil {
+		return devices
+	}
+	kept := make([]Device, 0, len(devices))
+	for _, device := range devices {
+		if f.keep(device.Address, device.identity(), device.Driver) {
+			kept = append(kept, device)
+		}
+	}
+	return kept
+}
+
+// Tree returns a copy of nodes without the subtrees that contain no kept
+// device. Ancestors of kept nodes are retained even when they do not match,
+// so every kept node stays at its position in the topology.
+func (f *Filter) Tree(nodes []*TreeNode) []*TreeNode {
+	if f == nil {
+		return nodes
+	}
+	kept := make([]*TreeNode, 0, len(nodes))
+	for _, node := range nodes {
+		children := f.Tree(node.Children)
+		if len(children) == 0 && !f.keep(node.BusID, node.identity(), node.Driver) {
+			continue
+		}
+		pruned := *node
+		pruned.Children = children
+		kept = append(kept, &pruned)
+	}
+	return kept
+}
+
+// Decide records in decisions whether the filter keeps each node of nodes and
+// their descendants, by PCI address. It lets series keyed only by address,
+// such as watcher and kernel log counters, follow the same filter.
+func (f *Filter) Decide(nodes []*TreeNode, decisions map[string]bool) {
+	for _, node := range nodes {
+		decisions[node.BusID] = f == nil || f.keep(node.BusID, node.identity(), node.Driver)
+		f.Decide(node.Children, decisions)
+	}
+}
+
+func (f *Filter) keep(address string, id identity, driver string) bool {
+	if len(f.include) > 0 && !matchesAnyFilterRule(f.include, address, id, driver) {
+		return false
+	}
+	return !matchesAnyFilterRule(f.exclude, address, id, driver)
+}
+
+func matchesAnyFilterRule(rules []FilterRule, address string, id identity, driver string) bool {
+	for _, rule := range rules {
+		if rule.matches(address, id, driver) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r FilterRule) matches(address string, id identity, driver string) bool {
+	match := IDMatch{ClassPrefix: r.ClassPrefix, VendorID: r.VendorID, DeviceID: r.DeviceID, Driver: r.Driver}
+	if !match.matches(id, driver) {
+		return false
+	}
+	return r.address == nil || r.address.MatchString(address)
+}
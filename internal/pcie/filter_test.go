@@ -0,0 +1,92 @@
+package pcie
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/gogunit/gunit/hammy"
+)
+
+func TestFilterDevices(t *testing.T) {
+	h := hammy.New(t)
+
+	devices := []Device{
+		{Address: "0000:00:01.0", VendorID: "0x8086", Class: "0x060400"},
+		{Address: "0000:17:00.0", VendorID: "0x10de", DeviceID: "0x2331", Class: "0x030200", Driver: "nvidia"},
+		{Address: "0000:18:00.0", VendorID: "0x15b3", DeviceID: "0x1017", Class: "0x020000", Driver: "mlx5_core"},
+		{Address: "0000:19:00.0", VendorID: "0x144d", Class: "0x010802", Driver: "nvme"},
+	}
+
+	filter, err := NewFilter(
+		[]FilterRule{{ClassPrefix: "0302"}, {Driver: "mlx5_core"}, {Address: `^0000:19:`}},
+		[]FilterRule{{VendorID: "144D"}},
+	)
+	h.Is(hammy.NilError(err))
+
+	kept := filter.Devices(devices)
+	h.Is(hammy.Number(len(kept)).EqualTo(2))
+	h.Is(hammy.String(kept[0].Address).EqualTo("0000:17:00.0"))
+	h.Is(hammy.String(kept[1].Address).EqualTo("0000:18:00.0"))
+
+	var none *Filter
+	h.Is(hammy.Number(len(none.Devices(devices))).EqualTo(4))
+}
+
+func TestFilterTreeKeepsAncestors(t *testing.T) {
+	h := hammy.New(t)
+
+	gpu := &TreeNode{BusID: "0000:17:00.0", Class: "0x030200"}
+	audio := &TreeNode{BusID: "0000:17:00.1", Class: "0x040300"}
+	port := &TreeNode{BusID: "0000:16:00.0", Class: "0x060400", Children: []*TreeNode{gpu, audio}}
+	rootPort := &TreeNode{BusID: "0000:00:01.0", Class: "0x060400", Children: []*TreeNode{port}}
+	isa := &TreeNode{BusID: "0000:00:1f.0", Class: "0x060100"}
+	tree := []*TreeNode{rootPort, isa}
+
+	filter, err := NewFilter([]FilterRule{{ClassPrefix: "0x0302"}}, nil)
+	h.Is(hammy.NilError(err))
+
+	pruned := filter.Tree(tree)
+	h.Is(hammy.Number(len(pruned)).EqualTo(1))
+	h.Is(hammy.String(pruned[0].BusID).EqualTo("0000:00:01.0"))
+	h.Is(hammy.Number(len(pruned[0].Children[0].Children)).EqualTo(1))
+	h.Is(hammy.String(pruned[0].Children[0].Children[0].BusID).EqualTo("0000:17:00.0"))
+	h.Is(hammy.Number(len(port.Children)).EqualTo(2))
+}
+
+func TestFilterDecide(t *testing.T) {
+	h := hammy.New(t)
+
+	gpu := &TreeNode{BusID: "0000:17:00.0", Class: "0x030200"}
+	port := &TreeNode{BusID: "0000:16:00.0", Class: "0x060400", Children: []*TreeNode{gpu}}
+
+	filter, err := NewFilter([]FilterRule{{ClassPrefix: "0302"}}, nil)
+	h.Is(hammy.NilError(err))
+
+	decisions := map[string]bool{}
+	filter.Decide([]*TreeNode{port}, decisions)
+	h.Is(hammy.Number(len(decisions)).EqualTo(2))
+	h.Is(hammy.True(decisions["0000:17:00.0"]))
+	h.Is(hammy.False(decisions["0000:16:00.0"]))
+}
+
+func TestNewFilterRejectsInvalidRules(t *testing.T) {
+	h := hammy.New(t)
+
+	_, err := NewFilter([]FilterRule{{}}, nil)
+	h.Is(hammy.Error(err))
+	_, err = NewFilter(nil, []FilterRule{{Address: "("}})
+	h.Is(hammy.Error(err))
+}
+
+func TestParseFilterConfig(t *testing.T) {
+	h := hammy.New(t)
+
+	config, err := ParseFilterConfig(strings.NewReader(`{"include": [{"class_prefix": "0302"}], "exclude": [{"driver": "vfio-pci"}], "tree": true}`))
+	h.Is(hammy.NilError(err))
+	h.Is(hammy.Number(len(config.Include)).EqualTo(1))
+	h.Is(hammy.String(config.Exclude[0].Driver).EqualTo("vfio-pci"))
+	h.Is(hammy.True(config.Tree))
+
+	_, err = ParseFilterConfig(strings.NewReader(`{"includes": []}`))
+	h.Is(hammy.Error(err))
+}
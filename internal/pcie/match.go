@@ -0,0 +1,49 @@
+package pcie
+
+import "strings"
+
+// NormalizeHexID lower-cases a hex ID or class code and drops any 0x prefix
+// so "0x10DE" and "10de" compare equal.
+func NormalizeHexID(value string) string {
+	value = strings.ToLower(strings.TrimSpace(value))
+	return strings.TrimPrefix(value, "0x")
+}
+
+// HasClassPrefix reports whether class starts with the hex digits of prefix,
+// e.g. "0x030200" has the prefix "0302".
+func HasClassPrefix(class, prefix string) bool {
+	return strings.HasPrefix(NormalizeHexID(class), NormalizeHexID(prefix))
+}
+
+// IDMatch selects devices by class code prefix, IDs and bound driver. Empty
+// fields match anything; set fields must all match. Device filters and link
+// policies add their own address and slot matching on top.
+type IDMatch struct {
+	ClassPrefix string
+	VendorID    string
+	DeviceID    string
+	Driver      string
+}
+
+// Matches reports whether device is selected by m.
+func (m IDMatch) Matches(device Device) bool {
+	return m.matches(device.identity(), device.Driver)
+}
+
+// MatchesNode reports whether the tree node is selected by m.
+func (m IDMatch) MatchesNode(node *TreeNode) bool {
+	return m.matches(node.identity(), node.Driver)
+}
+
+func (m IDMatch) matches(id identity, driver string) bool {
+	if m.ClassPrefix != "" && !HasClassPrefix(id.class, m.ClassPrefix) {
+		return false
+	}
+	if m.VendorID != "" && NormalizeHexID(m.VendorID) != NormalizeHexID(id.vendorID) {
+		return false
+	}
+	if m.DeviceID != "" && NormalizeHexID(m.DeviceID) != NormalizeHexID(id.deviceID) {
+		return false
+	}
+	return m.Driver == "" || m.Driver == driver
+}
@@ -0,0 +1,30 @@
+package pcie
+
+import (
+	"testing"
+
+	"github.com/gogunit/gunit/hammy"
+)
+
+func TestNormalizeHexID(t *testing.T) {
+	h := hammy.New(t)
+
+	h.Is(hammy.String(NormalizeHexID("0x10DE\n")).EqualTo("10de"))
+	h.Is(hammy.String(NormalizeHexID("10de")).EqualTo("10de"))
+	h.Is(hammy.True(HasClassPrefix("0x030200", "0302")))
+	h.Is(hammy.True(HasClassPrefix("0x030200", "0x03")))
+	h.Is(hammy.False(HasClassPrefix("0x020000", "0302")))
+}
+
+func TestIDMatch(t *testing.T) {
+	h := hammy.New(t)
+
+	gpu := Device{VendorID: "0x10de", DeviceID: "0x2330", Class: "0x030200", Driver: "nvidia"}
+
+	h.Is(hammy.True(IDMatch{}.Matches(gpu)))
+	h.Is(hammy.True(IDMatch{ClassPrefix: "0302", VendorID: "10DE", DeviceID: "0x2330", Driver: "nvidia"}.Matches(gpu)))
+	h.Is(hammy.False(IDMatch{ClassPrefix: "0200"}.Matches(gpu)))
+	h.Is(hammy.False(IDMatch{VendorID: "15b3"}.Matches(gpu)))
+	h.Is(hammy.False(IDMatch{DeviceID: "2331"}.Matches(gpu)))
+	h.Is(hammy.False(IDMatch{Driver: "nouveau"}.Matches(gpu)))
+}
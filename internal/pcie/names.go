@@ -0,0 +1,113 @@
+package pcie
+
+import (
+	"path/filepath"
+
+	"github.com/nfisher/pcie-exporter/internal/pciids"
+)
+
+// identity holds the raw ID attributes sysfs exposes for every PCI function.
+type identity struct {
+	vendorID          string
+	deviceID          string
+	class             string
+	subsystemVendorID string
+	subsystemDeviceID string
+}
+
+func readIdentity(devicePath, address string) (identity, error) {
+	var id identity
+	files := []struct {
+		name  string
+		value *string
+	}{
+		{name: "vendor", value: &id.vendorID},
+		{name: "device", value: &id.deviceID},
+		{name: "class", value: &id.class},
+		{name: "subsystem_vendor", value: &id.subsystemVendorID},
+		{name: "subsystem_device", value: &id.subsystemDeviceID},
+	}
+	for _, file := range files {
+		value, _, err := readOptionalTrim(filepath.Join(devicePath, file.name))
+		if err != nil {
+			return identity{}, &DeviceError{Address: address, Op: "read", File: file.name, Err: err}
+		}
+		*file.value = value
+	}
+	return id, nil
+}
+
+// Names holds human-readable names resolved from pci.ids. Fields are empty
+// when the database has no entry for the corresponding ID.
+type Names struct {
+	VendorName    string `json:"vendor_name,omitempty"`
+	DeviceName    string `json:"device_name,omitempty"`
+	SubsystemName string `json:"subsystem_name,omitempty"`
+	ClassName     string `json:"class_name,omitempty"`
+	SubclassName  string `json:"subclass_name,omitempty"`
+	ProgIfName    string `json:"prog_if_name,omitempty"`
+}
+
+func lookupNames(db *pciids.DB, id identity) Names {
+	class := db.Class(id.class)
+	return Names{
+		VendorName:    db.VendorName(id.vendorID),
+		DeviceName:    db.DeviceName(id.vendorID, id.deviceID),
+		SubsystemName: db.SubsystemName(id.vendorID, id.deviceID, id.subsystemVendorID, id.subsystemDeviceID),
+		ClassName:     class.Class,
+		SubclassName:  class.Subclass,
+		ProgIfName:    class.ProgIf,
+	}
+}
+
+// ApplyNames fills Device.Names from db.
+func ApplyNames(devices []Device, db *pciids.DB) {
+	for i := range devices {
+		devices[i].Names = lookupNames(db, devices[i].identity())
+	}
+}
+
+// ApplyTreeNames fills TreeNode.Names from db for every node in the tree.
+// Nodes whose Name fell back to "vendor:device" hex IDs are renamed to the
+// pci.ids device name when one is known.
+func ApplyTreeNames(nodes []*TreeNode, db *pciids.DB) {
+	for _, node := range nodes {
+		id := node.identity()
+		node.Names = lookupNames(db, id)
+		if node.Name == hexIDName(id) && node.Names.DeviceName != "" {
+			node.Name = node.Names.DeviceName
+		}
+		ApplyTreeNames(node.Children, db)
+	}
+}
+
+func (d Device) identity() identity {
+	return identity{
+		vendorID:          d.VendorID,
+		deviceID:          d.DeviceID,
+		class:             d.Class,
+		subsystemVendorID: d.SubsystemVendorID,
+		subsystemDeviceID: d.SubsystemDeviceID,
+	}
+}
+
+func (n *TreeNode) identity() identity {
+	return identity{
+		vendorID:          n.VendorID,
+		deviceID:          n.DeviceID,
+		class:             n.Class,
+		subsystemVendorID: n.SubsystemVendorID,
+		subsystemDeviceID: n.SubsystemDeviceID,
+	}
+}
+
+// hexIDName is the "vendor:device" fallback name used when a device has
+// neither a firmware label nor a bound driver.
+func hexIDName(id identity) string {
+	vendorID := NormalizeHexID(id.vendorID)
+	deviceID := NormalizeHexID(id.deviceID)
+	if vendorID == "" && deviceID == "" {
+		return ""
+	}
+	return vendorID + ":" + deviceID
+}
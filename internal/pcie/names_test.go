@@ -0,0 +1,54 @@
+package pcie
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/gogunit/gunit/hammy"
+	"github.com/nfisher/pcie-exporter/internal/pciids"
+)
+
+func TestApplyNames(t *testing.T) {
+	h := hammy.New(t)
+
+	db, err := pciids.Open(filepath.Join("..", "pciids", "testdata", "pci.ids"))
+	h.Is(hammy.NilError(err))
+
+	devices := []Device{{
+		Address:           "0000:01:00.0",
+		VendorID:          "0x10de",
+		DeviceID:          "0x2331",
+		Class:             "0x030200",
+		SubsystemVendorID: "0x10de",
+		SubsystemDeviceID: "0x1626",
+	}}
+	ApplyNames(devices, db)
+
+	h.Is(hammy.Struct(devices[0].Names).EqualTo(Names{
+		VendorName:    "NVIDIA Corporation",
+		DeviceName:    "GH100 [H100 PCIe]",
+		SubsystemName: "H100 PCIe",
+		ClassName:     "Display controller",
+		SubclassName:  "3D controller",
+	}))
+}
+
+func TestApplyTreeNamesReplacesHexFallbackName(t *testing.T) {
+	h := hammy.New(t)
+
+	db, err := pciids.Open(filepath.Join("..", "pciids", "testdata", "pci.ids"))
+	h.Is(hammy.NilError(err))
+
+	labelled := &TreeNode{BusID: "0000:01:00.0", Name: "GPU0", VendorID: "0x10de", DeviceID: "0x2331"}
+	nic := &TreeNode{BusID: "0000:02:00.0", Name: "15b3:1017", VendorID: "0x15b3", DeviceID: "0x1017", Class: "0x020000"}
+	bridge := &TreeNode{BusID: "0000:00:01.0", Name: "8086:abcd", VendorID: "0x8086", DeviceID: "0xabcd", Children: []*TreeNode{labelled, nic}}
+
+	ApplyTreeNames([]*TreeNode{bridge}, db)
+
+	h.Is(hammy.String(bridge.Name).EqualTo("8086:abcd"))
+	h.Is(hammy.String(bridge.VendorName).EqualTo("Intel Corporation"))
+	h.Is(hammy.String(labelled.Name).EqualTo("GPU0"))
+	h.Is(hammy.String(labelled.DeviceName).EqualTo("GH100 [H100 PCIe]"))
+	h.Is(hammy.String(nic.Name).EqualTo("MT27800 Family [ConnectX-5]"))
+	h.Is(hammy.String(nic.ClassName).EqualTo("Network controller"))
+}
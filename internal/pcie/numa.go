@@ -0,0 +1,94 @@
+package pcie
+
+import (
+	"path/filepath"
+	"sort"
+	"strconv"
+)
+
+// NoNUMANode is reported by the kernel, and used here, when a device has no
+// NUMA affinity or the platform is not NUMA.
+const NoNUMANode = -1
+
+// NUMAAffinity is the NUMA node and local CPUs of a device.
+type NUMAAffinity struct {
+	Node int `json:"numa_node"`
+	// LocalCPUList is local_cpulist, e.g. "0-31,64-95".
+	LocalCPUList string `json:"local_cpulist,omitempty"`
+	// LocalCPUs is the local_cpus hex mask, e.g. "ffffffff,00000000,ffffffff".
+	LocalCPUs string `json:"local_cpus,omitempty"`
+}
+
+// readNUMAAffinity reads the NUMA attributes of a device. On error it returns
+// an affinity with no node, so callers can keep the device without it.
+func readNUMAAffinity(devicePath, address string) (NUMAAffinity, error) {
+	affinity := NUMAAffinity{Node: NoNUMANode}
+
+	node, ok, err := readOptionalTrim(filepath.Join(devicePath, "numa_node"))
+	if err != nil {
+		return NUMAAffinity{Node: NoNUMANode}, &DeviceError{Address: address, Op: "read", File: "numa_node", Err: err}
+	}
+	if ok {
+		parsed, err := strconv.Atoi(node)
+		if err != nil {
+			return NUMAAffinity{Node: NoNUMANode}, &DeviceError{Address: address, Op: "parse", File: "numa_node", Err: err}
+		}
+		affinity.Node = parsed
+	}
+
+	affinity.LocalCPUList, _, err = readOptionalTrim(filepath.Join(devicePath, "local_cpulist"))
+	if err != nil {
+		return NUMAAffinity{Node: NoNUMANode}, &DeviceError{Address: address, Op: "read", File: "local_cpulist", Err: err}
+	}
+	affinity.LocalCPUs, _, err = readOptionalTrim(filepath.Join(devicePath, "local_cpus"))
+	if err != nil {
+		return NUMAAffinity{Node: NoNUMANode}, &DeviceError{Address: address, Op: "read", File: "local_cpus", Err: err}
+	}
+	return affinity, nil
+}
+
+// NUMANodeThroughput is the combined negotiated link throughput of the
+// endpoints attached to one NUMA node.
+type NUMANodeThroughput struct {
+	Node           int
+	Endpoints      int
+	ThroughputGBps float64
+}
+
+// NUMARollup sums the theoretical throughput of the negotiated link of every
+// non-bridge device by NUMA node, sorted by node. SR-IOV virtual functions
+// are left out. The functions of a
+// multi-function device share one link, which is only counted once. Devices
+// without a mappable link are counted as endpoints but add no throughput.
+func NUMARollup(devices []Device) []NUMANodeThroughput {
+	byNode := make(map[int]*NUMANodeThroughput)
+	links := make(map[string]bool, len(devices))
+	for _, device := range devices {
+		if isBridgeClass(device.Class) || device.SRIOV.IsVF() {
+			continue
+		}
+		rollup, ok := byNode[device.NUMA.Node]
+		if !ok {
+			rollup = &NUMANodeThroughput{Node: device.NUMA.Node}
+			byNode[device.NUMA.Node] = rollup
+		}
+		rollup.Endpoints++
+		link := slotAddress(device.Address)
+		if links[link] {
+			continue
+		}
+		if throughput, ok := LinkThroughputGBps(device.CurrentLinkSpeed, device.CurrentLinkWidth); ok {
+			rollup.ThroughputGBps += throughput
+			links[link] = true
+		}
+	}
+
+	rollups := make([]NUMANodeThroughput, 0, len(byNode))
+	for _, rollup := range byNode {
+		rollups = append(rollups, *rollup)
+	}
+	sort.Slice(rollups, func(i, j int) bool {
+		return rollups[i].Node < rollups[j].Node
+	})
+	return rollups
+}
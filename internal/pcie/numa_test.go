@@ -0,0 +1,88 @@
+package pcie
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/gogunit/gunit/hammy"
+)
+
+func TestReadNUMAAffinity(t *testing.T) {
+	h := hammy.New(t)
+
+	devices, _, err := ReadDevices(filepath.Join("testdata", "sysfs"))
+	h.Is(hammy.NilError(err))
+	h.Is(hammy.Number(devices[1].NUMA.Node).EqualTo(1))
+	h.Is(hammy.String(devices[1].NUMA.LocalCPUList).EqualTo("32-63,96-127"))
+	h.Is(hammy.String(devices[1].NUMA.LocalCPUs).EqualTo("ffffffff,00000000,ffffffff,00000000"))
+
+	affinity, err := readNUMAAffinity(t.TempDir(), "0000:17:00.0")
+	h.Is(hammy.NilError(err))
+	h.Is(hammy.Number(affinity.Node).EqualTo(NoNUMANode))
+
+	devicePath := t.TempDir()
+	mustWriteFile(t, filepath.Join(devicePath, "numa_node"), "node0\n")
+	affinity, err = readNUMAAffinity(devicePath, "0000:17:00.0")
+	h.Is(hammy.Error(err))
+	h.Is(hammy.Number(affinity.Node).EqualTo(NoNUMANode))
+}
+
+func TestReadDevicesKeepsDeviceWhenNUMAFailsToRead(t *testing.T) {
+	h := hammy.New(t)
+
+	sysfsRoot := t.TempDir()
+	gpu := filepath.Join(sysfsRoot, "devices", "pci0000:00", "0000:01:00.0")
+	writeLinkFixture(t, gpu, "0x030200", "16.0 GT/s PCIe", "16", "16.0 GT/s PCIe", "16")
+	mustWriteFile(t, filepath.Join(gpu, "numa_node"), "node0\n")
+	linkBusDevices(t, sysfsRoot, gpu)
+
+	devices, deviceErrs, err := ReadDevices(sysfsRoot)
+	h.Is(hammy.NilError(err))
+	h.Is(hammy.Number(len(devices)).EqualTo(1))
+	h.Is(hammy.Number(devices[0].NUMA.Node).EqualTo(NoNUMANode))
+	h.Is(hammy.Number(len(deviceErrs)).EqualTo(1))
+	h.Is(hammy.String(deviceErrs[0].File).EqualTo("numa_node"))
+}
+
+func TestNUMARollup(t *testing.T) {
+	h := hammy.New(t)
+
+	devices := []Device{
+		{Address: "0000:00:01.0", Class: "0x060400", CurrentLinkSpeed: "32.0 GT/s PCIe", CurrentLinkWidth: "16", NUMA: NUMAAffinity{Node: 0}},
+		{Address: "0000:17:00.0", Class: "0x030200", CurrentLinkSpeed: "32.0 GT/s PCIe", CurrentLinkWidth: "16", NUMA: NUMAAffinity{Node: 0}},
+		{Address: "0000:18:00.0", Class: "0x020000", CurrentLinkSpeed: "16.0 GT/s PCIe", CurrentLinkWidth: "16", NUMA: NUMAAffinity{Node: 0}},
+		{Address: "0000:97:00.0", Class: "0x030200", CurrentLinkSpeed: "32.0 GT/s PCIe", CurrentLinkWidth: "16", NUMA: NUMAAffinity{Node: 1}},
+		{Address: "0000:c1:00.0", Class: "0x010802", CurrentLinkSpeed: "Unknown", CurrentLinkWidth: "0", NUMA: NUMAAffinity{Node: NoNUMANode}},
+	}
+
+	gen5x16, err := ThroughputGBps("5.0", 16)
+	h.Is(hammy.NilError(err))
+	gen4x16, err := ThroughputGBps("4.0", 16)
+	h.Is(hammy.NilError(err))
+
+	rollups := NUMARollup(devices)
+	h.Is(hammy.Number(len(rollups)).EqualTo(3))
+	h.Is(hammy.Number(rollups[0].Node).EqualTo(NoNUMANode))
+	h.Is(hammy.Number(rollups[0].Endpoints).EqualTo(1))
+	h.Is(hammy.Number(rollups[0].ThroughputGBps).EqualTo(0))
+	h.Is(hammy.Number(rollups[1].Endpoints).EqualTo(2))
+	h.Is(hammy.Number(rollups[1].ThroughputGBps).Within(gen5x16+gen4x16, 0.00001))
+	h.Is(hammy.Number(rollups[2].ThroughputGBps).Within(gen5x16, 0.00001))
+}
+
+func TestNUMARollupCountsSharedLinkOnce(t *testing.T) {
+	h := hammy.New(t)
+
+	devices := []Device{
+		{Address: "0000:17:00.0", Class: "0x030000", CurrentLinkSpeed: "32.0 GT/s PCIe", CurrentLinkWidth: "16", NUMA: NUMAAffinity{Node: 0}},
+		{Address: "0000:17:00.1", Class: "0x040300", CurrentLinkSpeed: "32.0 GT/s PCIe", CurrentLinkWidth: "16", NUMA: NUMAAffinity{Node: 0}},
+	}
+
+	gen5x16, err := ThroughputGBps("5.0", 16)
+	h.Is(hammy.NilError(err))
+
+	rollups := NUMARollup(devices)
+	h.Is(hammy.Number(len(rollups)).EqualTo(1))
+	h.Is(hammy.Number(rollups[0].Endpoints).EqualTo(2))
+	h.Is(hammy.Number(rollups[0].ThroughputGBps).Within(gen5x16, 0.00001))
+}
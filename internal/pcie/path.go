@@ -0,0 +1,85 @@
+package pcie
+
+import (
+	"math"
+	"strings"
+)
+
+// PathLink summarises the links between an endpoint and the top of its
+// topology branch (normally a root port). Speed and width minimums are taken
+// independently, so they may come from different hops.
+type PathLink struct {
+	MinSpeedGTps   float64
+	MinWidth       int
+	ThroughputGBps float64
+	// LimitingDevice is the address of the hop with the lowest theoretical
+	// throughput. Ties go to the hop closest to the endpoint.
+	LimitingDevice string
+	Hops           int
+}
+
+// resolvePaths fills Device.Path for every non-bridge device other than SR-IOV
+// virtual functions by walking Parent links through the devices that have
+// link data. Hops whose speed or width cannot be mapped to the bandwidth table
+// are skipped for throughput.
+func resolvePaths(devices []Device) {
+	byAddress := indexByAddress(devices)
+	for i := range devices {
+		if isBridgeClass(devices[i].Class) || devices[i].SRIOV.IsVF() {
+			continue
+		}
+
+		path := PathLink{
+			MinSpeedGTps:   math.Inf(1),
+			MinWidth:       math.MaxInt,
+			ThroughputGBps: math.Inf(1),
+		}
+		visited := make(map[int]bool)
+		for j := i; ; {
+			visited[j] = true
+			hop := devices[j]
+			path.Hops++
+
+			speed, speedParsed := parseLeadingFloat(hop.CurrentLinkSpeed)
+			if speedParsed && speed < path.MinSpeedGTps {
+				path.MinSpeedGTps = speed
+			}
+			width, widthParsed := parseFirstInt(hop.CurrentLinkWidth)
+			if widthParsed && width < path.MinWidth {
+				path.MinWidth = width
+			}
+			throughput, ok := LinkThroughputGBps(hop.CurrentLinkSpeed, hop.CurrentLinkWidth)
+			if ok && throughput < path.ThroughputGBps {
+				path.ThroughputGBps = throughput
+				path.LimitingDevice = hop.Address
+			}
+
+			next, ok := byAddress[hop.Parent]
+			if !ok || visited[next] {
+				break
+			}
+			j = next
+		}
+
+		if path.LimitingDevice == "" {
+			continue
+		}
+		devices[i].Path = &path
+	}
+}
+
+// indexByAddress maps lower-cased device addresses, the form used by
+// Device.Parent, to slice positions.
+func indexByAddress(devices []Device) map[string]int {
+	byAddress := make(map[string]int, len(devices))
+	for i := range devices {
+		byAddress[strings.ToLower(devices[i].Address)] = i
+	}
+	return byAddress
+}
+
+// isBridgeClass reports whether a sysfs class value is a PCI-to-PCI bridge
+// (base class 0x06, subclass 0x04), which covers root ports and switch ports.
+func isBridgeClass(class string) bool {
+	return strings.HasPrefix(strings.ToLower(strings.TrimSpace(class)), "0x0604")
+}
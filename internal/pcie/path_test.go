@@ -0,0 +1,62 @@
+package pcie
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/gogunit/gunit/hammy"
+)
+
+func TestReadDevicesResolvesPathBottleneck(t *testing.T) {
+	h := hammy.New(t)
+
+	sysfsRoot := t.TempDir()
+	rootPort := filepath.Join(sysfsRoot, "devices", "pci0000:00", "0000:00:01.0")
+	upstream := filepath.Join(rootPort, "0000:01:00.0")
+	downstream := filepath.Join(upstream, "0000:02:00.0")
+	gpu := filepath.Join(downstream, "0000:03:00.0")
+
+	writeLinkFixture(t, rootPort, "0x060400", "16.0 GT/s PCIe", "8", "16.0 GT/s PCIe", "8")
+	writeLinkFixture(t, upstream, "0x060400", "16.0 GT/s PCIe", "8", "16.0 GT/s PCIe", "8")
+	writeLinkFixture(t, downstream, "0x060400", "16.0 GT/s PCIe", "16", "16.0 GT/s PCIe", "16")
+	writeLinkFixture(t, gpu, "0x030200", "16.0 GT/s PCIe", "16", "16.0 GT/s PCIe", "16")
+	linkBusDevices(t, sysfsRoot, rootPort, upstream, downstream, gpu)
+
+	devices, _, err := ReadDevices(sysfsRoot)
+	h.Is(hammy.NilError(err))
+	h.Is(hammy.Number(len(devices)).EqualTo(4))
+
+	h.Is(hammy.String(devices[3].Address).EqualTo("0000:03:00.0"))
+	h.Is(hammy.String(devices[3].Parent).EqualTo("0000:02:00.0"))
+	h.Is(hammy.True(devices[3].NegotiatedOK))
+
+	path := devices[3].Path
+	h.Is(hammy.NotNil(path))
+	h.Is(hammy.String(path.LimitingDevice).EqualTo("0000:01:00.0"))
+	h.Is(hammy.Number(path.MinWidth).EqualTo(8))
+	h.Is(hammy.Number(path.MinSpeedGTps).Within(16.0, 0.000001))
+	h.Is(hammy.Number(path.ThroughputGBps).Within(15.753848, 0.000001))
+	h.Is(hammy.Number(path.Hops).EqualTo(4))
+
+	h.Is(hammy.Nil(devices[0].Path))
+	h.Is(hammy.Nil(devices[1].Path))
+}
+
+func writeLinkFixture(t *testing.T, devicePath, class, currentSpeed, currentWidth, maxSpeed, maxWidth string) {
+	t.Helper()
+	mustMkdirAll(t, devicePath)
+	mustWriteFile(t, filepath.Join(devicePath, "class"), class+"\n")
+	mustWriteFile(t, filepath.Join(devicePath, "current_link_speed"), currentSpeed+"\n")
+	mustWriteFile(t, filepath.Join(devicePath, "current_link_width"), currentWidth+"\n")
+	mustWriteFile(t, filepath.Join(devicePath, "max_link_speed"), maxSpeed+"\n")
+	mustWriteFile(t, filepath.Join(devicePath, "max_link_width"), maxWidth+"\n")
+}
+
+func linkBusDevices(t *testing.T, sysfsRoot string, devicePaths ...string) {
+	t.Helper()
+	busDevices := filepath.Join(sysfsRoot, "bus", "pci", "devices")
+	mustMkdirAll(t, busDevices)
+	for _, devicePath := range devicePaths {
+		mustSymlink(t, devicePath, filepath.Join(busDevices, filepath.Base(devicePath)))
+	}
+}
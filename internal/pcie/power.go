@@ -0,0 +1,200 @@
+package pcie
+
+import (
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// linkControlFiles are the per-link power management controls the kernel
+// exposes under <bdf>/link/ (Linux 5.5+). Each holds "0" or "1".
+var linkControlFiles = []string{"l0s_aspm", "l1_aspm", "l1_1_aspm", "l1_2_aspm", "clkpm"}
+
+// LinkControl is one enabled/disabled control from <bdf>/link/.
+type LinkControl struct {
+	Name    string `json:"name"`
+	Enabled bool   `json:"enabled"`
+}
+
+// ASPMState returns the ASPM state the control enables, e.g. "l1_2" for
+// l1_2_aspm, or false for controls that are not ASPM states such as clkpm.
+func (c LinkControl) ASPMState() (string, bool) {
+	return strings.CutSuffix(c.Name, "_aspm")
+}
+
+// PowerInfo describes the power management state of a device. Empty values
+// mean the kernel does not expose the corresponding file.
+type PowerInfo struct {
+	// RuntimeStatus is power/runtime_status, e.g. active or suspended.
+	RuntimeStatus string
+	// PowerState is power_state (Linux 5.11+), e.g. D0 or D3hot.
+	PowerState   string
+	LinkControls []LinkControl
+}
+
+// LowPower reports whether the device is runtime suspended or outside D0.
+// ASPM does not count: L0s and L1 never lower the negotiated speed, so an
+// enabled ASPM control says nothing about a slow link.
+func (p PowerInfo) LowPower() bool {
+	switch p.RuntimeStatus {
+	case "suspended", "suspending":
+		return true
+	}
+	return p.PowerState != "" && p.PowerState != "D0"
+}
+
+func readPowerInfo(devicePath, address string) (PowerInfo, error) {
+	var info PowerInfo
+	var err error
+
+	info.RuntimeStatus, _, err = readOptionalTrim(filepath.Join(devicePath, "power", "runtime_status"))
+	if err != nil {
+		return PowerInfo{}, &DeviceError{Address: address, Op: "read", File: "power/runtime_status", Err: err}
+	}
+	info.PowerState, _, err = readOptionalTrim(filepath.Join(devicePath, "power_state"))
+	if err != nil {
+		return PowerInfo{}, &DeviceError{Address: address, Op: "read", File: "power_state", Err: err}
+	}
+
+	info.LinkControls, err = readLinkControls(devicePath, address)
+	if err != nil {
+		return PowerInfo{}, err
+	}
+	return info, nil
+}
+
+func readLinkControls(devicePath, address string) ([]LinkControl, error) {
+	var controls []LinkControl
+	for _, name := range linkControlFiles {
+		value, ok, err := readOptionalTrim(filepath.Join(devicePath, "link", name))
+		if err != nil {
+			return nil, &DeviceError{Address: address, Op: "read", File: "link/" + name, Err: err}
+		}
+		if !ok {
+			continue
+		}
+		controls = append(controls, LinkControl{Name: name, Enabled: value == "1"})
+	}
+	return controls, nil
+}
+
+type speedSample struct {
+	at        time.Time
+	speedGTps float64
+}
+
+// SpeedHistory tracks negotiated link speeds per device over a sliding window.
+// It is safe for concurrent use.
+type SpeedHistory struct {
+	window  time.Duration
+	mu      sync.Mutex
+	samples map[string][]speedSample
+}
+
+func NewSpeedHistory(window time.Duration) *SpeedHistory {
+	return &SpeedHistory{
+		window:  window,
+		samples: make(map[string][]speedSample),
+	}
+}
+
+// Observe records the current speed of every device and forgets devices that
+// are no longer present.
+func (s *SpeedHistory) Observe(devices []Device, now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	seen := make(map[string]bool, len(devices))
+	cutoff := now.Add(-s.window)
+	for _, device := range devices {
+		seen[device.Address] = true
+
+		samples := s.samples[device.Address]
+		kept := samples[:0]
+		for _, sample := range samples {
+			if !sample.at.Before(cutoff) {
+				kept = append(kept, sample)
+			}
+		}
+		if speed, ok := parseLeadingFloat(device.CurrentLinkSpeed); ok {
+			kept = append(kept, speedSample{at: now, speedGTps: speed})
+		}
+		s.samples[device.Address] = kept
+	}
+
+	for address := range s.samples {
+		if !seen[address] {
+			delete(s.samples, address)
+		}
+	}
+}
+
+// MaxSpeed returns the highest speed observed for address within the window.
+func (s *SpeedHistory) MaxSpeed(address string) (float64, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	samples := s.samples[address]
+	if len(samples) == 0 {
+		return 0, false
+	}
+	highest := samples[0].speedGTps
+	for _, sample := range samples[1:] {
+		highest = max(highest, sample.speedGTps)
+	}
+	return highest, true
+}
+
+// ApplyPowerManagement reclassifies speed-only degradations as power managed
+// when the device is in a low-power state or, with a non-nil history, reached
+// its maximum speed within the history window. GPUs drop to Gen1 while idle
+// and retrain on demand, so such links are reported as negotiated OK.
+// Width reductions are never treated as power management. The root or
+// downstream port above a reclassified device reports the same link, so it
+// is reclassified with it.
+func ApplyPowerManagement(devices []Device, history *SpeedHistory) {
+	var managed []*Device
+	for i := range devices {
+		device := &devices[i]
+		if device.DegradationReason != DegradationMistrainedSpeed {
+			continue
+		}
+
+		powerManaged := device.Power.LowPower()
+		if !powerManaged && history != nil {
+			observed, ok := history.MaxSpeed(device.Address)
+			maxSpeed, maxOK := parseLeadingFloat(device.MaxLinkSpeed)
+			powerManaged = ok && maxOK && observed+1e-9 >= maxSpeed
+		}
+		if !powerManaged {
+			continue
+		}
+
+		markPowerManaged(device)
+		managed = append(managed, device)
+	}
+	if len(managed) == 0 {
+		return
+	}
+
+	byAddress := make(map[string]*Device, len(devices))
+	for i := range devices {
+		byAddress[devices[i].Address] = &devices[i]
+	}
+	for _, device := range managed {
+		parent, ok := byAddress[device.Parent]
+		if !ok || parent.DegradationReason != DegradationMistrainedSpeed {
+			continue
+		}
+		if parent.CurrentLinkSpeed != device.CurrentLinkSpeed {
+			continue
+		}
+		markPowerManaged(parent)
+	}
+}
+
+func markPowerManaged(device *Device) {
+	device.DegradationReason = DegradationPowerManaged
+	device.NegotiatedOK = true
+}
@@ -0,0 +1,133 @@
+package pcie
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gogunit/gunit/hammy"
+)
+
+func TestReadPowerInfo(t *testing.T) {
+	h := hammy.New(t)
+
+	devicePath := t.TempDir()
+	mustMkdirAll(t, filepath.Join(devicePath, "power"))
+	mustMkdirAll(t, filepath.Join(devicePath, "link"))
+	mustWriteFile(t, filepath.Join(devicePath, "power", "runtime_status"), "active\n")
+	mustWriteFile(t, filepath.Join(devicePath, "power_state"), "D0\n")
+	mustWriteFile(t, filepath.Join(devicePath, "link", "l0s_aspm"), "0\n")
+	mustWriteFile(t, filepath.Join(devicePath, "link", "l1_aspm"), "1\n")
+	mustWriteFile(t, filepath.Join(devicePath, "link", "clkpm"), "1\n")
+
+	info, err := readPowerInfo(devicePath, "0000:01:00.0")
+	h.Is(hammy.NilError(err))
+	h.Is(hammy.String(info.RuntimeStatus).EqualTo("active"))
+	h.Is(hammy.String(info.PowerState).EqualTo("D0"))
+	h.Is(hammy.Slice(info.LinkControls).EqualTo(
+		LinkControl{Name: "l0s_aspm", Enabled: false},
+		LinkControl{Name: "l1_aspm", Enabled: true},
+		LinkControl{Name: "clkpm", Enabled: true},
+	))
+	h.Is(hammy.False(info.LowPower()))
+}
+
+func TestPowerInfoLowPower(t *testing.T) {
+	h := hammy.New(t)
+
+	h.Is(hammy.False(PowerInfo{}.LowPower()))
+	h.Is(hammy.False(PowerInfo{RuntimeStatus: "active", PowerState: "D0"}.LowPower()))
+	h.Is(hammy.True(PowerInfo{RuntimeStatus: "suspended"}.LowPower()))
+	h.Is(hammy.True(PowerInfo{PowerState: "D3hot"}.LowPower()))
+	h.Is(hammy.False(PowerInfo{LinkControls: []LinkControl{{Name: "clkpm", Enabled: true}}}.LowPower()))
+	h.Is(hammy.False(PowerInfo{LinkControls: []LinkControl{{Name: "l1_aspm", Enabled: true}}}.LowPower()))
+}
+
+func TestApplyPowerManagementIgnoresASPM(t *testing.T) {
+	h := hammy.New(t)
+
+	devices := []Device{idleGPU("0000:01:00.0", PowerInfo{
+		RuntimeStatus: "active",
+		PowerState:    "D0",
+		LinkControls:  []LinkControl{{Name: "l1_aspm", Enabled: true}},
+	})}
+	ApplyPowerManagement(devices, nil)
+
+	h.Is(hammy.String(devices[0].DegradationReason).EqualTo(DegradationMistrainedSpeed))
+	h.Is(hammy.False(devices[0].NegotiatedOK))
+}
+
+func TestApplyPowerManagementLowPowerState(t *testing.T) {
+	h := hammy.New(t)
+
+	devices := []Device{
+		idleGPU("0000:01:00.0", PowerInfo{RuntimeStatus: "suspended"}),
+		idleGPU("0000:02:00.0", PowerInfo{RuntimeStatus: "active"}),
+	}
+	ApplyPowerManagement(devices, nil)
+
+	h.Is(hammy.String(devices[0].DegradationReason).EqualTo(DegradationPowerManaged))
+	h.Is(hammy.True(devices[0].NegotiatedOK))
+	h.Is(hammy.String(devices[1].DegradationReason).EqualTo(DegradationMistrainedSpeed))
+	h.Is(hammy.False(devices[1].NegotiatedOK))
+}
+
+func TestApplyPowerManagementReclassifiesParentPort(t *testing.T) {
+	h := hammy.New(t)
+
+	rootPort := idleGPU("0000:00:01.0", PowerInfo{RuntimeStatus: "active"})
+	otherPort := idleGPU("0000:00:02.0", PowerInfo{RuntimeStatus: "active"})
+	gpu := idleGPU("0000:01:00.0", PowerInfo{RuntimeStatus: "suspended"})
+	gpu.Parent = rootPort.Address
+	nic := idleGPU("0000:02:00.0", PowerInfo{RuntimeStatus: "active"})
+	nic.Parent = otherPort.Address
+	devices := []Device{rootPort, otherPort, gpu, nic}
+	ApplyPowerManagement(devices, nil)
+
+	h.Is(hammy.String(devices[0].DegradationReason).EqualTo(DegradationPowerManaged))
+	h.Is(hammy.True(devices[0].NegotiatedOK))
+	h.Is(hammy.String(devices[1].DegradationReason).EqualTo(DegradationMistrainedSpeed))
+	h.Is(hammy.String(devices[2].DegradationReason).EqualTo(DegradationPowerManaged))
+	h.Is(hammy.String(devices[3].DegradationReason).EqualTo(DegradationMistrainedSpeed))
+}
+
+func TestApplyPowerManagementSpeedHistory(t *testing.T) {
+	h := hammy.New(t)
+
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	history := NewSpeedHistory(5 * time.Minute)
+
+	busy := idleGPU("0000:01:00.0", PowerInfo{RuntimeStatus: "active"})
+	busy.CurrentLinkSpeed = "32.0 GT/s PCIe"
+	history.Observe([]Device{busy}, start)
+
+	devices := []Device{idleGPU("0000:01:00.0", PowerInfo{RuntimeStatus: "active"})}
+	history.Observe(devices, start.Add(time.Minute))
+	ApplyPowerManagement(devices, history)
+	h.Is(hammy.String(devices[0].DegradationReason).EqualTo(DegradationPowerManaged))
+
+	observed, ok := history.MaxSpeed("0000:01:00.0")
+	h.Is(hammy.True(ok))
+	h.Is(hammy.Number(observed).Within(32.0, 0.000001))
+
+	devices = []Device{idleGPU("0000:01:00.0", PowerInfo{RuntimeStatus: "active"})}
+	history.Observe(devices, start.Add(10*time.Minute))
+	ApplyPowerManagement(devices, history)
+	h.Is(hammy.String(devices[0].DegradationReason).EqualTo(DegradationMistrainedSpeed))
+
+	history.Observe(nil, start.Add(11*time.Minute))
+	_, ok = history.MaxSpeed("0000:01:00.0")
+	h.Is(hammy.False(ok))
+}
+
+func idleGPU(address string, power PowerInfo) Device {
+	return Device{
+		Address:           address,
+		CurrentLinkSpeed:  "2.5 GT/s PCIe",
+		MaxLinkSpeed:      "32.0 GT/s PCIe",
+		CurrentLinkWidth:  "16",
+		MaxLinkWidth:      "16",
+		DegradationReason: DegradationMistrainedSpeed,
+		Power:             power,
+	}
+}
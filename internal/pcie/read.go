@@ -0,0 +1,137 @@
+package pcie
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ReadDevicesAndTree walks sysfsRoot/bus/pci/devices once and returns the
+// devices ReadDevices would return and the tree ReadTree would build. Tree
+// nodes are built from the same reads as the devices, so the two agree on
+// every device's identity and link. A device that fails to read is left out
+// of the device list and kept in the tree with Error set; its errors are
+// reported once.
+func ReadDevicesAndTree(sysfsRoot string) ([]Device, []*TreeNode, []DeviceError, error) {
+	devicesPath := filepath.Join(sysfsRoot, "bus", "pci", "devices")
+	entries, err := os.ReadDir(devicesPath)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("read pci devices from %s: %w", devicesPath, err)
+	}
+
+	var deviceErrs []DeviceError
+	slots, slotsErr := readSlots(sysfsRoot)
+	if slotsErr != nil {
+		deviceErrs = append(deviceErrs, *slotsErr)
+	}
+
+	devices := make([]Device, 0, len(entries))
+	nodes := make(map[string]*TreeNode, len(entries))
+	parents := make(map[string]string, len(entries))
+	for _, entry := range entries {
+		address := strings.ToLower(entry.Name())
+		devicePath := filepath.Join(devicesPath, entry.Name())
+
+		device, ok, node, errs := readDeviceAndNode(devicePath, entry.Name(), slots)
+		deviceErrs = append(deviceErrs, errs...)
+		if ok {
+			devices = append(devices, device)
+		}
+		nodes[address] = node
+
+		// A VF sits below its PF rather than beside it.
+		if node.SRIOV.IsVF() {
+			parents[address] = node.SRIOV.PhysFn
+			continue
+		}
+		parentAddress := device.Parent
+		if !ok {
+			parentAddress, err = resolveParentAddress(devicePath, address)
+			if err != nil {
+				deviceErrs = append(deviceErrs, asDeviceError(address, err))
+				if node.Error == "" {
+					node.Error = err.Error()
+				}
+				continue
+			}
+		}
+		if parentAddress != "" {
+			parents[address] = parentAddress
+		}
+	}
+
+	resolveDevices(devices)
+	return devices, buildTree(nodes, parents), deviceErrs, nil
+}
+
+// readDeviceAndNode reads one device directory. device is only set when ok
+// is true; node is always set and carries Error when the device failed to
+// read. errs holds every failed read, including those of informational
+// attributes that leave the device in place.
+func readDeviceAndNode(devicePath, address string, slots map[string]Slot) (device Device, ok bool, node *TreeNode, errs []DeviceError) {
+	lowerAddress := strings.ToLower(address)
+	device, ok, errs, err := readDevice(devicePath, address, slots)
+	if err != nil {
+		// The device list drops the device, but the tree keeps whatever can
+		// still be read so its position stays visible.
+		errs = append(errs, asDeviceError(lowerAddress, err))
+		node, partialErrs, nodeErr := readTreeNode(devicePath, lowerAddress, slots)
+		if nodeErr != nil {
+			return Device{}, false, failedTreeNode(lowerAddress, err), errs
+		}
+		node.Error = err.Error()
+		return Device{}, false, node, append(errs, partialErrs...)
+	}
+	if !ok {
+		// Entries without link information are not devices, but are still
+		// part of the topology.
+		node, partialErrs, err := readTreeNode(devicePath, lowerAddress, slots)
+		errs = append(errs, partialErrs...)
+		if err != nil {
+			return Device{}, false, failedTreeNode(lowerAddress, err), append(errs, asDeviceError(lowerAddress, err))
+		}
+		return Device{}, false, node, errs
+	}
+
+	node, err = treeNodeFromDevice(devicePath, lowerAddress, device)
+	if err != nil {
+		errs = append(errs, asDeviceError(lowerAddress, err))
+		node = failedTreeNode(lowerAddress, err)
+	}
+	return device, true, node, errs
+}
+
+// treeNodeFromDevice builds the tree node for device, reading only the
+// firmware label the Device does not carry.
+func treeNodeFromDevice(devicePath, address string, device Device) (*TreeNode, error) {
+	id := identity{
+		vendorID:          device.VendorID,
+		deviceID:          device.DeviceID,
+		class:             device.Class,
+		subsystemVendorID: device.SubsystemVendorID,
+		subsystemDeviceID: device.SubsystemDeviceID,
+	}
+	name, err := readDeviceName(devicePath, address, id, device.Driver)
+	if err != nil {
+		return nil, err
+	}
+	return &TreeNode{
+		BusID:             address,
+		Name:              name,
+		LinkCapacity:      formatLinkSummary(device.MaxLinkSpeed, device.MaxLinkWidth),
+		LinkStatus:        formatLinkSummary(device.CurrentLinkSpeed, device.CurrentLinkWidth),
+		VendorID:          device.VendorID,
+		DeviceID:          device.DeviceID,
+		Class:             device.Class,
+		SubsystemVendorID: device.SubsystemVendorID,
+		SubsystemDeviceID: device.SubsystemDeviceID,
+		Driver:            device.Driver,
+		Slot:              device.Slot,
+		PhysicalSlot:      device.PhysicalSlot,
+		OSBindings:        device.OSBindings,
+		NUMAAffinity:      device.NUMA,
+		SRIOV:             device.SRIOV,
+		LinkControls:      device.Power.LinkControls,
+	}, nil
+}
@@ -0,0 +1,59 @@
+package pcie
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"testing"
+
+	"github.com/gogunit/gunit/hammy"
+)
+
+func TestReadDevicesAndTreeMatchesSeparateReads(t *testing.T) {
+	h := hammy.New(t)
+
+	sysfsRoot := filepath.Join("testdata", "sysfs")
+	devices, tree, deviceErrs, err := ReadDevicesAndTree(sysfsRoot)
+	h.Is(hammy.NilError(err))
+	h.Is(hammy.Slice(deviceErrs).IsEmpty())
+
+	wantDevices, _, err := ReadDevices(sysfsRoot)
+	h.Is(hammy.NilError(err))
+	wantTree, _, err := ReadTree(sysfsRoot)
+	h.Is(hammy.NilError(err))
+	h.Is(hammy.String(mustJSON(t, devices)).EqualTo(mustJSON(t, wantDevices)))
+	h.Is(hammy.String(mustJSON(t, tree)).EqualTo(mustJSON(t, wantTree)))
+}
+
+func TestReadDevicesAndTreeKeepsFailedDeviceInTree(t *testing.T) {
+	h := hammy.New(t)
+
+	sysfsRoot := t.TempDir()
+	rootPort := filepath.Join(sysfsRoot, "devices", "pci0000:00", "0000:00:01.0")
+	gpu := filepath.Join(rootPort, "0000:01:00.0")
+	writeLinkFixture(t, rootPort, "0x060400", "16.0 GT/s PCIe", "16", "16.0 GT/s PCIe", "16")
+	writeLinkFixture(t, gpu, "0x030200", "16.0 GT/s PCIe", "16", "16.0 GT/s PCIe", "16")
+	mustMkdirAll(t, filepath.Join(gpu, "aer_dev_correctable"))
+	linkBusDevices(t, sysfsRoot, rootPort, gpu)
+
+	devices, tree, deviceErrs, err := ReadDevicesAndTree(sysfsRoot)
+	h.Is(hammy.NilError(err))
+	h.Is(hammy.Number(len(deviceErrs)).EqualTo(1))
+	h.Is(hammy.String(deviceErrs[0].File).EqualTo("aer_dev_correctable"))
+	h.Is(hammy.Number(len(devices)).EqualTo(1))
+	h.Is(hammy.String(devices[0].Address).EqualTo("0000:00:01.0"))
+
+	h.Is(hammy.Number(len(tree)).EqualTo(1))
+	h.Is(hammy.Number(len(tree[0].Children)).EqualTo(1))
+	failed := tree[0].Children[0]
+	h.Is(hammy.String(failed.BusID).EqualTo("0000:01:00.0"))
+	h.Is(hammy.String(failed.Class).EqualTo("0x030200"))
+	h.Is(hammy.String(failed.Error).Contains("aer_dev_correctable"))
+}
+
+func mustJSON(t *testing.T, value any) string {
+	t.Helper()
+	h := hammy.New(t)
+	encoded, err := json.Marshal(value)
+	h.Is(hammy.NilError(err))
+	return string(encoded)
+}
@@ -0,0 +1,123 @@
+package pcie
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Slot sources.
+const (
+	// SlotSourceBus is a slot registered in bus/pci/slots by a hotplug or
+	// ACPI slot driver.
+	SlotSourceBus = "bus"
+	// SlotSourceLabel is the firmware (SMBIOS or ACPI _DSM) label of the
+	// device, used when no registered slot covers it.
+	SlotSourceLabel = "label"
+)
+
+// Slot is the physical slot a device sits in, named the way it is printed on
+// the chassis or board.
+type Slot struct {
+	Name   string `json:"name"`
+	Source string `json:"source"`
+	// Power and Attention are the hotplug power state and attention
+	// indicator (0 off, 1 on, 2 blinking), nil when the slot driver does
+	// not expose them.
+	Power       *int   `json:"power,omitempty"`
+	Attention   *int   `json:"attention,omitempty"`
+	MaxBusSpeed string `json:"max_bus_speed,omitempty"`
+	CurBusSpeed string `json:"cur_bus_speed,omitempty"`
+}
+
+// readSlots maps a slot address ("dddd:bb:dd", without the function) to the
+// slot from sysfsRoot/bus/pci/slots/<name>. Hosts without slot drivers have
+// no slots directory, which yields an empty map. A slot whose address cannot
+// be read is skipped, as are state files that cannot be read or parsed. Slot
+// names are informational, so an unreadable slots directory also yields an
+// empty map, along with a DeviceError without an address for the caller to
+// report.
+func readSlots(sysfsRoot string) (map[string]Slot, *DeviceError) {
+	slotsPath := filepath.Join(sysfsRoot, "bus", "pci", "slots")
+	entries, err := os.ReadDir(slotsPath)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return map[string]Slot{}, nil
+		}
+		return map[string]Slot{}, &DeviceError{Op: "read", File: "slots", Err: err}
+	}
+
+	slots := make(map[string]Slot, len(entries))
+	for _, entry := range entries {
+		slotPath := filepath.Join(slotsPath, entry.Name())
+		address, ok, err := readOptionalTrim(filepath.Join(slotPath, "address"))
+		if err != nil || !ok || address == "" {
+			continue
+		}
+		slot := Slot{
+			Name:        entry.Name(),
+			Source:      SlotSourceBus,
+			Power:       readSlotIndicator(filepath.Join(slotPath, "power")),
+			Attention:   readSlotIndicator(filepath.Join(slotPath, "attention")),
+			MaxBusSpeed: readSlotValue(filepath.Join(slotPath, "max_bus_speed")),
+			CurBusSpeed: readSlotValue(filepath.Join(slotPath, "cur_bus_speed")),
+		}
+		slots[strings.ToLower(address)] = slot
+	}
+	return slots, nil
+}
+
+// deviceSlot returns the registered slot covering address, falling back to
+// the device's firmware label. It returns nil when neither exists.
+func deviceSlot(devicePath, address string, slots map[string]Slot) (*Slot, error) {
+	if slot, ok := slots[slotAddress(address)]; ok {
+		return &slot, nil
+	}
+	label, ok, err := readOptionalTrim(filepath.Join(devicePath, "label"))
+	if err != nil {
+		return nil, &DeviceError{Address: address, Op: "read", File: "label", Err: err}
+	}
+	if !ok || label == "" {
+		return nil, nil
+	}
+	return &Slot{Name: label, Source: SlotSourceLabel}, nil
+}
+
+func readSlotIndicator(path string) *int {
+	value := readSlotValue(path)
+	if value == "" {
+		return nil
+	}
+	parsed, err := strconv.Atoi(value)
+	if err != nil {
+		return nil
+	}
+	return &parsed
+}
+
+func readSlotValue(path string) string {
+	value, ok, err := readOptionalTrim(path)
+	if err != nil || !ok {
+		return ""
+	}
+	return value
+}
+
+// slotAddress strips the function number from a device address.
+func slotAddress(address string) string {
+	if i := strings.LastIndexByte(address, '.'); i >= 0 {
+		address = address[:i]
+	}
+	return strings.ToLower(address)
+}
+
+// slotName returns the name of slot, or an empty string when it is nil.
+func slotName(slot *Slot) string {
+	if slot == nil {
+		return ""
+	}
+	return slot.Name
+}
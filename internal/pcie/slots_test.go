@@ -0,0 +1,99 @@
+package pcie
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/gogunit/gunit/hammy"
+)
+
+func TestReadDevicesReadsDriverAndSlot(t *testing.T) {
+	h := hammy.New(t)
+
+	sysfsRoot := t.TempDir()
+	nicPath := filepath.Join(sysfsRoot, "devices", "pci0000:00", "0000:17:00.1")
+	writeLinkFixture(t, nicPath, "0x020000", "16.0 GT/s PCIe", "8", "16.0 GT/s PCIe", "8")
+	driverPath := filepath.Join(sysfsRoot, "bus", "pci", "drivers", "mlx5_core")
+	mustMkdirAll(t, driverPath)
+	mustSymlink(t, driverPath, filepath.Join(nicPath, "driver"))
+	mustMkdirAll(t, filepath.Join(sysfsRoot, "bus", "pci", "slots", "7"))
+	mustWriteFile(t, filepath.Join(sysfsRoot, "bus", "pci", "slots", "7", "address"), "0000:17:00\n")
+	linkBusDevices(t, sysfsRoot, nicPath)
+
+	devices, deviceErrs, err := ReadDevices(sysfsRoot)
+	h.Is(hammy.NilError(err))
+	h.Is(hammy.Number(len(deviceErrs)).EqualTo(0))
+	h.Is(hammy.Number(len(devices)).EqualTo(1))
+	h.Is(hammy.String(devices[0].Driver).EqualTo("mlx5_core"))
+	h.Is(hammy.String(devices[0].Slot).EqualTo("7"))
+}
+
+func TestReadDevicesFallsBackToSlotLabel(t *testing.T) {
+	h := hammy.New(t)
+
+	sysfsRoot := t.TempDir()
+	hotplug := filepath.Join(sysfsRoot, "devices", "pci0000:00", "0000:17:00.0")
+	onboard := filepath.Join(sysfsRoot, "devices", "pci0000:00", "0000:18:00.0")
+	bare := filepath.Join(sysfsRoot, "devices", "pci0000:00", "0000:19:00.0")
+	writeLinkFixture(t, hotplug, "0x020000", "16.0 GT/s PCIe", "8", "16.0 GT/s PCIe", "8")
+	writeLinkFixture(t, onboard, "0x020000", "16.0 GT/s PCIe", "8", "16.0 GT/s PCIe", "8")
+	writeLinkFixture(t, bare, "0x020000", "16.0 GT/s PCIe", "8", "16.0 GT/s PCIe", "8")
+	mustWriteFile(t, filepath.Join(hotplug, "label"), "NIC1\n")
+	mustWriteFile(t, filepath.Join(onboard, "label"), "Onboard LAN 1\n")
+	slotPath := filepath.Join(sysfsRoot, "bus", "pci", "slots", "4")
+	mustMkdirAll(t, slotPath)
+	mustWriteFile(t, filepath.Join(slotPath, "address"), "0000:17:00\n")
+	mustWriteFile(t, filepath.Join(slotPath, "power"), "1\n")
+	mustWriteFile(t, filepath.Join(slotPath, "attention"), "2\n")
+	mustWriteFile(t, filepath.Join(slotPath, "cur_bus_speed"), "16.0 GT/s PCIe\n")
+	linkBusDevices(t, sysfsRoot, hotplug, onboard, bare)
+
+	devices, deviceErrs, err := ReadDevices(sysfsRoot)
+	h.Is(hammy.NilError(err))
+	h.Is(hammy.Slice(deviceErrs).IsEmpty())
+	h.Is(hammy.Number(len(devices)).EqualTo(3))
+
+	h.Is(hammy.String(devices[0].Slot).EqualTo("4"))
+	h.Is(hammy.String(devices[0].PhysicalSlot.Source).EqualTo(SlotSourceBus))
+	h.Is(hammy.Number(*devices[0].PhysicalSlot.Power).EqualTo(1))
+	h.Is(hammy.Number(*devices[0].PhysicalSlot.Attention).EqualTo(2))
+	h.Is(hammy.String(devices[0].PhysicalSlot.CurBusSpeed).EqualTo("16.0 GT/s PCIe"))
+	h.Is(hammy.String(devices[0].PhysicalSlot.MaxBusSpeed).EqualTo(""))
+
+	h.Is(hammy.String(devices[1].Slot).EqualTo("Onboard LAN 1"))
+	h.Is(hammy.String(devices[1].PhysicalSlot.Source).EqualTo(SlotSourceLabel))
+	h.Is(hammy.Nil(devices[1].PhysicalSlot.Power))
+
+	h.Is(hammy.String(devices[2].Slot).EqualTo(""))
+	h.Is(hammy.Nil(devices[2].PhysicalSlot))
+}
+
+func TestReadDevicesContinuesWithoutSlots(t *testing.T) {
+	h := hammy.New(t)
+
+	sysfsRoot := t.TempDir()
+	gpu := filepath.Join(sysfsRoot, "devices", "pci0000:00", "0000:01:00.0")
+	writeLinkFixture(t, gpu, "0x030200", "16.0 GT/s PCIe", "16", "16.0 GT/s PCIe", "16")
+	linkBusDevices(t, sysfsRoot, gpu)
+	// A file where the slots directory should be makes the listing fail.
+	mustWriteFile(t, filepath.Join(sysfsRoot, "bus", "pci", "slots"), "")
+
+	devices, deviceErrs, err := ReadDevices(sysfsRoot)
+	h.Is(hammy.NilError(err))
+	h.Is(hammy.Number(len(devices)).EqualTo(1))
+	h.Is(hammy.String(devices[0].Slot).EqualTo(""))
+	h.Is(hammy.Number(len(deviceErrs)).EqualTo(1))
+	h.Is(hammy.String(deviceErrs[0].Address).EqualTo(""))
+	h.Is(hammy.String(deviceErrs[0].File).EqualTo("slots"))
+
+	tree, deviceErrs, err := ReadTree(sysfsRoot)
+	h.Is(hammy.NilError(err))
+	h.Is(hammy.Number(len(tree)).EqualTo(1))
+	h.Is(hammy.Number(len(deviceErrs)).EqualTo(1))
+
+	devices, tree, deviceErrs, err = ReadDevicesAndTree(sysfsRoot)
+	h.Is(hammy.NilError(err))
+	h.Is(hammy.Number(len(devices)).EqualTo(1))
+	h.Is(hammy.Number(len(tree)).EqualTo(1))
+	h.Is(hammy.Number(len(deviceErrs)).EqualTo(1))
+}
@@ -0,0 +1,113 @@
+package pcie
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// SRIOV describes the SR-IOV role of a function. A physical function (PF)
+// has TotalVFs and VirtFns set; a virtual function (VF) has PhysFn set.
+type SRIOV struct {
+	TotalVFs int `json:"total_vfs,omitempty"`
+	NumVFs   int `json:"num_vfs,omitempty"`
+	// PhysFn is the address of the PF a VF belongs to.
+	PhysFn string `json:"physfn,omitempty"`
+	// VirtFns are the addresses of the enabled VFs, in VF index order.
+	VirtFns []string `json:"virtfns,omitempty"`
+}
+
+// IsVF reports whether the function is an SR-IOV virtual function.
+func (s *SRIOV) IsVF() bool {
+	return s != nil && s.PhysFn != ""
+}
+
+// readSRIOV returns nil for functions that are neither SR-IOV capable nor a VF.
+func readSRIOV(devicePath, address string) (*SRIOV, error) {
+	physFn, err := readLinkBase(filepath.Join(devicePath, "physfn"))
+	if err != nil {
+		return nil, &DeviceError{Address: address, Op: "resolve", File: "physfn", Err: err}
+	}
+	if physFn != "" {
+		return &SRIOV{PhysFn: physFn}, nil
+	}
+
+	total, hasTotal, err := readOptionalInt(devicePath, address, "sriov_totalvfs")
+	if err != nil || !hasTotal {
+		return nil, err
+	}
+	enabled, _, err := readOptionalInt(devicePath, address, "sriov_numvfs")
+	if err != nil {
+		return nil, err
+	}
+	sriov := &SRIOV{TotalVFs: total, NumVFs: enabled}
+
+	links, err := filepath.Glob(filepath.Join(devicePath, "virtfn*"))
+	if err != nil {
+		return nil, err
+	}
+	type virtFn struct {
+		index   int
+		address string
+	}
+	virtFns := make([]virtFn, 0, len(links))
+	for _, link := range links {
+		index, err := strconv.Atoi(strings.TrimPrefix(filepath.Base(link), "virtfn"))
+		if err != nil {
+			continue
+		}
+		vfAddress, err := readLinkBase(link)
+		if err != nil {
+			return nil, &DeviceError{Address: address, Op: "resolve", File: filepath.Base(link), Err: err}
+		}
+		if vfAddress != "" {
+			virtFns = append(virtFns, virtFn{index: index, address: vfAddress})
+		}
+	}
+	sort.Slice(virtFns, func(i, j int) bool {
+		return virtFns[i].index < virtFns[j].index
+	})
+	for _, vf := range virtFns {
+		sriov.VirtFns = append(sriov.VirtFns, vf.address)
+	}
+	return sriov, nil
+}
+
+// isVirtualFunction is a cheap check for a physfn link, for callers that
+// skip VFs without needing the rest of the SR-IOV state.
+func isVirtualFunction(devicePath string) bool {
+	_, err := os.Lstat(filepath.Join(devicePath, "physfn"))
+	return err == nil
+}
+
+// readLinkBase returns the lower-cased last element of a symlink target, or
+// an empty string when the link does not exist.
+func readLinkBase(path string) (string, error) {
+	target, err := os.Readlink(path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return "", nil
+		}
+		return "", err
+	}
+	return strings.ToLower(filepath.Base(target)), nil
+}
+
+func readOptionalInt(devicePath, address, name string) (int, bool, error) {
+	value, ok, err := readOptionalTrim(filepath.Join(devicePath, name))
+	if err != nil {
+		return 0, false, &DeviceError{Address: address, Op: "read", File: name, Err: err}
+	}
+	if !ok {
+		return 0, false, nil
+	}
+	parsed, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, false, &DeviceError{Address: address, Op: "parse", File: name, Err: err}
+	}
+	return parsed, true, nil
+}
@@ -0,0 +1,71 @@
+package pcie
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/gogunit/gunit/hammy"
+)
+
+func TestSRIOVVirtualFunctions(t *testing.T) {
+	h := hammy.New(t)
+
+	sysfsRoot := t.TempDir()
+	rootPort := filepath.Join(sysfsRoot, "devices", "pci0000:00", "0000:00:01.0")
+	pf := filepath.Join(rootPort, "0000:01:00.0")
+	vf0 := filepath.Join(rootPort, "0000:01:00.2")
+	vf1 := filepath.Join(rootPort, "0000:01:00.3")
+
+	writeLinkFixture(t, rootPort, "0x060400", "16.0 GT/s PCIe", "16", "16.0 GT/s PCIe", "16")
+	writeLinkFixture(t, pf, "0x020000", "16.0 GT/s PCIe", "16", "16.0 GT/s PCIe", "16")
+	writeLinkFixture(t, vf0, "0x020000", "16.0 GT/s PCIe", "16", "16.0 GT/s PCIe", "16")
+	writeLinkFixture(t, vf1, "0x020000", "16.0 GT/s PCIe", "16", "16.0 GT/s PCIe", "16")
+	mustWriteFile(t, filepath.Join(pf, "sriov_totalvfs"), "8\n")
+	mustWriteFile(t, filepath.Join(pf, "sriov_numvfs"), "2\n")
+	mustSymlink(t, "../0000:01:00.3", filepath.Join(pf, "virtfn1"))
+	mustSymlink(t, "../0000:01:00.2", filepath.Join(pf, "virtfn0"))
+	mustSymlink(t, "../0000:01:00.0", filepath.Join(vf0, "physfn"))
+	mustSymlink(t, "../0000:01:00.0", filepath.Join(vf1, "physfn"))
+	linkBusDevices(t, sysfsRoot, rootPort, pf, vf0, vf1)
+
+	devices, deviceErrs, err := ReadDevices(sysfsRoot)
+	h.Is(hammy.NilError(err))
+	h.Is(hammy.Slice(deviceErrs).IsEmpty())
+	h.Is(hammy.Number(len(devices)).EqualTo(4))
+	h.Is(hammy.Nil(devices[0].SRIOV))
+	h.Is(hammy.String(devices[1].Address).EqualTo("0000:01:00.0"))
+	h.Is(hammy.Number(devices[1].SRIOV.TotalVFs).EqualTo(8))
+	h.Is(hammy.Number(devices[1].SRIOV.NumVFs).EqualTo(2))
+	h.Is(hammy.Slice(devices[1].SRIOV.VirtFns).EqualTo("0000:01:00.2", "0000:01:00.3"))
+	h.Is(hammy.NotNil(devices[1].Path))
+	h.Is(hammy.String(devices[2].Address).EqualTo("0000:01:00.2"))
+	h.Is(hammy.True(devices[2].SRIOV.IsVF()))
+	h.Is(hammy.Nil(devices[2].Path))
+	h.Is(hammy.String(devices[2].DegradationReason).EqualTo(""))
+	h.Is(hammy.True(devices[3].SRIOV.IsVF()))
+
+	tree, _, err := ReadTree(sysfsRoot)
+	h.Is(hammy.NilError(err))
+	h.Is(hammy.Number(len(tree)).EqualTo(1))
+	h.Is(hammy.Number(len(tree[0].Children)).EqualTo(1))
+	pfNode := tree[0].Children[0]
+	h.Is(hammy.String(pfNode.BusID).EqualTo("0000:01:00.0"))
+	h.Is(hammy.Number(len(pfNode.Children)).EqualTo(2))
+	h.Is(hammy.String(pfNode.Children[0].BusID).EqualTo("0000:01:00.2"))
+	h.Is(hammy.True(pfNode.Children[0].SRIOV.IsVF()))
+	h.Is(hammy.String(pfNode.Children[1].SRIOV.PhysFn).EqualTo("0000:01:00.0"))
+
+	states, _, err := ReadLinkStates(sysfsRoot)
+	h.Is(hammy.NilError(err))
+	h.Is(hammy.Number(len(states)).EqualTo(2))
+}
+
+func TestReadSRIOVRejectsMalformedCount(t *testing.T) {
+	h := hammy.New(t)
+
+	devicePath := t.TempDir()
+	mustWriteFile(t, filepath.Join(devicePath, "sriov_totalvfs"), "many\n")
+
+	_, err := readSRIOV(devicePath, "0000:01:00.0")
+	h.Is(hammy.Error(err))
+}
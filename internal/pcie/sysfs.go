@@ -14,10 +14,33 @@ import (
 
 // Device contains the minimum PCIe link information needed for exported metrics.
 type Device struct {
-	Address          string
-	VendorID         string
-	DeviceID         string
-	Class            string
+	Address  string
+	VendorID string
+	DeviceID string
+	Class    string
+	// SubsystemVendorID and SubsystemDeviceID identify the board vendor and
+	// model, e.g. the OEM of a GPU or NIC.
+	SubsystemVendorID string
+	SubsystemDeviceID string
+	// Driver is the bound kernel driver, empty when none is bound.
+	Driver string
+	// Slot is the physical slot name from bus/pci/slots, or the firmware
+	// label when no registered slot covers the device. It is empty when
+	// neither exists.
+	Slot string
+	// PhysicalSlot holds the slot details behind Slot and is nil when Slot
+	// is empty.
+	PhysicalSlot *Slot
+	// OSBindings are the kernel devices the driver registered for this
+	// function, e.g. network interfaces and NVMe namespaces.
+	OSBindings []OSBinding
+	NUMA       NUMAAffinity
+	// SRIOV is nil unless the device is an SR-IOV physical or virtual
+	// function. Virtual functions share their PF's link, so they are
+	// returned without link classification or a Path.
+	SRIOV *SRIOV
+	// Names is empty until ApplyNames is called.
+	Names            Names
 	CurrentLinkSpeed string
 	MaxLinkSpeed     string
 	CurrentLinkWidth string
@@ -25,88 +48,286 @@ type Device struct {
 	NegotiatedOK     bool
 	SpeedRatio       float64
 	WidthRatio       float64
+	// Parent is the upstream device address from the sysfs topology, or empty
+	// when the device sits directly below a host bridge.
+	Parent string
+	// Path is set for non-bridge devices and describes the slowest hop up to
+	// the root port. It is nil when no hop has a mappable speed and width.
+	Path *PathLink
+	// DegradationReason is one of the Degradation* constants.
+	DegradationReason string
+	AER               AERStats
+	Power             PowerInfo
+	// DPC and SlotStatus are only set for root ports and switch downstream
+	// ports whose config space exposes them.
+	DPC        *DPCStatus
+	SlotStatus *SlotStatus
+	// DeviceControl is nil when config space does not expose the PCI
+	// Express capability to this process.
+	DeviceControl *DeviceControl
+	// LinkRegisters is nil when config space does not expose the PCI Express
+	// capability to this process.
+	LinkRegisters *LinkRegisters
+	// Expectation is set by ApplyExpectation when a policy rule matched.
+	Expectation *Expectation
+}
+
+// DeviceError records a failure to read one sysfs attribute of one device.
+// Devices in D3cold or mid hot-removal commonly return EIO or ENODEV, so these
+// errors are collected per device instead of failing the whole read.
+type DeviceError struct {
+	// Address is empty for reads that belong to no single device, such as
+	// the slots directory.
+	Address string
+	// Op is the failed operation: read, parse or resolve.
+	Op   string
+	File string
+	Err  error
+}
+
+func (e *DeviceError) Error() string {
+	if e.Address == "" {
+		return fmt.Sprintf("%s %s: %v", e.Op, e.File, e.Err)
+	}
+	return fmt.Sprintf("%s %s for %s: %v", e.Op, e.File, e.Address, e.Err)
+}
+
+func (e *DeviceError) Unwrap() error {
+	return e.Err
 }
 
 // ReadDevices enumerates PCIe devices from sysfsRoot/bus/pci/devices.
-func ReadDevices(sysfsRoot string) ([]Device, error) {
+// SR-IOV virtual functions are included but get no path or degradation
+// reason because they share their physical function's link.
+// Devices that fail to read are left out and reported in the returned
+// DeviceError slice; the error is only set when the device list itself
+// cannot be read. Informational attributes such as OS bindings and NUMA
+// affinity that fail to read are reported the same way but leave the device
+// in place.
+func ReadDevices(sysfsRoot string) ([]Device, []DeviceError, error) {
 	devicesPath := filepath.Join(sysfsRoot, "bus", "pci", "devices")
 	entries, err := os.ReadDir(devicesPath)
 	if err != nil {
-		return nil, fmt.Errorf("read pci devices from %s: %w", devicesPath, err)
+		return nil, nil, fmt.Errorf("read pci devices from %s: %w", devicesPath, err)
+	}
+
+	var deviceErrs []DeviceError
+	slots, slotsErr := readSlots(sysfsRoot)
+	if slotsErr != nil {
+		deviceErrs = append(deviceErrs, *slotsErr)
 	}
 
 	devices := make([]Device, 0, len(entries))
 	for _, entry := range entries {
 		address := entry.Name()
 		devicePath := filepath.Join(devicesPath, address)
-		device, ok, err := readDevice(devicePath, address)
+		device, ok, partialErrs, err := readDevice(devicePath, address, slots)
+		deviceErrs = append(deviceErrs, partialErrs...)
 		if err != nil {
-			return nil, err
+			deviceErrs = append(deviceErrs, asDeviceError(address, err))
+			continue
 		}
 		if ok {
 			devices = append(devices, device)
 		}
 	}
 
+	resolveDevices(devices)
+	return devices, deviceErrs, nil
+}
+
+// resolveDevices sorts devices by address and fills in everything that
+// depends on the other devices: paths, path payload sizes and degradation
+// reasons.
+func resolveDevices(devices []Device) {
 	sort.Slice(devices, func(i, j int) bool {
-		return devices[i].Address < devices[j].Address
+		return LessAddress(devices[i].Address, devices[j].Address)
 	})
+	resolvePaths(devices)
+	resolvePathPayloads(devices)
+	classifyDegradations(devices)
+}
 
-	return devices, nil
+func asDeviceError(address string, err error) DeviceError {
+	var deviceErr *DeviceError
+	if errors.As(err, &deviceErr) {
+		return *deviceErr
+	}
+	return DeviceError{Address: address, Op: "read", Err: err}
 }
 
-func readDevice(devicePath, address string) (Device, bool, error) {
-	currentSpeed, hasCurrentSpeed, err := readOptionalTrim(filepath.Join(devicePath, "current_link_speed"))
+// readDevice reads one device directory. partialErrs are failed reads of
+// informational attributes, which are left empty; err drops the device.
+func readDevice(devicePath, address string, slots map[string]Slot) (device Device, ok bool, partialErrs []DeviceError, err error) {
+	link, err := readLinkFiles(devicePath, address)
+	if err != nil {
+		return Device{}, false, nil, err
+	}
+
+	sriov, err := readSRIOV(devicePath, address)
+	if err != nil {
+		return Device{}, false, nil, err
+	}
+	// Skip entries that do not provide link negotiation info. VFs are kept
+	// without it: their identity, bindings and AER counters are still
+	// reported, while their link is their PF's.
+	if !link.complete() && !sriov.IsVF() {
+		return Device{}, false, nil, nil
+	}
+
+	id, err := readIdentity(devicePath, address)
+	if err != nil {
+		return Device{}, false, nil, err
+	}
+
+	driver, _, err := readDriverName(devicePath)
+	if err != nil {
+		return Device{}, false, nil, &DeviceError{Address: address, Op: "read", File: "driver", Err: err}
+	}
+	// OS bindings only name the device, so a failed read must not drop its
+	// link, AER and DPC series.
+	bindings, err := readOSBindings(devicePath, address)
+	if err != nil {
+		partialErrs = append(partialErrs, asDeviceError(address, err))
+	}
+	// NUMA affinity is informational too; a failed read reports no node.
+	numa, err := readNUMAAffinity(devicePath, address)
+	if err != nil {
+		partialErrs = append(partialErrs, asDeviceError(address, err))
+	}
+	slot, err := deviceSlot(devicePath, address, slots)
 	if err != nil {
-		return Device{}, false, fmt.Errorf("read current_link_speed for %s: %w", address, err)
+		return Device{}, false, nil, err
 	}
-	maxSpeed, hasMaxSpeed, err := readOptionalTrim(filepath.Join(devicePath, "max_link_speed"))
+	parent, err := resolveParentAddress(devicePath, strings.ToLower(address))
 	if err != nil {
-		return Device{}, false, fmt.Errorf("read max_link_speed for %s: %w", address, err)
+		return Device{}, false, nil, err
 	}
-	currentWidth, hasCurrentWidth, err := readOptionalTrim(filepath.Join(devicePath, "current_link_width"))
+	aer, err := readAER(devicePath, address)
 	if err != nil {
-		return Device{}, false, fmt.Errorf("read current_link_width for %s: %w", address, err)
+		return Device{}, false, nil, err
 	}
-	maxWidth, hasMaxWidth, err := readOptionalTrim(filepath.Join(devicePath, "max_link_width"))
+	power, err := readPowerInfo(devicePath, address)
 	if err != nil {
-		return Device{}, false, fmt.Errorf("read max_link_width for %s: %w", address, err)
+		return Device{}, false, nil, err
 	}
 
-	// Skip entries that do not provide link negotiation info.
-	if !(hasCurrentSpeed && hasMaxSpeed && hasCurrentWidth && hasMaxWidth) {
-		return Device{}, false, nil
+	speedRatio, speedOK := compareSpeed(link.currentSpeed, link.maxSpeed)
+	widthRatio, widthOK := compareWidth(link.currentWidth, link.maxWidth)
+	dpc, slotStatus := decodePortStatus(link.config, strings.ToLower(address))
+
+	return Device{
+		Address:           address,
+		VendorID:          id.vendorID,
+		DeviceID:          id.deviceID,
+		Class:             id.class,
+		SubsystemVendorID: id.subsystemVendorID,
+		SubsystemDeviceID: id.subsystemDeviceID,
+		Driver:            driver,
+		Slot:              slotName(slot),
+		PhysicalSlot:      slot,
+		OSBindings:        bindings,
+		NUMA:              numa,
+		SRIOV:             sriov,
+		CurrentLinkSpeed:  link.currentSpeed,
+		MaxLinkSpeed:      link.maxSpeed,
+		CurrentLinkWidth:  link.currentWidth,
+		MaxLinkWidth:      link.maxWidth,
+		NegotiatedOK:      speedOK && widthOK,
+		SpeedRatio:        speedRatio,
+		WidthRatio:        widthRatio,
+		Parent:            parent,
+		AER:               aer,
+		Power:             power,
+		LinkRegisters:     link.registers,
+		DPC:               dpc,
+		SlotStatus:        slotStatus,
+		DeviceControl:     decodeDeviceControlPointer(link.config),
+	}, true, partialErrs, nil
+}
+
+// linkFiles holds the raw link attributes for a device. Values missing from the
+// text files are filled from config space when it is readable, which covers
+// kernels that predate current_link_speed and friends.
+type linkFiles struct {
+	currentSpeed    string
+	maxSpeed        string
+	currentWidth    string
+	maxWidth        string
+	hasCurrentSpeed bool
+	hasMaxSpeed     bool
+	hasCurrentWidth bool
+	hasMaxWidth     bool
+	registers       *LinkRegisters
+	// config is the raw config space, nil when it could not be read.
+	config []byte
+}
+
+func (l linkFiles) complete() bool {
+	return l.hasCurrentSpeed && l.hasMaxSpeed && l.hasCurrentWidth && l.hasMaxWidth
+}
+
+// readLinkFiles reads the link text files and the config space, which fills
+// in any link value the text files lack.
+func readLinkFiles(devicePath, address string) (linkFiles, error) {
+	link, err := readLinkTextFiles(devicePath, address)
+	if err != nil {
+		return linkFiles{}, err
 	}
+	return readLinkConfig(devicePath, address, link)
+}
 
-	vendorID, _, err := readOptionalTrim(filepath.Join(devicePath, "vendor"))
+// readLinkTextFiles reads only the current_link_* and max_link_* files. It
+// never touches config, whose read runtime-resumes the device and its parent.
+func readLinkTextFiles(devicePath, address string) (linkFiles, error) {
+	var link linkFiles
+	var err error
+
+	link.currentSpeed, link.hasCurrentSpeed, err = readOptionalTrim(filepath.Join(devicePath, "current_link_speed"))
+	if err != nil {
+		return linkFiles{}, &DeviceError{Address: address, Op: "read", File: "current_link_speed", Err: err}
+	}
+	link.maxSpeed, link.hasMaxSpeed, err = readOptionalTrim(filepath.Join(devicePath, "max_link_speed"))
 	if err != nil {
-		return Device{}, false, fmt.Errorf("read vendor for %s: %w", address, err)
+		return linkFiles{}, &DeviceError{Address: address, Op: "read", File: "max_link_speed", Err: err}
 	}
-	deviceID, _, err := readOptionalTrim(filepath.Join(devicePath, "device"))
+	link.currentWidth, link.hasCurrentWidth, err = readOptionalTrim(filepath.Join(devicePath, "current_link_width"))
 	if err != nil {
-		return Device{}, false, fmt.Errorf("read device for %s: %w", address, err)
+		return linkFiles{}, &DeviceError{Address: address, Op: "read", File: "current_link_width", Err: err}
 	}
-	class, _, err := readOptionalTrim(filepath.Join(devicePath, "class"))
+	link.maxWidth, link.hasMaxWidth, err = readOptionalTrim(filepath.Join(devicePath, "max_link_width"))
 	if err != nil {
-		return Device{}, false, fmt.Errorf("read class for %s: %w", address, err)
+		return linkFiles{}, &DeviceError{Address: address, Op: "read", File: "max_link_width", Err: err}
 	}
+	return link, nil
+}
 
-	speedRatio, speedOK := compareSpeed(currentSpeed, maxSpeed)
-	widthRatio, widthOK := compareWidth(currentWidth, maxWidth)
+func readLinkConfig(devicePath, address string, link linkFiles) (linkFiles, error) {
+	var err error
+	link.config, err = readConfig(devicePath, address)
+	if err != nil {
+		return linkFiles{}, err
+	}
+	registers, ok := decodeLinkRegisters(link.config)
+	if !ok {
+		return link, nil
+	}
+	link.registers = &registers
 
-	return Device{
-		Address:          address,
-		VendorID:         vendorID,
-		DeviceID:         deviceID,
-		Class:            class,
-		CurrentLinkSpeed: currentSpeed,
-		MaxLinkSpeed:     maxSpeed,
-		CurrentLinkWidth: currentWidth,
-		MaxLinkWidth:     maxWidth,
-		NegotiatedOK:     speedOK && widthOK,
-		SpeedRatio:       speedRatio,
-		WidthRatio:       widthRatio,
-	}, true, nil
+	if !link.hasCurrentSpeed {
+		link.currentSpeed, link.hasCurrentSpeed = link.registers.CurrentSpeed, true
+	}
+	if !link.hasMaxSpeed {
+		link.maxSpeed, link.hasMaxSpeed = link.registers.MaxSpeed, true
+	}
+	if !link.hasCurrentWidth {
+		link.currentWidth, link.hasCurrentWidth = strconv.Itoa(link.registers.CurrentWidth), true
+	}
+	if !link.hasMaxWidth {
+		link.maxWidth, link.hasMaxWidth = strconv.Itoa(link.registers.MaxWidth), true
+	}
+
+	return link, nil
 }
 
 func readOptionalTrim(path string) (value string, ok bool, err error) {
@@ -148,6 +369,17 @@ func compareWidth(current, max string) (ratio float64, ok bool) {
 	return math.NaN(), false
 }
 
+// ParseLinkSpeed returns the GT/s value of a link speed string such as
+// "16.0 GT/s PCIe". It reports false for values like "Unknown".
+func ParseLinkSpeed(speed string) (float64, bool) {
+	return parseLeadingFloat(speed)
+}
+
+// ParseLinkWidth returns the lane count of a link width string such as "16" or "x16".
+func ParseLinkWidth(width string) (int, bool) {
+	return parseFirstInt(width)
+}
+
 func parseLeadingFloat(s string) (float64, bool) {
 	fields := strings.Fields(strings.TrimSpace(s))
 	if len(fields) == 0 {
@@ -2,6 +2,7 @@ package pcie
 
 import (
 	"math"
+	"os"
 	"path/filepath"
 	"testing"
 
@@ -12,8 +13,9 @@ func TestReadDevicesFromFixture(t *testing.T) {
 	h := hammy.New(t)
 
 	root := filepath.Join("testdata", "sysfs")
-	devices, err := ReadDevices(root)
+	devices, deviceErrs, err := ReadDevices(root)
 	h.Is(hammy.NilError(err))
+	h.Is(hammy.Slice(deviceErrs).IsEmpty())
 	h.Is(hammy.Number(len(devices)).EqualTo(2))
 
 	h.Is(hammy.String(devices[0].Address).EqualTo("0000:01:00.0"))
@@ -42,3 +44,36 @@ func TestCompareFallbackBehavior(t *testing.T) {
 	h.Is(hammy.False(ok))
 	h.Is(hammy.True(math.IsNaN(ratio)))
 }
+
+func TestReadDevicesKeepsHealthyDevicesOnReadError(t *testing.T) {
+	h := hammy.New(t)
+
+	sysfsRoot := t.TempDir()
+	busDevices := filepath.Join(sysfsRoot, "bus", "pci", "devices")
+	healthy := filepath.Join(busDevices, "0000:01:00.0")
+	broken := filepath.Join(busDevices, "0000:02:00.0")
+	writeLinkFixture(t, healthy, "0x030200", "32.0 GT/s PCIe", "16", "32.0 GT/s PCIe", "16")
+	writeLinkFixture(t, broken, "0x010802", "16.0 GT/s PCIe", "4", "16.0 GT/s PCIe", "4")
+	// A directory in place of the attribute fails with EISDIR, standing in for
+	// the EIO a device in D3cold returns.
+	h.Is(hammy.NilError(os.Remove(filepath.Join(broken, "current_link_speed"))))
+	mustMkdirAll(t, filepath.Join(broken, "current_link_speed"))
+
+	devices, deviceErrs, err := ReadDevices(sysfsRoot)
+	h.Is(hammy.NilError(err))
+	h.Is(hammy.Number(len(devices)).EqualTo(1))
+	h.Is(hammy.String(devices[0].Address).EqualTo("0000:01:00.0"))
+	h.Is(hammy.Number(len(deviceErrs)).EqualTo(1))
+	h.Is(hammy.String(deviceErrs[0].Address).EqualTo("0000:02:00.0"))
+	h.Is(hammy.String(deviceErrs[0].File).EqualTo("current_link_speed"))
+	h.Is(hammy.String(deviceErrs[0].Error()).HasPrefix("read current_link_speed for 0000:02:00.0: "))
+
+	tree, treeErrs, err := ReadTree(sysfsRoot)
+	h.Is(hammy.NilError(err))
+	h.Is(hammy.Number(len(treeErrs)).EqualTo(1))
+	h.Is(hammy.Number(len(tree)).EqualTo(2))
+	h.Is(hammy.String(tree[0].Error).IsEmpty())
+	h.Is(hammy.String(tree[1].BusID).EqualTo("0000:02:00.0"))
+	h.Is(hammy.String(tree[1].LinkStatus).EqualTo("unknown"))
+	h.Is(hammy.String(tree[1].Error).Contains("current_link_speed"))
+}
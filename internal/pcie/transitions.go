@@ -0,0 +1,162 @@
+package pcie
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// Link transition kinds reported by DiffLinkStates.
+const (
+	TransitionSpeedDown = "speed_down"
+	TransitionSpeedUp   = "speed_up"
+	TransitionWidthDown = "width_down"
+	TransitionWidthUp   = "width_up"
+	TransitionLinkDown  = "link_down"
+	TransitionLinkUp    = "link_up"
+	TransitionRemoved   = "removed"
+	TransitionAdded     = "added"
+)
+
+// LinkState is the negotiated link of one device at a point in time.
+type LinkState struct {
+	CurrentSpeed string
+	CurrentWidth string
+}
+
+// Up reports whether the link is trained. A link that is down reports a
+// width of 0 and an "Unknown" speed.
+func (s LinkState) Up() bool {
+	width, widthOK := parseFirstInt(s.CurrentWidth)
+	_, speedOK := parseLeadingFloat(s.CurrentSpeed)
+	return widthOK && width > 0 && speedOK
+}
+
+// Below reports whether s is a worse link than other: slower, narrower or
+// down while other was up.
+func (s LinkState) Below(other LinkState) bool {
+	if !other.Up() {
+		return false
+	}
+	if !s.Up() {
+		return true
+	}
+	speed, _ := parseLeadingFloat(s.CurrentSpeed)
+	otherSpeed, _ := parseLeadingFloat(other.CurrentSpeed)
+	width, _ := parseFirstInt(s.CurrentWidth)
+	otherWidth, _ := parseFirstInt(other.CurrentWidth)
+	return speed+1e-9 < otherSpeed || width < otherWidth
+}
+
+// Transition is one change between two LinkState readings of a device.
+type Transition struct {
+	Address string
+	Kind    string
+	From    string
+	To      string
+}
+
+// ReadLinkStates reads only the negotiated link of each device so it can be
+// polled far more often than a full ReadDevices. It reads the link text files
+// and only falls back to config, which wakes runtime-suspended devices, when
+// they are absent. Devices without link data are left out; devices that fail
+// to read are reported in the DeviceError slice and are also left out, as are
+// SR-IOV virtual functions.
+func ReadLinkStates(sysfsRoot string) (map[string]LinkState, []DeviceError, error) {
+	devicesPath := filepath.Join(sysfsRoot, "bus", "pci", "devices")
+	entries, err := os.ReadDir(devicesPath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("read pci devices from %s: %w", devicesPath, err)
+	}
+
+	states := make(map[string]LinkState, len(entries))
+	var deviceErrs []DeviceError
+	for _, entry := range entries {
+		address := entry.Name()
+		devicePath := filepath.Join(devicesPath, address)
+		if isVirtualFunction(devicePath) {
+			continue
+		}
+		link, err := readLinkTextFiles(devicePath, address)
+		if err == nil && !link.complete() {
+			link, err = readLinkConfig(devicePath, address, link)
+		}
+		if err != nil {
+			deviceErrs = append(deviceErrs, asDeviceError(address, err))
+			continue
+		}
+		if !link.complete() {
+			continue
+		}
+		states[address] = LinkState{CurrentSpeed: link.currentSpeed, CurrentWidth: link.currentWidth}
+	}
+	return states, deviceErrs, nil
+}
+
+// DiffLinkStates returns the transitions from prev to cur sorted by address.
+// A link going down or coming up is reported as link_down/link_up rather
+// than as speed and width changes.
+func DiffLinkStates(prev, cur map[string]LinkState) []Transition {
+	var transitions []Transition
+
+	for address, before := range prev {
+		after, ok := cur[address]
+		if !ok {
+			transitions = append(transitions, Transition{Address: address, Kind: TransitionRemoved, From: before.summary()})
+			continue
+		}
+		transitions = append(transitions, diffLinkState(address, before, after)...)
+	}
+	for address, after := range cur {
+		if _, ok := prev[address]; !ok {
+			transitions = append(transitions, Transition{Address: address, Kind: TransitionAdded, To: after.summary()})
+		}
+	}
+
+	sort.SliceStable(transitions, func(i, j int) bool {
+		if transitions[i].Address != transitions[j].Address {
+			return LessAddress(transitions[i].Address, transitions[j].Address)
+		}
+		return transitions[i].Kind < transitions[j].Kind
+	})
+	return transitions
+}
+
+func diffLinkState(address string, before, after LinkState) []Transition {
+	from, to := before.summary(), after.summary()
+	if before.Up() != after.Up() {
+		kind := TransitionLinkDown
+		if after.Up() {
+			kind = TransitionLinkUp
+		}
+		return []Transition{{Address: address, Kind: kind, From: from, To: to}}
+	}
+	if !after.Up() {
+		return nil
+	}
+
+	var transitions []Transition
+	beforeSpeed, _ := parseLeadingFloat(before.CurrentSpeed)
+	afterSpeed, _ := parseLeadingFloat(after.CurrentSpeed)
+	switch {
+	case afterSpeed < beforeSpeed:
+		transitions = append(transitions, Transition{Address: address, Kind: TransitionSpeedDown, From: from, To: to})
+	case afterSpeed > beforeSpeed:
+		transitions = append(transitions, Transition{Address: address, Kind: TransitionSpeedUp, From: from, To: to})
+	}
+
+	beforeWidth, _ := parseFirstInt(before.CurrentWidth)
+	afterWidth, _ := parseFirstInt(after.CurrentWidth)
+	switch {
+	case afterWidth < beforeWidth:
+		transitions = append(transitions, Transition{Address: address, Kind: TransitionWidthDown, From: from, To: to})
+	case afterWidth > beforeWidth:
+		transitions = append(transitions, Transition{Address: address, Kind: TransitionWidthUp, From: from, To: to})
+	}
+	return transitions
+}
+
+func (s LinkState) summary() string {
+	return formatLinkSummary(s.CurrentSpeed, s.CurrentWidth)
+}
@@ -0,0 +1,65 @@
+package pcie
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/gogunit/gunit/hammy"
+)
+
+func TestDiffLinkStates(t *testing.T) {
+	h := hammy.New(t)
+
+	prev := map[string]LinkState{
+		"0000:01:00.0": {CurrentSpeed: "32.0 GT/s PCIe", CurrentWidth: "16"},
+		"0000:02:00.0": {CurrentSpeed: "16.0 GT/s PCIe", CurrentWidth: "8"},
+		"0000:03:00.0": {CurrentSpeed: "8.0 GT/s PCIe", CurrentWidth: "4"},
+		"0000:04:00.0": {CurrentSpeed: "8.0 GT/s PCIe", CurrentWidth: "4"},
+	}
+	cur := map[string]LinkState{
+		"0000:01:00.0": {CurrentSpeed: "16.0 GT/s PCIe", CurrentWidth: "8"},
+		"0000:02:00.0": {CurrentSpeed: "16.0 GT/s PCIe", CurrentWidth: "8"},
+		"0000:03:00.0": {CurrentSpeed: "Unknown", CurrentWidth: "0"},
+		"0000:05:00.0": {CurrentSpeed: "2.5 GT/s PCIe", CurrentWidth: "1"},
+	}
+
+	transitions := DiffLinkStates(prev, cur)
+
+	h.Is(hammy.Number(len(transitions)).EqualTo(5))
+	h.Is(hammy.String(transitions[0].Kind).EqualTo(TransitionSpeedDown))
+	h.Is(hammy.String(transitions[0].From).EqualTo("32.0 GT/s PCIe x16"))
+	h.Is(hammy.String(transitions[0].To).EqualTo("16.0 GT/s PCIe x8"))
+	h.Is(hammy.String(transitions[1].Kind).EqualTo(TransitionWidthDown))
+	h.Is(hammy.String(transitions[2].Address).EqualTo("0000:03:00.0"))
+	h.Is(hammy.String(transitions[2].Kind).EqualTo(TransitionLinkDown))
+	h.Is(hammy.String(transitions[3].Kind).EqualTo(TransitionRemoved))
+	h.Is(hammy.String(transitions[4].Kind).EqualTo(TransitionAdded))
+
+	recovered := DiffLinkStates(cur, prev)
+	h.Is(hammy.String(recovered[0].Kind).EqualTo(TransitionSpeedUp))
+	h.Is(hammy.String(recovered[1].Kind).EqualTo(TransitionWidthUp))
+	h.Is(hammy.String(recovered[2].Kind).EqualTo(TransitionLinkUp))
+}
+
+func TestReadLinkStatesSkipsConfigWhenLinkFilesExist(t *testing.T) {
+	h := hammy.New(t)
+
+	sysfsRoot := t.TempDir()
+	devicesPath := filepath.Join(sysfsRoot, "bus", "pci", "devices")
+	withFiles := filepath.Join(devicesPath, "0000:01:00.0")
+	writeLinkFixture(t, withFiles, "0x030200", "16.0 GT/s PCIe", "8", "32.0 GT/s PCIe", "16")
+	// Reading a directory fails, so any config read would surface as an error.
+	mustMkdirAll(t, filepath.Join(withFiles, "config"))
+
+	configOnly := filepath.Join(devicesPath, "0000:02:00.0")
+	mustMkdirAll(t, configOnly)
+	mustWriteFile(t, filepath.Join(configOnly, "config"), string(buildConfig(0x5|16<<4, 0x4|8<<4, 0, 0)))
+
+	states, deviceErrs, err := ReadLinkStates(sysfsRoot)
+	h.Is(hammy.NilError(err))
+	h.Is(hammy.Slice(deviceErrs).IsEmpty())
+	h.Is(hammy.String(states["0000:01:00.0"].CurrentSpeed).EqualTo("16.0 GT/s PCIe"))
+	h.Is(hammy.String(states["0000:01:00.0"].CurrentWidth).EqualTo("8"))
+	h.Is(hammy.String(states["0000:02:00.0"].CurrentSpeed).EqualTo("16.0 GT/s PCIe"))
+	h.Is(hammy.String(states["0000:02:00.0"].CurrentWidth).EqualTo("8"))
+}
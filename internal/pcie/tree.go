@@ -4,29 +4,54 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
-	"regexp"
 	"sort"
 	"strconv"
 	"strings"
 )
 
-var pciAddressPattern = regexp.MustCompile(`^[0-9a-fA-F]{4}:[0-9a-fA-F]{2}:[0-9a-fA-F]{2}\.[0-7]$`)
-
 // TreeNode represents one device in the PCIe topology tree.
 type TreeNode struct {
-	BusID        string      `json:"bus_id"`
-	Name         string      `json:"name"`
-	LinkCapacity string      `json:"link_capacity"`
-	LinkStatus   string      `json:"link_status"`
-	Children     []*TreeNode `json:"children,omitempty"`
+	BusID             string `json:"bus_id"`
+	Name              string `json:"name"`
+	LinkCapacity      string `json:"link_capacity"`
+	LinkStatus        string `json:"link_status"`
+	VendorID          string `json:"vendor_id,omitempty"`
+	DeviceID          string `json:"device_id,omitempty"`
+	Class             string `json:"class,omitempty"`
+	SubsystemVendorID string `json:"subsystem_vendor_id,omitempty"`
+	SubsystemDeviceID string `json:"subsystem_device_id,omitempty"`
+	Driver            string `json:"driver,omitempty"`
+	// Slot is the physical slot name, as on Device.
+	Slot         string      `json:"slot,omitempty"`
+	PhysicalSlot *Slot       `json:"physical_slot,omitempty"`
+	OSBindings   []OSBinding `json:"os_bindings,omitempty"`
+	NUMAAffinity
+	SRIOV *SRIOV `json:"sriov,omitempty"`
+	// LinkControls are the ASPM and clock PM controls from <bdf>/link/.
+	LinkControls []LinkControl `json:"link_controls,omitempty"`
+	// Names is empty until ApplyTreeNames is called.
+	Names
+	// Error is set when the device could not be fully read; the node is kept
+	// so its position in the topology remains visible.
+	Error    string      `json:"error,omitempty"`
+	Children []*TreeNode `json:"children,omitempty"`
 }
 
 // ReadTree builds a PCIe topology tree from sysfsRoot/bus/pci/devices.
-func ReadTree(sysfsRoot string) ([]*TreeNode, error) {
+// Devices that fail to read stay in the tree with Error set and are also
+// returned as DeviceErrors. SR-IOV virtual functions are placed below their
+// physical function.
+func ReadTree(sysfsRoot string) ([]*TreeNode, []DeviceError, error) {
 	devicesPath := filepath.Join(sysfsRoot, "bus", "pci", "devices")
 	entries, err := os.ReadDir(devicesPath)
 	if err != nil {
-		return nil, fmt.Errorf("read pci devices from %s: %w", devicesPath, err)
+		return nil, nil, fmt.Errorf("read pci devices from %s: %w", devicesPath, err)
+	}
+
+	var deviceErrs []DeviceError
+	slots, slotsErr := readSlots(sysfsRoot)
+	if slotsErr != nil {
+		deviceErrs = append(deviceErrs, *slotsErr)
 	}
 
 	nodes := make(map[string]*TreeNode, len(entries))
@@ -36,21 +61,38 @@ func ReadTree(sysfsRoot string) ([]*TreeNode, error) {
 		address := strings.ToLower(entry.Name())
 		devicePath := filepath.Join(devicesPath, entry.Name())
 
-		node, err := readTreeNode(devicePath, address)
+		node, partialErrs, err := readTreeNode(devicePath, address, slots)
+		deviceErrs = append(deviceErrs, partialErrs...)
 		if err != nil {
-			return nil, err
+			deviceErrs = append(deviceErrs, asDeviceError(address, err))
+			node = failedTreeNode(address, err)
 		}
 		nodes[address] = node
 
+		// A VF sits below its PF rather than beside it.
+		if node.SRIOV.IsVF() {
+			parents[address] = node.SRIOV.PhysFn
+			continue
+		}
 		parentAddress, err := resolveParentAddress(devicePath, address)
 		if err != nil {
-			return nil, err
+			deviceErrs = append(deviceErrs, asDeviceError(address, err))
+			if node.Error == "" {
+				node.Error = err.Error()
+			}
+			continue
 		}
 		if parentAddress != "" {
 			parents[address] = parentAddress
 		}
 	}
 
+	return buildTree(nodes, parents), deviceErrs, nil
+}
+
+// buildTree links nodes below their parents and returns the sorted roots. A
+// node whose parent is not in nodes becomes a root.
+func buildTree(nodes map[string]*TreeNode, parents map[string]string) []*TreeNode {
 	roots := make([]*TreeNode, 0, len(nodes))
 	for address, node := range nodes {
 		parentAddress, hasParent := parents[address]
@@ -64,70 +106,98 @@ func ReadTree(sysfsRoot string) ([]*TreeNode, error) {
 	}
 
 	sortTree(roots)
-	return roots, nil
+	return roots
 }
 
-func readTreeNode(devicePath, address string) (*TreeNode, error) {
-	name, err := readDeviceName(devicePath, address)
+func failedTreeNode(address string, err error) *TreeNode {
+	return &TreeNode{
+		BusID:        address,
+		Name:         address,
+		LinkCapacity: "unknown",
+		LinkStatus:   "unknown",
+		NUMAAffinity: NUMAAffinity{Node: NoNUMANode},
+		Error:        err.Error(),
+	}
+}
+
+// readTreeNode reads one device directory for the tree. partialErrs are
+// failed reads of informational attributes, which are left empty.
+func readTreeNode(devicePath, address string, slots map[string]Slot) (node *TreeNode, partialErrs []DeviceError, err error) {
+	id, err := readIdentity(devicePath, address)
+	if err != nil {
+		return nil, nil, err
+	}
+	driver, _, err := readDriverName(devicePath)
 	if err != nil {
-		return nil, err
+		return nil, nil, &DeviceError{Address: address, Op: "read", File: "driver", Err: err}
+	}
+	name, err := readDeviceName(devicePath, address, id, driver)
+	if err != nil {
+		return nil, nil, err
 	}
 
-	currentSpeed, _, err := readOptionalTrim(filepath.Join(devicePath, "current_link_speed"))
+	bindings, err := readOSBindings(devicePath, address)
+	if err != nil {
+		partialErrs = append(partialErrs, asDeviceError(address, err))
+	}
+	// NUMA affinity is informational; a failed read reports no node.
+	numa, err := readNUMAAffinity(devicePath, address)
+	if err != nil {
+		partialErrs = append(partialErrs, asDeviceError(address, err))
+	}
+	sriov, err := readSRIOV(devicePath, address)
 	if err != nil {
-		return nil, fmt.Errorf("read current_link_speed for %s: %w", address, err)
+		return nil, nil, err
 	}
-	maxSpeed, _, err := readOptionalTrim(filepath.Join(devicePath, "max_link_speed"))
+	slot, err := deviceSlot(devicePath, address, slots)
 	if err != nil {
-		return nil, fmt.Errorf("read max_link_speed for %s: %w", address, err)
+		return nil, nil, err
 	}
-	currentWidth, _, err := readOptionalTrim(filepath.Join(devicePath, "current_link_width"))
+	linkControls, err := readLinkControls(devicePath, address)
 	if err != nil {
-		return nil, fmt.Errorf("read current_link_width for %s: %w", address, err)
+		return nil, nil, err
 	}
-	maxWidth, _, err := readOptionalTrim(filepath.Join(devicePath, "max_link_width"))
+
+	link, err := readLinkFiles(devicePath, address)
 	if err != nil {
-		return nil, fmt.Errorf("read max_link_width for %s: %w", address, err)
+		return nil, nil, err
 	}
 
 	return &TreeNode{
-		BusID:        address,
-		Name:         name,
-		LinkCapacity: formatLinkSummary(maxSpeed, maxWidth),
-		LinkStatus:   formatLinkSummary(currentSpeed, currentWidth),
-	}, nil
+		BusID:             address,
+		Name:              name,
+		LinkCapacity:      formatLinkSummary(link.maxSpeed, link.maxWidth),
+		LinkStatus:        formatLinkSummary(link.currentSpeed, link.currentWidth),
+		VendorID:          id.vendorID,
+		DeviceID:          id.deviceID,
+		Class:             id.class,
+		SubsystemVendorID: id.subsystemVendorID,
+		SubsystemDeviceID: id.subsystemDeviceID,
+		Driver:            driver,
+		Slot:              slotName(slot),
+		PhysicalSlot:      slot,
+		OSBindings:        bindings,
+		NUMAAffinity:      numa,
+		SRIOV:             sriov,
+		LinkControls:      linkControls,
+	}, partialErrs, nil
 }
 
-func readDeviceName(devicePath, address string) (string, error) {
+func readDeviceName(devicePath, address string, id identity, driver string) (string, error) {
 	label, hasLabel, err := readOptionalTrim(filepath.Join(devicePath, "label"))
 	if err != nil {
-		return "", fmt.Errorf("read label for %s: %w", address, err)
+		return "", &DeviceError{Address: address, Op: "read", File: "label", Err: err}
 	}
 	if hasLabel && label != "" {
 		return label, nil
 	}
 
-	driverName, hasDriver, err := readDriverName(devicePath)
-	if err != nil {
-		return "", fmt.Errorf("read driver for %s: %w", address, err)
-	}
-	if hasDriver {
-		return driverName, nil
-	}
-
-	vendorID, _, err := readOptionalTrim(filepath.Join(devicePath, "vendor"))
-	if err != nil {
-		return "", fmt.Errorf("read vendor for %s: %w", address, err)
-	}
-	deviceID, _, err := readOptionalTrim(filepath.Join(devicePath, "device"))
-	if err != nil {
-		return "", fmt.Errorf("read device for %s: %w", address, err)
+	if driver != "" {
+		return driver, nil
 	}
 
-	vendorID = trimHexPrefix(vendorID)
-	deviceID = trimHexPrefix(deviceID)
-	if vendorID != "" || deviceID != "" {
-		return vendorID + ":" + deviceID, nil
+	if name := hexIDName(id); name != "" {
+		return name, nil
 	}
 
 	return address, nil
@@ -149,10 +219,14 @@ func readDriverName(devicePath string) (value string, ok bool, err error) {
 	return name, true, nil
 }
 
+// resolveParentAddress returns the closest PCI address above address in the
+// resolved sysfs path. A device behind an Intel VMD controller resolves to a
+// path such as pci0000:00/0000:00:0e.5/pci10000:e0/10000:e0:1a.0, so the VMD
+// controller becomes the parent of the root ports in its domain.
 func resolveParentAddress(devicePath, address string) (string, error) {
 	resolvedPath, err := filepath.EvalSymlinks(devicePath)
 	if err != nil {
-		return "", fmt.Errorf("resolve symlink for %s: %w", address, err)
+		return "", &DeviceError{Address: address, Op: "resolve", File: "symlink", Err: err}
 	}
 
 	pathParts := strings.Split(filepath.ToSlash(resolvedPath), "/")
@@ -213,16 +287,9 @@ func formatWidth(width string) string {
 	return "x" + strconv.Itoa(value)
 }
 
-func trimHexPrefix(value string) string {
-	value = strings.TrimSpace(value)
-	value = strings.TrimPrefix(value, "0x")
-	value = strings.TrimPrefix(value, "0X")
-	return value
-}
-
 func sortTree(nodes []*TreeNode) {
 	sort.Slice(nodes, func(i, j int) bool {
-		return nodes[i].BusID < nodes[j].BusID
+		return LessAddress(nodes[i].BusID, nodes[j].BusID)
 	})
 	for _, node := range nodes {
 		sortTree(node.Children)
@@ -45,8 +45,9 @@ func TestReadTreeBuildsHierarchyWithLinkData(t *testing.T) {
 	mustSymlink(t, gpuPath, filepath.Join(busDevices, "0000:01:00.0"))
 	mustSymlink(t, nicPath, filepath.Join(busDevices, "0000:02:00.0"))
 
-	tree, err := ReadTree(sysfsRoot)
+	tree, deviceErrs, err := ReadTree(sysfsRoot)
 	h.Is(hammy.NilError(err))
+	h.Is(hammy.Slice(deviceErrs).IsEmpty())
 	h.Is(hammy.Number(len(tree)).EqualTo(2))
 
 	rootBridge := tree[0]
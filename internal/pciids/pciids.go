@@ -0,0 +1,294 @@
+// Package pciids resolves PCI vendor, device, subsystem and class IDs to names
+// using the pci.ids database format maintained at https://pci-ids.ucw.cz/.
+package pciids
+
+import (
+	"bufio"
+	_ "embed"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// DefaultPath is where most distributions install pci.ids (hwdata package).
+const DefaultPath = "/usr/share/hwdata/pci.ids"
+
+// classesIDs is the class section of pci.ids, used when no database file is
+// available so class codes can still be decoded.
+//
+//go:embed classes.ids
+var classesIDs string
+
+// DB is a parsed pci.ids database. A nil or zero DB is an empty database and
+// all lookups on it return empty names.
+type DB struct {
+	vendors map[uint16]*vendor
+	classes map[uint8]*class
+}
+
+type vendor struct {
+	name    string
+	devices map[uint16]*device
+}
+
+type device struct {
+	name       string
+	subsystems map[uint32]string
+}
+
+type class struct {
+	name       string
+	subclasses map[uint8]*subclass
+}
+
+type subclass struct {
+	name    string
+	progIfs map[uint8]string
+}
+
+// ClassNames holds the decoded parts of a 24-bit class code.
+type ClassNames struct {
+	Class    string
+	Subclass string
+	ProgIf   string
+}
+
+// Open loads the database at path. When path is empty or does not exist it
+// returns a database containing only the embedded class names.
+func Open(path string) (*DB, error) {
+	if path == "" {
+		return Fallback(), nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return Fallback(), nil
+		}
+		return nil, fmt.Errorf("open pci.ids %s: %w", path, err)
+	}
+	defer f.Close()
+
+	db, err := Parse(f)
+	if err != nil {
+		return nil, fmt.Errorf("parse pci.ids %s: %w", path, err)
+	}
+	return db, nil
+}
+
+// Fallback returns a database with the embedded class names only.
+func Fallback() *DB {
+	db, err := Parse(strings.NewReader(classesIDs))
+	if err != nil {
+		panic(fmt.Sprintf("parse embedded classes.ids: %v", err))
+	}
+	return db
+}
+
+// Parse reads the pci.ids format. Vendor lines start at column zero, devices
+// are indented by one tab and subsystems by two. The class section uses
+// "C <class>" lines with subclasses and programming interfaces indented the
+// same way. Lines that do not fit this shape are skipped, as lspci does.
+func Parse(r io.Reader) (*DB, error) {
+	db := &DB{
+		vendors: make(map[uint16]*vendor),
+		classes: make(map[uint8]*class),
+	}
+
+	var currentVendor *vendor
+	var currentDevice *device
+	var currentClass *class
+	var currentSubclass *subclass
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		depth := len(line) - len(strings.TrimLeft(line, "\t"))
+		text := line[depth:]
+
+		switch {
+		case depth == 0 && strings.HasPrefix(text, "C "):
+			id, name, ok := splitEntry(strings.TrimPrefix(text, "C "))
+			code, err := strconv.ParseUint(id, 16, 8)
+			if !ok || err != nil {
+				currentClass = nil
+				continue
+			}
+			currentVendor, currentDevice, currentSubclass = nil, nil, nil
+			currentClass = &class{name: name, subclasses: make(map[uint8]*subclass)}
+			db.classes[uint8(code)] = currentClass
+
+		case depth == 0:
+			id, name, ok := splitEntry(text)
+			code, err := strconv.ParseUint(id, 16, 16)
+			if !ok || err != nil {
+				// Other top-level sections such as "X" (device classes of
+				// other buses) end the vendor list.
+				currentVendor, currentDevice, currentClass = nil, nil, nil
+				continue
+			}
+			currentClass, currentSubclass, currentDevice = nil, nil, nil
+			currentVendor = &vendor{name: name, devices: make(map[uint16]*device)}
+			db.vendors[uint16(code)] = currentVendor
+
+		case depth == 1 && currentVendor != nil:
+			id, name, ok := splitEntry(text)
+			code, err := strconv.ParseUint(id, 16, 16)
+			if !ok || err != nil {
+				continue
+			}
+			currentDevice = &device{name: name, subsystems: make(map[uint32]string)}
+			currentVendor.devices[uint16(code)] = currentDevice
+
+		case depth == 2 && currentDevice != nil:
+			// Subsystem lines are "<subvendor> <subdevice>  <name>".
+			subVendorID, rest, ok := splitEntry(text)
+			if !ok {
+				continue
+			}
+			subDeviceID, name, ok := splitEntry(rest)
+			if !ok {
+				continue
+			}
+			subVendor, err := strconv.ParseUint(subVendorID, 16, 16)
+			if err != nil {
+				continue
+			}
+			subDevice, err := strconv.ParseUint(subDeviceID, 16, 16)
+			if err != nil {
+				continue
+			}
+			currentDevice.subsystems[uint32(subVendor)<<16|uint32(subDevice)] = name
+
+		case depth == 1 && currentClass != nil:
+			id, name, ok := splitEntry(text)
+			code, err := strconv.ParseUint(id, 16, 8)
+			if !ok || err != nil {
+				continue
+			}
+			currentSubclass = &subclass{name: name, progIfs: make(map[uint8]string)}
+			currentClass.subclasses[uint8(code)] = currentSubclass
+
+		case depth == 2 && currentSubclass != nil:
+			id, name, ok := splitEntry(text)
+			code, err := strconv.ParseUint(id, 16, 8)
+			if !ok || err != nil {
+				continue
+			}
+			currentSubclass.progIfs[uint8(code)] = name
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return db, nil
+}
+
+// splitEntry splits "<id>  <name>" at the first run of whitespace.
+func splitEntry(text string) (id, name string, ok bool) {
+	id, name, ok = strings.Cut(text, " ")
+	if !ok {
+		return "", "", false
+	}
+	return id, strings.TrimSpace(name), true
+}
+
+// VendorName returns the vendor name for a sysfs vendor value such as "0x10de".
+func (db *DB) VendorName(vendorID string) string {
+	v := db.lookupVendor(vendorID)
+	if v == nil {
+		return ""
+	}
+	return v.name
+}
+
+// DeviceName returns the device name for sysfs vendor and device values.
+func (db *DB) DeviceName(vendorID, deviceID string) string {
+	d := db.lookupDevice(vendorID, deviceID)
+	if d == nil {
+		return ""
+	}
+	return d.name
+}
+
+// SubsystemName returns the subsystem name for sysfs vendor, device,
+// subsystem_vendor and subsystem_device values.
+func (db *DB) SubsystemName(vendorID, deviceID, subsystemVendorID, subsystemDeviceID string) string {
+	d := db.lookupDevice(vendorID, deviceID)
+	if d == nil {
+		return ""
+	}
+	subVendor, ok := parseHex(subsystemVendorID, 16)
+	if !ok {
+		return ""
+	}
+	subDevice, ok := parseHex(subsystemDeviceID, 16)
+	if !ok {
+		return ""
+	}
+	return d.subsystems[uint32(subVendor)<<16|uint32(subDevice)]
+}
+
+// Class decodes a sysfs class value such as "0x030200" into class, subclass
+// and programming interface names. Unknown parts are left empty.
+func (db *DB) Class(classCode string) ClassNames {
+	code, ok := parseHex(classCode, 24)
+	if db == nil || !ok {
+		return ClassNames{}
+	}
+	c := db.classes[uint8(code>>16)]
+	if c == nil {
+		return ClassNames{}
+	}
+	names := ClassNames{Class: c.name}
+	sc := c.subclasses[uint8(code>>8)]
+	if sc == nil {
+		return names
+	}
+	names.Subclass = sc.name
+	names.ProgIf = sc.progIfs[uint8(code)]
+	return names
+}
+
+func (db *DB) lookupVendor(vendorID string) *vendor {
+	id, ok := parseHex(vendorID, 16)
+	if db == nil || !ok {
+		return nil
+	}
+	return db.vendors[uint16(id)]
+}
+
+func (db *DB) lookupDevice(vendorID, deviceID string) *device {
+	v := db.lookupVendor(vendorID)
+	if v == nil {
+		return nil
+	}
+	id, ok := parseHex(deviceID, 16)
+	if !ok {
+		return nil
+	}
+	return v.devices[uint16(id)]
+}
+
+func parseHex(value string, bitSize int) (uint64, bool) {
+	value = strings.TrimSpace(value)
+	value = strings.TrimPrefix(value, "0x")
+	value = strings.TrimPrefix(value, "0X")
+	if value == "" {
+		return 0, false
+	}
+	parsed, err := strconv.ParseUint(value, 16, bitSize)
+	if err != nil {
+		return 0, false
+	}
+	return parsed, true
+}
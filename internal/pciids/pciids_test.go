@@ -0,0 +1,62 @@
+package pciids
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gogunit/gunit/hammy"
+)
+
+func TestOpenParsesDatabase(t *testing.T) {
+	h := hammy.New(t)
+
+	db, err := Open(filepath.Join("testdata", "pci.ids"))
+	h.Is(hammy.NilError(err))
+
+	h.Is(hammy.String(db.VendorName("0x10de")).EqualTo("NVIDIA Corporation"))
+	h.Is(hammy.String(db.DeviceName("0x10de", "0x2331")).EqualTo("GH100 [H100 PCIe]"))
+	h.Is(hammy.String(db.SubsystemName("0x10de", "0x2331", "0x10de", "0x1626")).EqualTo("H100 PCIe"))
+	h.Is(hammy.String(db.SubsystemName("0x15b3", "0x1017", "0x15b3", "0x0020")).EqualTo("ConnectX-5 EN network interface card, 10/25GbE dual-port SFP28"))
+	h.Is(hammy.String(db.DeviceName("0x10de", "0xffff")).IsEmpty())
+	h.Is(hammy.String(db.VendorName("not-hex")).IsEmpty())
+
+	h.Is(hammy.Struct(db.Class("0x030000")).EqualTo(ClassNames{
+		Class:    "Display controller",
+		Subclass: "VGA compatible controller",
+		ProgIf:   "VGA controller",
+	}))
+	h.Is(hammy.Struct(db.Class("0x030200")).EqualTo(ClassNames{Class: "Display controller", Subclass: "3D controller"}))
+	h.Is(hammy.Struct(db.Class("0x060400")).EqualTo(ClassNames{}))
+}
+
+func TestOpenMissingFileUsesEmbeddedClasses(t *testing.T) {
+	h := hammy.New(t)
+
+	db, err := Open(filepath.Join(t.TempDir(), "pci.ids"))
+	h.Is(hammy.NilError(err))
+	h.Is(hammy.String(db.VendorName("0x10de")).IsEmpty())
+	h.Is(hammy.Struct(db.Class("0x010802")).EqualTo(ClassNames{
+		Class:    "Mass storage controller",
+		Subclass: "Non-Volatile memory controller",
+		ProgIf:   "NVM Express",
+	}))
+	h.Is(hammy.String(db.Class("0x060400").Subclass).EqualTo("PCI bridge"))
+}
+
+func TestParseIgnoresUnrelatedSections(t *testing.T) {
+	h := hammy.New(t)
+
+	db, err := Parse(strings.NewReader("X 01  Unknown\n\t01  Ignored\n10de  NVIDIA Corporation\n"))
+	h.Is(hammy.NilError(err))
+	h.Is(hammy.String(db.VendorName("10de")).EqualTo("NVIDIA Corporation"))
+	h.Is(hammy.String(db.Class("0x010000").Class).IsEmpty())
+}
+
+func TestNilDatabaseLookups(t *testing.T) {
+	h := hammy.New(t)
+
+	var db *DB
+	h.Is(hammy.String(db.VendorName("0x10de")).IsEmpty())
+	h.Is(hammy.Struct(db.Class("0x030000")).EqualTo(ClassNames{}))
+}
@@ -0,0 +1,146 @@
+// Package policy loads per-device link expectations. A policy is an ordered
+// list of rules; the first rule whose match fields all agree with a device
+// sets the link that device is expected to negotiate, or marks it ignored.
+package policy
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/nfisher/pcie-exporter/internal/pcie"
+)
+
+// Policy is an ordered list of rules.
+type Policy struct {
+	Rules []Rule `json:"rules"`
+}
+
+// Rule sets the expected link for the devices it matches.
+type Rule struct {
+	Name  string `json:"name"`
+	Match Match  `json:"match"`
+	// ExpectedSpeed is a link speed such as "2.5 GT/s". Empty keeps the
+	// device maximum.
+	ExpectedSpeed string `json:"expected_speed,omitempty"`
+	// ExpectedWidth is a lane count. Zero keeps the device maximum.
+	ExpectedWidth int  `json:"expected_width,omitempty"`
+	Ignore        bool `json:"ignore,omitempty"`
+}
+
+// Match selects devices. Empty fields match anything; set fields must all
+// match.
+type Match struct {
+	// Address is a glob over the PCI address, e.g. "0000:0[0-3]:*".
+	Address  string `json:"address,omitempty"`
+	VendorID string `json:"vendor_id,omitempty"`
+	DeviceID string `json:"device_id,omitempty"`
+	// ClassPrefix matches the leading hex digits of the class code, e.g.
+	// "0300" for VGA controllers.
+	ClassPrefix string `json:"class_prefix,omitempty"`
+	Driver      string `json:"driver,omitempty"`
+	Slot        string `json:"slot,omitempty"`
+}
+
+// Load reads a policy file.
+func Load(filePath string) (*Policy, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("open policy %s: %w", filePath, err)
+	}
+	defer f.Close()
+
+	p, err := Parse(f)
+	if err != nil {
+		return nil, fmt.Errorf("parse policy %s: %w", filePath, err)
+	}
+	return p, nil
+}
+
+// Parse decodes and validates a policy.
+func Parse(r io.Reader) (*Policy, error) {
+	var p Policy
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&p); err != nil {
+		return nil, err
+	}
+	for i, rule := range p.Rules {
+		if err := rule.validate(); err != nil {
+			return nil, fmt.Errorf("rule %d: %w", i, err)
+		}
+	}
+	return &p, nil
+}
+
+func (r Rule) validate() error {
+	if r.Name == "" {
+		return errors.New("name is required")
+	}
+	if r.Match == (Match{}) {
+		return fmt.Errorf("%s: match must set at least one field", r.Name)
+	}
+	if r.Match.Address != "" {
+		if _, err := path.Match(r.Match.Address, ""); err != nil {
+			return fmt.Errorf("%s: address: %w", r.Name, err)
+		}
+	}
+	if r.ExpectedSpeed != "" {
+		if _, ok := pcie.ParseLinkSpeed(r.ExpectedSpeed); !ok {
+			return fmt.Errorf("%s: expected_speed %q is not a link speed", r.Name, r.ExpectedSpeed)
+		}
+	}
+	if r.ExpectedWidth < 0 {
+		return fmt.Errorf("%s: expected_width must not be negative", r.Name)
+	}
+	if !r.Ignore && r.ExpectedSpeed == "" && r.ExpectedWidth == 0 {
+		return fmt.Errorf("%s: set expected_speed, expected_width or ignore", r.Name)
+	}
+	return nil
+}
+
+// Lookup returns the first rule that matches device.
+func (p *Policy) Lookup(device pcie.Device) (Rule, bool) {
+	if p == nil {
+		return Rule{}, false
+	}
+	for _, rule := range p.Rules {
+		if rule.Match.matches(device) {
+			return rule, true
+		}
+	}
+	return Rule{}, false
+}
+
+// Apply sets the expectation of every device matched by a rule.
+func (p *Policy) Apply(devices []pcie.Device) {
+	for i := range devices {
+		rule, ok := p.Lookup(devices[i])
+		if !ok {
+			continue
+		}
+		expectation := pcie.Expectation{Rule: rule.Name, Speed: rule.ExpectedSpeed, Ignore: rule.Ignore}
+		if rule.ExpectedWidth > 0 {
+			expectation.Width = strconv.Itoa(rule.ExpectedWidth)
+		}
+		devices[i].ApplyExpectation(expectation)
+	}
+}
+
+func (m Match) matches(device pcie.Device) bool {
+	if m.Address != "" {
+		if ok, _ := path.Match(strings.ToLower(m.Address), strings.ToLower(device.Address)); !ok {
+			return false
+		}
+	}
+	match := pcie.IDMatch{ClassPrefix: m.ClassPrefix, VendorID: m.VendorID, DeviceID: m.DeviceID, Driver: m.Driver}
+	if !match.Matches(device) {
+		return false
+	}
+	return m.Slot == "" || m.Slot == device.Slot
+}
@@ -0,0 +1,82 @@
+package policy
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/gogunit/gunit/hammy"
+	"github.com/nfisher/pcie-exporter/internal/pcie"
+)
+
+const examplePolicy = `{
+  "rules": [
+    {"name": "bmc-vga", "match": {"vendor_id": "1a03", "class_prefix": "0x0300"}, "expected_speed": "2.5 GT/s", "expected_width": 1},
+    {"name": "capped-nic", "match": {"address": "0000:17:00.*", "driver": "mlx5_core"}, "expected_width": 8},
+    {"name": "slot-7", "match": {"slot": "7"}, "ignore": true}
+  ]
+}`
+
+func TestLookupReturnsFirstMatchingRule(t *testing.T) {
+	h := hammy.New(t)
+
+	p, err := Parse(strings.NewReader(examplePolicy))
+	h.Is(hammy.NilError(err))
+
+	rule, ok := p.Lookup(pcie.Device{Address: "0000:02:00.0", VendorID: "0x1A03", Class: "0x030000"})
+	h.Is(hammy.True(ok))
+	h.Is(hammy.String(rule.Name).EqualTo("bmc-vga"))
+
+	rule, ok = p.Lookup(pcie.Device{Address: "0000:17:00.1", Driver: "mlx5_core", Slot: "7"})
+	h.Is(hammy.True(ok))
+	h.Is(hammy.String(rule.Name).EqualTo("capped-nic"))
+
+	rule, ok = p.Lookup(pcie.Device{Address: "0000:17:00.1", Driver: "ice", Slot: "7"})
+	h.Is(hammy.True(ok))
+	h.Is(hammy.String(rule.Name).EqualTo("slot-7"))
+
+	_, ok = p.Lookup(pcie.Device{Address: "0000:18:00.0", VendorID: "0x1a03", Class: "0x020000"})
+	h.Is(hammy.False(ok))
+}
+
+func TestApplySetsExpectations(t *testing.T) {
+	h := hammy.New(t)
+
+	p, err := Parse(strings.NewReader(examplePolicy))
+	h.Is(hammy.NilError(err))
+
+	devices := []pcie.Device{
+		{
+			Address:          "0000:02:00.0",
+			VendorID:         "0x1a03",
+			Class:            "0x030000",
+			CurrentLinkSpeed: "2.5 GT/s PCIe",
+			MaxLinkSpeed:     "5.0 GT/s PCIe",
+			CurrentLinkWidth: "1",
+			MaxLinkWidth:     "1",
+		},
+		{Address: "0000:18:00.0", CurrentLinkSpeed: "2.5 GT/s PCIe", MaxLinkSpeed: "5.0 GT/s PCIe"},
+	}
+	p.Apply(devices)
+
+	h.Is(hammy.True(devices[0].NegotiatedOK))
+	h.Is(hammy.String(devices[0].Expectation.Rule).EqualTo("bmc-vga"))
+	h.Is(hammy.String(devices[0].Expectation.Width).EqualTo("1"))
+	h.Is(hammy.Nil(devices[1].Expectation))
+}
+
+func TestParseRejectsInvalidRules(t *testing.T) {
+	h := hammy.New(t)
+
+	invalid := []string{
+		`{"rules": [{"match": {"driver": "ast"}, "ignore": true}]}`,
+		`{"rules": [{"name": "empty-match", "match": {}, "ignore": true}]}`,
+		`{"rules": [{"name": "no-effect", "match": {"driver": "ast"}}]}`,
+		`{"rules": [{"name": "bad-speed", "match": {"driver": "ast"}, "expected_speed": "fast"}]}`,
+		`{"rules": [{"name": "bad-glob", "match": {"address": "0000:[17"}, "ignore": true}]}`,
+		`{"rules": [{"name": "typo", "match": {"drvier": "ast"}, "ignore": true}]}`,
+	}
+	for _, policy := range invalid {
+		_, err := Parse(strings.NewReader(policy))
+		h.Is(hammy.Error(err))
+	}
+}
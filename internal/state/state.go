@@ -0,0 +1,120 @@
+// Package state persists link history across exporter restarts. The state is
+// scoped to one boot of the host: a state file written under a different
+// boot ID is discarded on load.
+package state
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// State is the content of the state file.
+type State struct {
+	BootID    string                 `json:"boot_id"`
+	UpdatedAt time.Time              `json:"updated_at"`
+	Devices   map[string]DeviceState `json:"devices"`
+}
+
+// DeviceState is what is remembered about one device for the current boot.
+type DeviceState struct {
+	// BootLink is the first link state seen for the device during this boot.
+	BootLink *Link `json:"boot_link,omitempty"`
+	// Transitions holds cumulative link transition counts by kind.
+	Transitions map[string]uint64 `json:"transitions,omitempty"`
+}
+
+// Link is a negotiated link state and when it was first seen.
+type Link struct {
+	Speed  string    `json:"speed"`
+	Width  string    `json:"width"`
+	SeenAt time.Time `json:"seen_at"`
+}
+
+// Store reads and writes the state file for one boot.
+type Store struct {
+	path   string
+	bootID string
+}
+
+func NewStore(path, bootID string) *Store {
+	return &Store{path: path, bootID: bootID}
+}
+
+// ReadBootID returns the kernel boot ID from procfsRoot/sys/kernel/random/boot_id.
+func ReadBootID(procfsRoot string) (string, error) {
+	path := filepath.Join(procfsRoot, "sys", "kernel", "random", "boot_id")
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("read boot id from %s: %w", path, err)
+	}
+	bootID := strings.TrimSpace(string(buf))
+	if bootID == "" {
+		return "", fmt.Errorf("read boot id from %s: empty", path)
+	}
+	return bootID, nil
+}
+
+// Load returns the stored state for the current boot. A missing file or one
+// written during an earlier boot yields an empty state.
+func (s *Store) Load() (State, error) {
+	empty := State{BootID: s.bootID, Devices: make(map[string]DeviceState)}
+
+	buf, err := os.ReadFile(s.path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return empty, nil
+		}
+		return State{}, fmt.Errorf("read state file %s: %w", s.path, err)
+	}
+
+	var loaded State
+	if err := json.Unmarshal(buf, &loaded); err != nil {
+		return State{}, fmt.Errorf("parse state file %s: %w", s.path, err)
+	}
+	if loaded.BootID != s.bootID {
+		return empty, nil
+	}
+	if loaded.Devices == nil {
+		loaded.Devices = make(map[string]DeviceState)
+	}
+	return loaded, nil
+}
+
+// Save writes state to a temporary file in the same directory and renames it
+// over the state file, so a crash mid-write never leaves a truncated file.
+func (s *Store) Save(state State) error {
+	state.BootID = s.bootID
+	buf, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encode state: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("write state file %s: %w", s.path, err)
+	}
+	tmpPath := tmp.Name()
+	defer os.Remove(tmpPath)
+
+	if _, err := tmp.Write(append(buf, '\n')); err != nil {
+		tmp.Close()
+		return fmt.Errorf("write state file %s: %w", s.path, err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("write state file %s: %w", s.path, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("write state file %s: %w", s.path, err)
+	}
+	if err := os.Rename(tmpPath, s.path); err != nil {
+		return fmt.Errorf("write state file %s: %w", s.path, err)
+	}
+	return nil
+}
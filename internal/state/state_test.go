@@ -0,0 +1,77 @@
+package state
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gogunit/gunit/hammy"
+)
+
+func TestStoreRoundTripsWithinBoot(t *testing.T) {
+	h := hammy.New(t)
+
+	path := filepath.Join(t.TempDir(), "state.json")
+	seenAt := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	store := NewStore(path, "boot-a")
+	h.Is(hammy.NilError(store.Save(State{Devices: map[string]DeviceState{
+		"0000:01:00.0": {
+			BootLink:    &Link{Speed: "32.0 GT/s PCIe", Width: "16", SeenAt: seenAt},
+			Transitions: map[string]uint64{"width_down": 2},
+		},
+	}})))
+
+	loaded, err := NewStore(path, "boot-a").Load()
+	h.Is(hammy.NilError(err))
+	h.Is(hammy.String(loaded.BootID).EqualTo("boot-a"))
+	device := loaded.Devices["0000:01:00.0"]
+	h.Is(hammy.String(device.BootLink.Width).EqualTo("16"))
+	h.Is(hammy.True(device.BootLink.SeenAt.Equal(seenAt)))
+	h.Is(hammy.Number(device.Transitions["width_down"]).EqualTo(2))
+
+	entries, err := os.ReadDir(filepath.Dir(path))
+	h.Is(hammy.NilError(err))
+	h.Is(hammy.Number(len(entries)).EqualTo(1))
+}
+
+func TestStoreDiscardsStateFromEarlierBoot(t *testing.T) {
+	h := hammy.New(t)
+
+	path := filepath.Join(t.TempDir(), "state.json")
+	h.Is(hammy.NilError(NewStore(path, "boot-a").Save(State{Devices: map[string]DeviceState{
+		"0000:01:00.0": {Transitions: map[string]uint64{"link_down": 1}},
+	}})))
+
+	loaded, err := NewStore(path, "boot-b").Load()
+	h.Is(hammy.NilError(err))
+	h.Is(hammy.String(loaded.BootID).EqualTo("boot-b"))
+	h.Is(hammy.Number(len(loaded.Devices)).EqualTo(0))
+}
+
+func TestStoreLoadMissingAndCorruptFiles(t *testing.T) {
+	h := hammy.New(t)
+
+	dir := t.TempDir()
+	loaded, err := NewStore(filepath.Join(dir, "missing.json"), "boot-a").Load()
+	h.Is(hammy.NilError(err))
+	h.Is(hammy.Number(len(loaded.Devices)).EqualTo(0))
+
+	corrupt := filepath.Join(dir, "corrupt.json")
+	h.Is(hammy.NilError(os.WriteFile(corrupt, []byte("{"), 0o644)))
+	_, err = NewStore(corrupt, "boot-a").Load()
+	h.Is(hammy.Error(err))
+}
+
+func TestReadBootID(t *testing.T) {
+	h := hammy.New(t)
+
+	procfsRoot := t.TempDir()
+	bootIDPath := filepath.Join(procfsRoot, "sys", "kernel", "random", "boot_id")
+	h.Is(hammy.NilError(os.MkdirAll(filepath.Dir(bootIDPath), 0o755)))
+	h.Is(hammy.NilError(os.WriteFile(bootIDPath, []byte("5b8a5f6e-0c3d-4f0e-9d0a-2f7e6c1b9a11\n"), 0o444)))
+
+	bootID, err := ReadBootID(procfsRoot)
+	h.Is(hammy.NilError(err))
+	h.Is(hammy.String(bootID).EqualTo("5b8a5f6e-0c3d-4f0e-9d0a-2f7e6c1b9a11"))
+}
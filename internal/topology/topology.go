@@ -0,0 +1,284 @@
+// Package topology classifies the PCIe path between pairs of devices the way
+// `nvidia-smi topo -m` does, using only the sysfs topology tree. It needs no
+// vendor driver, so it can check GPUDirect RDMA placement on any host.
+package topology
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/nfisher/pcie-exporter/internal/pcie"
+)
+
+// Relationship is the kind of path between two devices, from closest to
+// farthest.
+type Relationship string
+
+const (
+	// Self is a device compared with itself.
+	Self Relationship = "X"
+	// PIX is a path through at most a single PCIe switch.
+	PIX Relationship = "PIX"
+	// PXB is a path through multiple PCIe switches without crossing a host bridge.
+	PXB Relationship = "PXB"
+	// PHB is a path through a PCIe host bridge.
+	PHB Relationship = "PHB"
+	// NODE is a path between host bridges within one NUMA node.
+	NODE Relationship = "NODE"
+	// SYS is a path across the interconnect between NUMA nodes.
+	SYS Relationship = "SYS"
+)
+
+// Relationships lists every relationship between distinct devices, closest first.
+var Relationships = []Relationship{PIX, PXB, PHB, NODE, SYS}
+
+// Class code prefixes of the device kinds the matrix is usually built for.
+const (
+	ClassGPU  = "03"
+	ClassNIC  = "02"
+	ClassNVMe = "0108"
+	// ClassVGA is the VGA compatible controller subclass of ClassGPU. Some
+	// GPUs, such as the A40, use it as well as the BMC's onboard graphics.
+	ClassVGA = "0300"
+)
+
+// DefaultClasses selects GPUs and NICs.
+var DefaultClasses = []string{ClassGPU, ClassNIC}
+
+// BMCDisplays match the onboard VGA of server baseboard management
+// controllers: ASPEED, and the Matrox G200 variants in Dell iDRAC and HPE
+// iLO. Nearly every server has one and it is no GPU, so Build leaves them out.
+var BMCDisplays = []pcie.IDMatch{
+	{ClassPrefix: ClassVGA, VendorID: "0x1a03"},
+	{ClassPrefix: ClassVGA, VendorID: "0x102b"},
+}
+
+// Endpoint is one row and column of the matrix.
+type Endpoint struct {
+	// Label is a short column name such as GPU0 or NIC1.
+	Label    string `json:"label"`
+	BusID    string `json:"bus_id"`
+	Name     string `json:"name"`
+	Class    string `json:"class"`
+	NUMANode int    `json:"numa_node"`
+}
+
+// Matrix holds the relationship between every pair of selected devices.
+// Relationships[i][j] is the path from Endpoints[i] to Endpoints[j].
+type Matrix struct {
+	Endpoints     []Endpoint       `json:"endpoints"`
+	Relationships [][]Relationship `json:"matrix"`
+}
+
+type position struct {
+	node *pcie.TreeNode
+	// ancestors runs from the tree root down to the node's parent.
+	ancestors []string
+}
+
+// Build computes the matrix for the devices in tree whose class code starts
+// with one of classPrefixes. Endpoints are ordered by class prefix, then in
+// tree order, which is bus ID order for trees from pcie.ReadTree. SR-IOV
+// virtual functions share their physical function's placement and are left
+// out, as are BMCDisplays.
+func Build(tree []*pcie.TreeNode, classPrefixes []string) *Matrix {
+	var positions []position
+	for _, prefix := range classPrefixes {
+		walk(tree, nil, func(node *pcie.TreeNode, ancestors []string) {
+			if node.SRIOV.IsVF() || isBMCDisplay(node) {
+				return
+			}
+			if pcie.HasClassPrefix(node.Class, prefix) && !selected(positions, node) {
+				positions = append(positions, position{node: node, ancestors: ancestors})
+			}
+		})
+	}
+
+	m := &Matrix{
+		Endpoints:     make([]Endpoint, len(positions)),
+		Relationships: make([][]Relationship, len(positions)),
+	}
+	counts := make(map[string]int)
+	for i, p := range positions {
+		kind := kindLabel(p.node.Class)
+		m.Endpoints[i] = Endpoint{
+			Label:    kind + strconv.Itoa(counts[kind]),
+			BusID:    p.node.BusID,
+			Name:     p.node.Name,
+			Class:    p.node.Class,
+			NUMANode: p.node.NUMAAffinity.Node,
+		}
+		counts[kind]++
+	}
+	for i := range positions {
+		m.Relationships[i] = make([]Relationship, len(positions))
+		for j := range positions {
+			m.Relationships[i][j] = classify(positions[i], positions[j])
+		}
+	}
+	return m
+}
+
+func isBMCDisplay(node *pcie.TreeNode) bool {
+	for _, match := range BMCDisplays {
+		if match.MatchesNode(node) {
+			return true
+		}
+	}
+	return false
+}
+
+func selected(positions []position, node *pcie.TreeNode) bool {
+	for _, p := range positions {
+		if p.node == node {
+			return true
+		}
+	}
+	return false
+}
+
+func walk(nodes []*pcie.TreeNode, ancestors []string, visit func(node *pcie.TreeNode, ancestors []string)) {
+	for _, node := range nodes {
+		visit(node, ancestors)
+		// Copy so sibling subtrees do not share a backing array.
+		childAncestors := append(append([]string(nil), ancestors...), node.BusID)
+		walk(node.Children, childAncestors, visit)
+	}
+}
+
+// classify compares the paths from the tree root to each device. A shared
+// ancestor means the devices sit below the same switch hierarchy; without
+// one they only meet at a host bridge, which is identified by the domain and
+// bus of the device at the top of each path.
+func classify(a, b position) Relationship {
+	if a.node == b.node {
+		return Self
+	}
+
+	pathA := append(append([]string(nil), a.ancestors...), a.node.BusID)
+	pathB := append(append([]string(nil), b.ancestors...), b.node.BusID)
+	common := 0
+	for common < len(pathA) && common < len(pathB) && pathA[common] == pathB[common] {
+		common++
+	}
+
+	if common > 0 {
+		// Below the lowest common ancestor, a device reached through one
+		// downstream port is one switch away; anything deeper crosses more.
+		if len(pathA)-common <= 2 && len(pathB)-common <= 2 {
+			return PIX
+		}
+		return PXB
+	}
+
+	if hostBridge(pathA[0]) == hostBridge(pathB[0]) {
+		return PHB
+	}
+	nodeA, nodeB := a.node.NUMAAffinity.Node, b.node.NUMAAffinity.Node
+	if nodeA == nodeB || nodeA == pcie.NoNUMANode || nodeB == pcie.NoNUMANode {
+		return NODE
+	}
+	return SYS
+}
+
+// hostBridge returns the "domain:bus" of a device directly below a host
+// bridge, which is the bus the host bridge exposes.
+func hostBridge(busID string) string {
+	if i := strings.LastIndexByte(busID, ':'); i >= 0 {
+		return busID[:i]
+	}
+	return busID
+}
+
+func kindLabel(class string) string {
+	class = pcie.NormalizeHexID(class)
+	switch {
+	case strings.HasPrefix(class, ClassNVMe):
+		return "NVME"
+	case strings.HasPrefix(class, ClassGPU):
+		return "GPU"
+	case strings.HasPrefix(class, ClassNIC):
+		return "NIC"
+	default:
+		return "DEV"
+	}
+}
+
+// PairCount is the number of device pairs of two classes with one relationship.
+type PairCount struct {
+	Relationship Relationship
+	Count        int
+}
+
+// CountPairs counts, for every relationship in Relationships, the pairs with
+// one device of class prefix classA and the other of classB.
+func (m *Matrix) CountPairs(classA, classB string) []PairCount {
+	counts := make(map[Relationship]int)
+	for i, a := range m.Endpoints {
+		if !pcie.HasClassPrefix(a.Class, classA) {
+			continue
+		}
+		for j, b := range m.Endpoints {
+			if i == j || !pcie.HasClassPrefix(b.Class, classB) {
+				continue
+			}
+			counts[m.Relationships[i][j]]++
+		}
+	}
+
+	pairs := make([]PairCount, 0, len(Relationships))
+	for _, relationship := range Relationships {
+		pairs = append(pairs, PairCount{Relationship: relationship, Count: counts[relationship]})
+	}
+	return pairs
+}
+
+// CountGPUNICPairs counts the GPU-NIC pairs in tree by relationship. It builds
+// its own matrix of GPUs and NICs, so the counts do not depend on the classes
+// chosen for the full matrix.
+func CountGPUNICPairs(tree []*pcie.TreeNode) []PairCount {
+	return Build(tree, []string{ClassGPU, ClassNIC}).CountPairs(ClassGPU, ClassNIC)
+}
+
+// WriteText renders the matrix in the layout of `nvidia-smi topo -m`.
+func (m *Matrix) WriteText(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+
+	header := []string{""}
+	for _, endpoint := range m.Endpoints {
+		header = append(header, endpoint.Label)
+	}
+	header = append(header, "NUMA Affinity", "Bus ID", "Name")
+	fmt.Fprintln(tw, strings.Join(header, "\t"))
+
+	for i, endpoint := range m.Endpoints {
+		row := []string{endpoint.Label}
+		for _, relationship := range m.Relationships[i] {
+			row = append(row, string(relationship))
+		}
+		numa := "N/A"
+		if endpoint.NUMANode != pcie.NoNUMANode {
+			numa = strconv.Itoa(endpoint.NUMANode)
+		}
+		row = append(row, numa, endpoint.BusID, endpoint.Name)
+		fmt.Fprintln(tw, strings.Join(row, "\t"))
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	_, err := io.WriteString(w, `
+Legend:
+
+  X    = Self
+  SYS  = Connection traversing PCIe as well as the SMP interconnect between NUMA nodes
+  NODE = Connection traversing PCIe as well as the interconnect between PCIe Host Bridges within a NUMA node
+  PHB  = Connection traversing PCIe as well as a PCIe Host Bridge
+  PXB  = Connection traversing multiple PCIe bridges (without traversing the PCIe Host Bridge)
+  PIX  = Connection traversing at most a single PCIe bridge
+`)
+	return err
+}
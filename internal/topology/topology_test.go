@@ -0,0 +1,129 @@
+package topology
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/gogunit/gunit/hammy"
+	"github.com/nfisher/pcie-exporter/internal/pcie"
+)
+
+func node(busID, class string, numaNode int, children ...*pcie.TreeNode) *pcie.TreeNode {
+	return &pcie.TreeNode{
+		BusID:        busID,
+		Name:         busID,
+		Class:        class,
+		NUMAAffinity: pcie.NUMAAffinity{Node: numaNode},
+		Children:     children,
+	}
+}
+
+// twoSocketTree is a host with one switch per socket. Socket 0 has two root
+// complexes: one with a switch holding GPU0, NIC0 and a nested switch with
+// GPU1, and one with NIC1 directly on a root port. Socket 1 has GPU2.
+func twoSocketTree() []*pcie.TreeNode {
+	return []*pcie.TreeNode{
+		node("0000:00:01.0", "0x060400", 0,
+			node("0000:01:00.0", "0x060400", 0,
+				node("0000:02:00.0", "0x060400", 0, node("0000:03:00.0", "0x030200", 0)),
+				node("0000:02:01.0", "0x060400", 0, node("0000:04:00.0", "0x020000", 0)),
+				node("0000:02:02.0", "0x060400", 0,
+					node("0000:05:00.0", "0x060400", 0,
+						node("0000:06:00.0", "0x060400", 0, node("0000:07:00.0", "0x030200", 0)))),
+			),
+		),
+		node("0000:40:01.0", "0x060400", 0, node("0000:41:00.0", "0x020700", 0)),
+		node("0000:80:01.0", "0x060400", 1,
+			node("0000:81:00.0", "0x060400", 1,
+				node("0000:82:00.0", "0x060400", 1, node("0000:83:00.0", "0x030200", 1)))),
+		node("0000:00:02.0", "0x060400", 0, node("0000:08:00.0", "0x020000", 0)),
+	}
+}
+
+func TestBuildClassifiesPairs(t *testing.T) {
+	h := hammy.New(t)
+
+	m := Build(twoSocketTree(), DefaultClasses)
+
+	h.Is(hammy.Number(len(m.Endpoints)).EqualTo(6))
+	labels := make([]string, 0, len(m.Endpoints))
+	for _, endpoint := range m.Endpoints {
+		labels = append(labels, endpoint.Label)
+	}
+	h.Is(hammy.Slice(labels).EqualTo("GPU0", "GPU1", "GPU2", "NIC0", "NIC1", "NIC2"))
+
+	gpu0, gpu1, gpu2, nic0, nic1, nic2 := 0, 1, 2, 3, 4, 5
+	h.Is(hammy.String(string(m.Relationships[gpu0][gpu0])).EqualTo(string(Self)))
+	h.Is(hammy.String(string(m.Relationships[gpu0][nic0])).EqualTo(string(PIX)))
+	h.Is(hammy.String(string(m.Relationships[nic0][gpu0])).EqualTo(string(PIX)))
+	h.Is(hammy.String(string(m.Relationships[gpu0][gpu1])).EqualTo(string(PXB)))
+	h.Is(hammy.String(string(m.Relationships[gpu0][nic2])).EqualTo(string(PHB)))
+	h.Is(hammy.String(string(m.Relationships[gpu0][nic1])).EqualTo(string(NODE)))
+	h.Is(hammy.String(string(m.Relationships[gpu2][nic0])).EqualTo(string(SYS)))
+}
+
+func TestCountPairs(t *testing.T) {
+	h := hammy.New(t)
+
+	m := Build(twoSocketTree(), DefaultClasses)
+	pairs := m.CountPairs(ClassGPU, ClassNIC)
+
+	h.Is(hammy.Slice(pairs).EqualTo(
+		PairCount{Relationship: PIX, Count: 1},
+		PairCount{Relationship: PXB, Count: 1},
+		PairCount{Relationship: PHB, Count: 2},
+		PairCount{Relationship: NODE, Count: 2},
+		PairCount{Relationship: SYS, Count: 3},
+	))
+}
+
+func TestBuildLeavesOutBMCDisplays(t *testing.T) {
+	h := hammy.New(t)
+
+	// An ASPEED BMC display on its own root port next to a VGA class GPU.
+	bmc := node("0000:02:00.0", "0x030000", 0)
+	bmc.VendorID = "0x1a03"
+	gpu := node("0000:03:00.0", "0x030000", 0)
+	gpu.VendorID = "0x10de"
+	tree := []*pcie.TreeNode{
+		node("0000:00:1c.0", "0x060400", 0, bmc),
+		node("0000:00:01.0", "0x060400", 0, gpu),
+	}
+
+	m := Build(tree, DefaultClasses)
+	h.Is(hammy.Number(len(m.Endpoints)).EqualTo(1))
+	h.Is(hammy.String(m.Endpoints[0].BusID).EqualTo("0000:03:00.0"))
+	h.Is(hammy.String(m.Endpoints[0].Label).EqualTo("GPU0"))
+}
+
+func TestCountGPUNICPairsIgnoresMatrixClasses(t *testing.T) {
+	h := hammy.New(t)
+
+	// Narrowing the matrix to NVMe must not empty the GPU-NIC counts.
+	m := Build(twoSocketTree(), []string{ClassNVMe})
+	h.Is(hammy.Slice(m.Endpoints).IsEmpty())
+	h.Is(hammy.Slice(CountGPUNICPairs(twoSocketTree())).EqualTo(
+		PairCount{Relationship: PIX, Count: 1},
+		PairCount{Relationship: PXB, Count: 1},
+		PairCount{Relationship: PHB, Count: 2},
+		PairCount{Relationship: NODE, Count: 2},
+		PairCount{Relationship: SYS, Count: 3},
+	))
+}
+
+func TestWriteText(t *testing.T) {
+	h := hammy.New(t)
+
+	tree := []*pcie.TreeNode{
+		node("0000:00:01.0", "0x060400", pcie.NoNUMANode,
+			node("0000:01:00.0", "0x030200", pcie.NoNUMANode),
+			node("0000:01:00.1", "0x020000", pcie.NoNUMANode)),
+	}
+	var buf bytes.Buffer
+	h.Is(hammy.NilError(Build(tree, DefaultClasses).WriteText(&buf)))
+
+	text := buf.String()
+	h.Is(hammy.String(text).Contains("      GPU0  NIC0  NUMA Affinity  Bus ID        Name\n"))
+	h.Is(hammy.String(text).Contains("GPU0  X     PIX   N/A            0000:01:00.0  0000:01:00.0\n"))
+	h.Is(hammy.String(text).Contains("PIX  = Connection traversing at most a single PCIe bridge"))
+}
@@ -48,6 +48,19 @@ files=(
   current_link_width
   max_link_speed
   max_link_width
+  aer_dev_correctable
+  aer_dev_nonfatal
+  aer_dev_fatal
+  aer_rootport_total_err_cor
+  aer_rootport_total_err_nonfatal
+  aer_rootport_total_err_fatal
+  config
+  numa_node
+  local_cpulist
+  local_cpus
+  label
+  sriov_totalvfs
+  sriov_numvfs
   modalias
   uevent
 )
@@ -66,7 +79,7 @@ mkdir -p "$snapshot/bus/pci/devices"
 
 for device_path in "$devices_dir"/*; do
   device_id="$(basename "$device_path")"
-  [[ "$device_id" =~ ^[0-9a-fA-F]{4}:[0-9a-fA-F]{2}:[0-9a-fA-F]{2}\.[0-7]$ ]] || continue
+  [[ "$device_id" =~ ^[0-9a-fA-F]{4,8}:[0-9a-fA-F]{2}:[0-9a-fA-F]{2}\.[0-7]$ ]] || continue
 
   echo "$device_id" >> "$snapshot/devices.txt"
 
@@ -79,11 +92,62 @@ for device_path in "$devices_dir"/*; do
     fi
   done
 
+  # Bound kernel device names (eth2, nvme3, mlx5_1, card1) are directories;
+  # recreate them empty so bindings survive the capture.
+  for kind in net nvme block infiniband drm; do
+    [[ -d "$device_path/$kind" ]] || continue
+    for bound in "$device_path/$kind"/*; do
+      [[ -e "$bound" ]] || continue
+      mkdir -p "$out_dir/$kind/$(basename "$bound")"
+      if [[ "$kind" == nvme ]]; then
+        for namespace in "$bound"/nvme*n*; do
+          [[ -d "$namespace" ]] && mkdir -p "$out_dir/$kind/$(basename "$bound")/$(basename "$namespace")"
+        done
+      fi
+    done
+  done
+
+  if [[ -d "$device_path/link" ]]; then
+    mkdir -p "$out_dir/link"
+    for f in l0s_aspm l1_aspm l1_1_aspm l1_2_aspm clkpm; do
+      if [[ -f "$device_path/link/$f" && -r "$device_path/link/$f" ]]; then
+        cp "$device_path/link/$f" "$out_dir/link/$f"
+      fi
+    done
+  fi
+
+  # SR-IOV links point at sibling functions; keep them relative so they
+  # resolve inside the snapshot.
+  for link in "$device_path"/physfn "$device_path"/virtfn*; do
+    [[ -L "$link" ]] || continue
+    ln -s "../$(basename "$(readlink "$link")")" "$out_dir/$(basename "$link")"
+  done
+
   if [[ -L "$device_path/driver" ]]; then
     readlink "$device_path/driver" > "$out_dir/driver-link.txt"
   fi
 done
 
+aspm_policy="$sysfs_root/module/pcie_aspm/parameters/policy"
+if [[ -f "$aspm_policy" && -r "$aspm_policy" ]]; then
+  mkdir -p "$snapshot/module/pcie_aspm/parameters"
+  cp "$aspm_policy" "$snapshot/module/pcie_aspm/parameters/policy"
+fi
+
+slots_dir="$sysfs_root/bus/pci/slots"
+if [[ -d "$slots_dir" ]]; then
+  for slot_path in "$slots_dir"/*; do
+    [[ -d "$slot_path" ]] || continue
+    out_dir="$snapshot/bus/pci/slots/$(basename "$slot_path")"
+    mkdir -p "$out_dir"
+    for f in address power attention max_bus_speed cur_bus_speed; do
+      if [[ -f "$slot_path/$f" && -r "$slot_path/$f" ]]; then
+        cp "$slot_path/$f" "$out_dir/$f"
+      fi
+    done
+  done
+fi
+
 sort -u "$snapshot/devices.txt" -o "$snapshot/devices.txt"
 tar -czf "$output" -C "$tmpdir" sysfs_snapshot
 